@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"libraryapi/internal/app"
+	"libraryapi/internal/domain/repositories"
+	"libraryapi/internal/pkg/auth"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+func runAPIKey(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	repo, err := openRepo(ctx)
+	if err != nil {
+		return err
+	}
+	defer app.CloseStorage(repo)
+	keys, ok := repo.(repositories.APIKeyRepository)
+	if !ok {
+		return fmt.Errorf("the %s backend does not store API keys", cfg.Storage.Backend)
+	}
+
+	switch args[0] {
+	case "create":
+		return createAPIKey(ctx, keys, args[1:])
+	case "list":
+		if len(args) != 1 {
+			return errUsage
+		}
+		return listAPIKeys(ctx, keys)
+	case "revoke":
+		if len(args) != 2 {
+			return errUsage
+		}
+		if err := keys.RevokeAPIKey(ctx, args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("revoked %s\n", args[1])
+		return nil
+	default:
+		return errUsage
+	}
+}
+
+// createAPIKey issues a key without an authenticated caller, so it can
+// bootstrap the first key of a fresh installation.
+func createAPIKey(ctx context.Context, keys repositories.APIKeyRepository, args []string) error {
+	fs := flag.NewFlagSet("apikey create", flag.ContinueOnError)
+	name := fs.String("name", "", "what the key is for")
+	scopes := fs.String("scopes", string(auth.PermBooksRead), "comma-separated permissions")
+	expires := fs.Duration("expires", 0, "lifetime, e.g. 720h (default: never expires)")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 || *name == "" {
+		return errUsage
+	}
+
+	var expiresAt *time.Time
+	if *expires > 0 {
+		t := time.Now().Add(*expires)
+		expiresAt = &t
+	}
+	key, plaintext, err := auth.NewAPIKeys(keys).Issue(ctx, *name, strings.Split(*scopes, ","), expiresAt, "libctl")
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "created API key %s (%s); it is shown only once:\n", key.ID, key.Prefix)
+	fmt.Println(plaintext)
+	return nil
+}
+
+func listAPIKeys(ctx context.Context, keys repositories.APIKeyRepository) error {
+	list, err := keys.ListAPIKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	formatTime := func(t *time.Time) string {
+		if t == nil {
+			return "-"
+		}
+		return t.Format(time.RFC3339)
+	}
+	now := time.Now()
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tPREFIX\tNAME\tSCOPES\tEXPIRES\tLAST USED\tACTIVE")
+	for _, k := range list {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%t\n",
+			k.ID, k.Prefix, k.Name, strings.Join(k.Scopes, ","),
+			formatTime(k.ExpiresAt), formatTime(k.LastUsedAt), k.Active(now))
+	}
+	return tw.Flush()
+}
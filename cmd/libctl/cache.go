@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"libraryapi/internal/app"
+	"os"
+)
+
+func runCache(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	c := app.NewCache(cfg)
+	defer c.Close()
+
+	switch {
+	case args[0] == "flush" && len(args) == 1:
+		if err := c.Clear(ctx); err != nil {
+			return err
+		}
+		fmt.Println("cache flushed")
+	case args[0] == "get" && len(args) == 2:
+		// Any codec decodes into an interface value except gob, which
+		// needs the concrete type.
+		var value interface{}
+		if err := c.Get(ctx, args[1], &value); err != nil {
+			return fmt.Errorf("get %s: %w", args[1], err)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(value)
+	case args[0] == "delete" && len(args) == 2:
+		if err := c.Delete(ctx, args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("deleted %s\n", args[1])
+	default:
+		return errUsage
+	}
+	return nil
+}
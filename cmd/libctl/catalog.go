@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"libraryapi/internal/api/dto"
+	"libraryapi/internal/app"
+	"libraryapi/internal/config"
+	"libraryapi/internal/domain/models"
+	"libraryapi/internal/domain/repositories"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// openRepo opens the configured storage. The memory backend lives inside a
+// single process, so there is nothing libctl could act on.
+func openRepo(ctx context.Context) (repositories.BookRepository, error) {
+	if cfg.Storage.Backend == config.BackendMemory {
+		return nil, errors.New("the memory backend only exists inside the server process")
+	}
+	return app.OpenStorage(ctx, cfg)
+}
+
+var seedBooks = []dto.CreateBookRequest{
+	{Title: "1984", Author: "George Orwell", Year: 1949},
+	{Title: "Animal Farm", Author: "George Orwell", Year: 1945},
+	{Title: "Brave New World", Author: "Aldous Huxley", Year: 1932},
+	{Title: "To Kill a Mockingbird", Author: "Harper Lee", Year: 1960},
+	{Title: "The Great Gatsby", Author: "F. Scott Fitzgerald", Year: 1925},
+}
+
+func runSeed(ctx context.Context, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	repo, err := openRepo(ctx)
+	if err != nil {
+		return err
+	}
+	defer app.CloseStorage(repo)
+
+	for _, b := range seedBooks {
+		if _, err := repo.Create(ctx, b.Title, b.Author, b.Year); err != nil {
+			return fmt.Errorf("create %q: %w", b.Title, err)
+		}
+	}
+	fmt.Printf("added %d books\n", len(seedBooks))
+	return nil
+}
+
+// formatOf picks the file format from -format or the file extension.
+func formatOf(format, path string) (string, error) {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+		if format == "" {
+			format = "json"
+		}
+	}
+	if format != "json" && format != "csv" {
+		return "", fmt.Errorf("unsupported format %q, use json or csv", format)
+	}
+	return format, nil
+}
+
+func runExport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "", "json or csv (default: from -o extension, else json)")
+	out := fs.String("o", "", "output file (default: stdout)")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+	f, err := formatOf(*format, *out)
+	if err != nil {
+		return err
+	}
+
+	repo, err := openRepo(ctx)
+	if err != nil {
+		return err
+	}
+	defer app.CloseStorage(repo)
+
+	var books []models.Book
+	for page := 1; ; page++ {
+		batch, total, err := repo.Getall(ctx, dto.Pagination{Page: page, Limit: 500})
+		if err != nil {
+			return err
+		}
+		books = append(books, batch...)
+		if len(batch) == 0 || len(books) >= total {
+			break
+		}
+	}
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	if f == "csv" {
+		err = writeCSV(w, books)
+	} else {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(books)
+	}
+	if err != nil {
+		return err
+	}
+	if *out != "" {
+		fmt.Fprintf(os.Stderr, "exported %d books to %s\n", len(books), *out)
+	}
+	return nil
+}
+
+func writeCSV(w io.Writer, books []models.Book) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "title", "author", "year", "created_at", "updated_at"})
+	for _, b := range books {
+		updated := ""
+		if !b.UpdatedAt.IsZero() {
+			updated = b.UpdatedAt.Format(time.RFC3339)
+		}
+		cw.Write([]string{b.ID, b.Title, b.Author, strconv.Itoa(b.Year), b.Created_at.Format(time.RFC3339), updated})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// runImport adds every book in the file as a new catalog entry. The whole
+// file is validated first, so a bad row imports nothing.
+func runImport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := fs.String("format", "", "json or csv (default: from the file extension)")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return errUsage
+	}
+	path := fs.Arg(0)
+	f, err := formatOf(*format, path)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var books []dto.CreateBookRequest
+	if f == "csv" {
+		books, err = readCSV(file)
+	} else {
+		err = json.NewDecoder(file).Decode(&books)
+	}
+	if err != nil {
+		return fmt.Errorf("read %s: %w", path, err)
+	}
+
+	var invalid []string
+	for i := range books {
+		if err := books[i].Validate(); err != nil {
+			invalid = append(invalid, fmt.Sprintf("record %d: %v", i+1, err))
+		}
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("%d invalid records, nothing imported:\n  %s", len(invalid), strings.Join(invalid, "\n  "))
+	}
+
+	repo, err := openRepo(ctx)
+	if err != nil {
+		return err
+	}
+	defer app.CloseStorage(repo)
+
+	for i, b := range books {
+		if _, err := repo.Create(ctx, b.Title, b.Author, b.Year); err != nil {
+			return fmt.Errorf("record %d (%d imported so far): %w", i+1, i, err)
+		}
+	}
+	fmt.Printf("imported %d books\n", len(books))
+	return nil
+}
+
+// readCSV reads title, author and year columns located by the header row;
+// other columns, such as those written by export, are ignored.
+func readCSV(r io.Reader) ([]dto.CreateBookRequest, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	col := make(map[string]int)
+	for i, name := range records[0] {
+		col[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"title", "author", "year"} {
+		if _, ok := col[name]; !ok {
+			return nil, fmt.Errorf("missing %q column", name)
+		}
+	}
+
+	books := make([]dto.CreateBookRequest, 0, len(records)-1)
+	for line, rec := range records[1:] {
+		year, err := strconv.Atoi(strings.TrimSpace(rec[col["year"]]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid year %q", line+2, rec[col["year"]])
+		}
+		books = append(books, dto.CreateBookRequest{
+			Title:  rec[col["title"]],
+			Author: rec[col["author"]],
+			Year:   year,
+		})
+	}
+	return books, nil
+}
+
+func runReindex(ctx context.Context, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	repo, err := openRepo(ctx)
+	if err != nil {
+		return err
+	}
+	defer app.CloseStorage(repo)
+
+	r, ok := repo.(repositories.Reindexer)
+	if !ok {
+		fmt.Printf("%s backend has no search index to rebuild\n", cfg.Storage.Backend)
+		return nil
+	}
+	if err := r.Reindex(ctx); err != nil {
+		return err
+	}
+	fmt.Println("search index rebuilt")
+	return nil
+}
@@ -0,0 +1,104 @@
+// Command libctl runs catalog and operational tasks against the same storage,
+// cache and configuration as the API server. It accepts the server's -config
+// and setting flags before the command name.
+//
+//	libctl [-config FILE] [flags] <command> [arguments]
+//
+//	libctl migrate up|down [N]|status|goto VERSION
+//	libctl seed
+//	libctl export [-format json|csv] [-o FILE]
+//	libctl import [-format json|csv] FILE
+//	libctl cache flush|get KEY|delete KEY
+//	libctl reindex
+//	libctl apikey create -name NAME [-scopes S1,S2] [-expires DURATION] | list | revoke ID
+//	libctl user create -email EMAIL [-roles R1,R2] | list
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"libraryapi/internal/config"
+	"libraryapi/internal/pkg/logger"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/joho/godotenv"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(ctx context.Context, args []string) error
+}
+
+var commands = []command{
+	{"migrate", "up | down [N] | status | goto VERSION", runMigrate},
+	{"seed", "add the sample catalog", runSeed},
+	{"export", "[-format json|csv] [-o FILE]", runExport},
+	{"import", "[-format json|csv] FILE", runImport},
+	{"cache", "flush | get KEY | delete KEY", runCache},
+	{"reindex", "rebuild the search index", runReindex},
+	{"apikey", "create -name NAME [-scopes S1,S2] [-expires DURATION] | list | revoke ID", runAPIKey},
+	{"user", "create -email EMAIL [-roles R1,R2] (password on stdin) | list", runUser},
+}
+
+// errUsage makes main print the usage of the failing command.
+var errUsage = errors.New("invalid arguments")
+
+// cfg is the configuration shared by every command.
+var cfg *config.Config
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: libctl [-config FILE] [flags] <command> [arguments]")
+	fmt.Fprintln(os.Stderr)
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", c.name, c.usage)
+	}
+}
+
+func main() {
+	_ = godotenv.Load()
+
+	// Only warnings by default, so command output is not buried in logs.
+	defaults := config.Default()
+	defaults.Log.Level = "warn"
+	defaults.Log.Pretty = true
+	flag.Usage = usage
+	var err error
+	if cfg, err = config.Load(defaults, flag.CommandLine, os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	logger.Init(cfg.Log.Level, cfg.Log.Pretty)
+
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	name, args := flag.Arg(0), flag.Args()[1:]
+	for _, c := range commands {
+		if c.name != name {
+			continue
+		}
+		if err := c.run(ctx, args); err != nil {
+			if errors.Is(err, errUsage) {
+				fmt.Fprintf(os.Stderr, "usage: libctl %s %s\n", c.name, c.usage)
+				os.Exit(2)
+			}
+			fmt.Fprintf(os.Stderr, "libctl %s: %v\n", name, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "libctl: unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"libraryapi/internal/app"
+	"libraryapi/internal/config"
+	"libraryapi/internal/pkg/migrate"
+	"os"
+	"strconv"
+	"text/tabwriter"
+)
+
+func runMigrate(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	if cfg.Storage.Backend != config.BackendPostgres {
+		return fmt.Errorf("migrations apply to the postgres backend; %s manages its own schema", cfg.Storage.Backend)
+	}
+
+	migrator, db, err := app.OpenMigrator(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var changed []int
+	switch args[0] {
+	case "up":
+		changed, err = migrator.Up(ctx)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return errUsage
+			}
+		}
+		changed, err = migrator.Down(ctx, steps)
+	case "goto":
+		if len(args) != 2 {
+			return errUsage
+		}
+		version, convErr := strconv.Atoi(args[1])
+		if convErr != nil || version < 0 {
+			return errUsage
+		}
+		changed, err = migrator.Goto(ctx, version)
+	case "status":
+		return printStatus(ctx, migrator)
+	default:
+		return errUsage
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(changed) == 0 {
+		fmt.Println("nothing to do")
+	}
+	for _, v := range changed {
+		fmt.Printf("%s %03d\n", args[0], v)
+	}
+	version, err := migrator.Version(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("schema version: %d\n", version)
+	return nil
+}
+
+func printStatus(ctx context.Context, migrator *migrate.Migrator) error {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+	for _, s := range statuses {
+		appliedAt := "-"
+		if !s.AppliedAt.IsZero() {
+			appliedAt = s.AppliedAt.Local().Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(tw, "%03d\t%s\t%s\t%s\n", s.Version, s.Name, s.State, appliedAt)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"libraryapi/internal/app"
+	"libraryapi/internal/domain/models"
+	"libraryapi/internal/domain/repositories"
+	"libraryapi/internal/pkg/auth"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+func runUser(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	repo, err := openRepo(ctx)
+	if err != nil {
+		return err
+	}
+	defer app.CloseStorage(repo)
+	users, ok := repo.(repositories.UserRepository)
+	if !ok {
+		return fmt.Errorf("the %s backend does not store users", cfg.Storage.Backend)
+	}
+
+	switch args[0] {
+	case "create":
+		return createUser(ctx, users, args[1:])
+	case "list":
+		if len(args) != 1 {
+			return errUsage
+		}
+		return listUsers(ctx, users)
+	default:
+		return errUsage
+	}
+}
+
+// createUser adds an account with any roles, so it can bootstrap the first
+// admin. The password is read from the first line of stdin to keep it out of
+// the shell history.
+func createUser(ctx context.Context, users repositories.UserRepository, args []string) error {
+	fs := flag.NewFlagSet("user create", flag.ContinueOnError)
+	email := fs.String("email", "", "login email")
+	roles := fs.String("roles", auth.RolePatron, "comma-separated roles")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 || *email == "" {
+		return errUsage
+	}
+
+	fmt.Fprint(os.Stderr, "password: ")
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && password == "" {
+		return fmt.Errorf("read password: %w", err)
+	}
+	password = strings.TrimRight(password, "\r\n")
+	if len(password) < 8 {
+		return errors.New("the password must be at least 8 characters")
+	}
+
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	user, err := users.CreateUser(ctx, models.User{
+		Email:        auth.NormalizeEmail(*email),
+		PasswordHash: hash,
+		Roles:        strings.Split(*roles, ","),
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("created user %s (%s) with roles %s\n", user.ID, user.Email, strings.Join(user.Roles, ","))
+	return nil
+}
+
+func listUsers(ctx context.Context, users repositories.UserRepository) error {
+	list, err := users.ListUsers(ctx)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tEMAIL\tROLES\tCREATED\tLOCKED UNTIL")
+	for _, u := range list {
+		locked := "-"
+		if u.LockedUntil != nil {
+			locked = u.LockedUntil.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", u.ID, u.Email, strings.Join(u.Roles, ","),
+			u.CreatedAt.Local().Format("2006-01-02 15:04"), locked)
+	}
+	return tw.Flush()
+}
@@ -2,106 +2,185 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
-	storage "libraryapi/internal/Storage/postgres"
 	"libraryapi/internal/api/handlers"
+	"libraryapi/internal/api/middleware"
 	"libraryapi/internal/api/router"
+	"libraryapi/internal/app"
+	"libraryapi/internal/config"
+	"libraryapi/internal/domain/repositories"
+	"libraryapi/internal/pkg/auth"
 	"libraryapi/internal/pkg/cache"
+	"libraryapi/internal/pkg/i18n"
 	"libraryapi/internal/pkg/logger"
+	"libraryapi/internal/pkg/mail"
+	"libraryapi/internal/pkg/metrics"
+	"libraryapi/internal/pkg/tracing"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
 )
 
 func main() {
-	if err := godotenv.Load(); err != nil {
-		log.Warn().Msg("Warning: .env file not found, using environment variables")
+	envErr := godotenv.Load()
+
+	// Конфигурация: значения по умолчанию < файл < переменные окружения < флаги
+	printConfig := flag.Bool("print-config", false, "print the effective configuration with secrets redacted and exit")
+	cfg, err := config.Load(config.Default(), flag.CommandLine, os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if *printConfig {
+		if err := cfg.Redacted().WriteYAML(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
 	}
 
 	// Инициализация логгера
-	logLevel := os.Getenv("LOG_LEVEL")
-	if logLevel == "" {
-		logLevel = "debug"
+	logger.Init(cfg.Log.Level, cfg.Log.Pretty)
+	if envErr != nil {
+		log.Warn().Msg("Warning: .env file not found, using environment variables")
 	}
-	logPretty := os.Getenv("LOG_PRETTY") == "true"
-	logger.Init(logLevel, logPretty)
 
 	log.Info().Msg("Starting Library API server")
+	log.Info().Interface("config", cfg.Redacted()).Msg("Configuration loaded")
 
-	// 1. Инициализация Redis
-	redisHost := os.Getenv("REDIS_HOST")
-	if redisHost == "" {
-		redisHost = "localhost"
+	// Язык ответов API по умолчанию (если клиент не прислал Accept-Language)
+	if err := i18n.SetDefault(cfg.I18n.DefaultLanguage); err != nil {
+		log.Fatal().Err(err).Msg("Invalid default language")
 	}
-	redisPort := os.Getenv("REDIS_PORT")
-	if redisPort == "" {
-		redisPort = "6379"
+
+	// Трассировка: span'ы отправляются в OTLP-коллектор или в stdout.
+	// Оставшиеся span'ы выгружаются при остановке
+	shutdownTracing, err := tracing.Init(context.Background(), tracing.Options{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		SampleRatio: cfg.Tracing.SampleRatio,
+		ServiceName: cfg.Tracing.ServiceName,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to set up tracing")
 	}
-	redisPassword := os.Getenv("REDIS_PASSWORD")
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			log.Error().Err(err).Msg("Failed to flush traces")
+		}
+	}()
 
-	redisCache := cache.NewRedisCache(redisHost, redisPort, redisPassword, 0)
+	// 1. Инициализация кэша. Если Redis недоступен, ответы читаются из хранилища
+	responseStore, cacheHealth := newCache(cfg)
 	defer func() {
-		if err := redisCache.Close(); err != nil {
+		if err := responseStore.Close(); err != nil {
 			log.Error().Err(err).Msg("Error closing Redis connection")
 		}
 	}()
 
-	// 2. Инициализация PostgreSQL
-	dbHost := os.Getenv("DB_HOST")
-	if dbHost == "" {
-		dbHost = "localhost"
+	// 2. Инициализация хранилища (storage.backend: postgres | sqlite | memory)
+	storage, err := app.OpenStorage(context.Background(), cfg)
+	if err != nil {
+		log.Fatal().Err(err).Str("backend", cfg.Storage.Backend).Msg("Failed to open storage")
 	}
-	dbPort := os.Getenv("DB_PORT")
-	if dbPort == "" {
-		dbPort = "5432"
+	defer app.CloseStorage(storage)
+	log.Info().Str("backend", cfg.Storage.Backend).Msg("Storage ready")
+
+	// 3. Инициализация обработчиков
+	bookHandler := handlers.NewBookHandler(storage)
+	responseCache := middleware.NewResponseCache(responseStore, cacheOptions(cfg))
+
+	// 4. Настройка роутера
+	cors := middleware.NewCORS(cfg.CORS.AllowedOrigins)
+	// Квоты хранятся в Redis и общие для всех экземпляров API
+	limitClient := app.NewRedisClient(cfg)
+	defer limitClient.Close()
+	limiter := middleware.NewRateLimiter(rateLimitOptions(cfg), limitClient, cfg.Redis.KeyPrefix+"ratelimit:")
+	verifier, err := newVerifier(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid auth configuration")
 	}
-	dbUser := os.Getenv("DB_USER")
-	if dbUser == "" {
-		dbUser = "postgres"
+	policy, err := app.LoadPolicy(context.Background(), storage, cfg.Auth.PublicReads)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load access policy")
 	}
-	dbPassword := os.Getenv("DB_PASSWORD")
-	if dbPassword == "" {
-		dbPassword = "postgres"
+	// API-ключи доступны, если хранилище умеет их хранить
+	var (
+		apiKeys       *auth.APIKeys
+		apiKeyHandler *handlers.APIKeyHandler
+	)
+	if keyRepo, ok := storage.(repositories.APIKeyRepository); ok {
+		apiKeys = auth.NewAPIKeys(keyRepo)
+		apiKeyHandler = handlers.NewAPIKeyHandler(keyRepo, policy)
+	} else {
+		log.Warn().Str("backend", cfg.Storage.Backend).Msg("Storage backend has no API keys, only bearer tokens are accepted")
 	}
-	dbName := os.Getenv("DB_NAME")
-	if dbName == "" {
-		dbName = "library"
+	// Учётные записи: нужны хранилище пользователей и секрет для подписи токенов
+	var authHandler *handlers.AuthHandler
+	if accounts, users, err := newAccounts(cfg, storage); err != nil {
+		log.Warn().Err(err).Msg("User accounts are disabled")
+	} else {
+		authHandler = handlers.NewAuthHandler(accounts, users, policy)
 	}
-	connStr := fmt.Sprintf(
-		"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		dbHost, dbPort, dbUser, dbPassword, dbName)
-
-	log.Info().Str("connection", connStr).Msg("Connecting to PostgreSQL")
-
-	storage, err := storage.NewPostgres(connStr)
-	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to connect to PostgreSQL")
+	authn := middleware.NewAuthenticator(verifier, apiKeys, cfg.Auth.PublicReads)
+	routerOpts := router.Options{
+		Auth:            authn.Handler,
+		Policy:          policy,
+		APIKeys:         apiKeyHandler,
+		Accounts:        authHandler,
+		RateLimit:       limiter.Route,
+		CredentialLimit: limiter.Failures("auth"),
+		Cache:           responseCache.Route,
+		Health:          map[string]handlers.HealthCheck{"cache": cacheHealth},
+		Tracing:         middleware.Tracing(otel.GetTracerProvider(), otel.GetTextMapPropagator()),
+		Middleware:      []middleware.Middleware{cors.Handler},
 	}
-	log.Info().Msg("Successfully connected to PostgreSQL")
 
-	// 3. Инициализация обработчиков
-	bookHandler := handlers.NewBookHandler(storage, redisCache)
+	// Базовый контекст всех запросов: отменяется при остановке сервера,
+	// чтобы незавершённые запросы к БД не висели после shutdown
+	baseCtx, cancelBase := context.WithCancel(context.Background())
+	defer cancelBase()
 
-	// 4. Настройка роутера
-	mux := router.SetupRouter(bookHandler)
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	// Метрики Prometheus: запросы, кэш, пул соединений и книги
+	if cfg.Metrics.Enabled {
+		m := metrics.New()
+		if db, ok := storage.(metrics.StatsGetter); ok {
+			m.RegisterDB(cfg.Storage.Backend, db)
+		}
+		bookHandler.OnWrite(m.BookWritten)
+		responseCache.SetObserver(m)
+		go m.WatchBooks(baseCtx, storage, cfg.Metrics.BooksInterval.Std())
+		routerOpts.Metrics = m.Handler()
+		routerOpts.MetricsPath = cfg.Metrics.Path
+		routerOpts.Observers = []middleware.RequestObserver{m.ObserveRequest}
 	}
+	mux := router.SetupRouter(bookHandler, routerOpts)
+	port := strconv.Itoa(cfg.Server.Port)
 
 	server := &http.Server{
-		Addr:    ":" + port,
-		Handler: mux,
+		Addr:        ":" + port,
+		Handler:     mux,
+		BaseContext: func(net.Listener) context.Context { return baseCtx },
 	}
 
-	// 5. shutdown
+	// 5. shutdown; SIGHUP перечитывает конфигурацию
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
 
 	go func() {
 		log.Info().Str("port", port).Msg("Server starting")
@@ -110,15 +189,169 @@ func main() {
 		}
 	}()
 
-	<-stop
+	for running := true; running; {
+		select {
+		case <-hup:
+			cfg = reloadConfig(cfg, responseCache, limiter, cors)
+		case <-stop:
+			running = false
+		}
+	}
 	log.Info().Msg("Shutting down server")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout.Std())
 	defer cancel()
 
 	if err := server.Shutdown(ctx); err != nil {
 		log.Error().Err(err).Msg("Server shutdown error")
 	}
+	cancelBase()
 
 	log.Info().Msg("Server stopped gracefully")
 }
+
+// newVerifier собирает проверку JWT из секции auth. Без ключей сервер не
+// стартует: изменяющие запросы иначе было бы невозможно авторизовать.
+func newVerifier(cfg *config.Config) (*auth.Verifier, error) {
+	opts := auth.VerifierOptions{
+		Secret:   []byte(cfg.Auth.JWTSecret),
+		Issuer:   cfg.Auth.Issuer,
+		Audience: cfg.Auth.Audience,
+		Leeway:   cfg.Auth.Leeway.Std(),
+	}
+	switch {
+	case cfg.Auth.JWKSFile != "":
+		opts.Keys = auth.NewKeySetFile(cfg.Auth.JWKSFile)
+	case cfg.Auth.JWKSURL != "":
+		opts.Keys = auth.NewKeySetURL(cfg.Auth.JWKSURL, nil)
+	}
+	if opts.Keys != nil {
+		// Проверяем ключи сразу, а не на первом запросе
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := opts.Keys.Refresh(ctx); err != nil {
+			return nil, err
+		}
+	}
+	verifier, err := auth.NewVerifier(opts)
+	if errors.Is(err, auth.ErrNoVerificationKey) {
+		return nil, fmt.Errorf("set auth.jwt_secret, auth.jwks_file or auth.jwks_url: %w", err)
+	}
+	return verifier, err
+}
+
+// newAccounts собирает регистрацию и вход по паролю. Токены доступа
+// подписываются HS256, поэтому без auth.jwt_secret учётные записи недоступны.
+func newAccounts(cfg *config.Config, storage repositories.BookRepository) (*auth.Accounts, repositories.UserRepository, error) {
+	users, ok := storage.(repositories.UserRepository)
+	tokens, ok2 := storage.(repositories.TokenRepository)
+	if !ok || !ok2 {
+		return nil, nil, fmt.Errorf("the %s backend does not store users", cfg.Storage.Backend)
+	}
+	signer, err := auth.NewSigner([]byte(cfg.Auth.JWTSecret), cfg.Auth.Issuer, cfg.Auth.Audience, cfg.Auth.AccessTokenTTL.Std())
+	if err != nil {
+		return nil, nil, fmt.Errorf("set auth.jwt_secret to issue access tokens: %w", err)
+	}
+	accounts, err := auth.NewAccounts(users, tokens, signer, newMailer(cfg), auth.AccountOptions{
+		RefreshTTL:      cfg.Auth.RefreshTokenTTL.Std(),
+		MaxFailedLogins: cfg.Auth.MaxFailedLogins,
+		LockoutDuration: cfg.Auth.LockoutDuration.Std(),
+		ResetTTL:        cfg.Auth.ResetTokenTTL.Std(),
+		ResetURL:        cfg.Auth.ResetURL,
+	})
+	return accounts, users, err
+}
+
+// newMailer выбирает доставку писем для сброса пароля. Без драйвера
+// (mail.driver: none) сброс пароля отключён.
+func newMailer(cfg *config.Config) mail.Mailer {
+	switch cfg.Mail.Driver {
+	case mail.DriverLog:
+		log.Warn().Msg("Mail is written to the log, including password reset tokens; use only in development")
+		return mail.LogMailer{}
+	case mail.DriverSMTP:
+		return mail.NewSMTPMailer(mail.SMTPOptions{
+			Host:     cfg.Mail.SMTPHost,
+			Port:     cfg.Mail.SMTPPort,
+			Username: cfg.Mail.SMTPUsername,
+			Password: cfg.Mail.SMTPPassword,
+			From:     cfg.Mail.From,
+			Insecure: cfg.Mail.SMTPInsecure,
+		})
+	default:
+		log.Info().Msg("No mail driver configured, password reset is disabled")
+		return nil
+	}
+}
+
+// newCache подключает кэш ответов. Circuit breaker пропускает кэш, пока Redis
+// недоступен, поэтому сервер стартует и работает и без него.
+func newCache(cfg *config.Config) (cache.Cache, handlers.HealthCheck) {
+	if !cfg.Cache.Enabled {
+		log.Warn().Msg("Response cache is disabled, serving everything from storage")
+		return cache.NoopCache{}, func() error { return nil }
+	}
+	breaker := cache.NewBreakerCache(app.NewCache(cfg), cache.BreakerOptions{
+		Failures: cfg.Cache.BreakerFailures,
+		Cooldown: cfg.Cache.BreakerCooldown.Std(),
+	})
+	return breaker, breaker.Health
+}
+
+// cacheOptions задаёт политику кэширования ответов по маршрутам
+func cacheOptions(cfg *config.Config) middleware.ResponseCacheOptions {
+	return middleware.ResponseCacheOptions{
+		Routes: map[string]middleware.CachePolicy{
+			"book": {
+				TTL:          cfg.Cache.BookTTL.Std(),
+				StaleTTL:     cfg.Cache.BookStaleTTL.Std(),
+				EarlyRefresh: cfg.Cache.BookEarlyRefresh,
+			},
+			"books": {
+				TTL:          cfg.Cache.ListTTL.Std(),
+				StaleTTL:     cfg.Cache.ListStaleTTL.Std(),
+				EarlyRefresh: cfg.Cache.ListEarlyRefresh,
+			},
+		},
+		LockWait: cfg.Cache.LockWait.Std(),
+	}
+}
+
+// rateLimitOptions переводит секцию rate_limit в настройки limiter'а.
+// Ошибки разбора уже отсеяны config.Validate.
+func rateLimitOptions(cfg *config.Config) middleware.RateLimitOptions {
+	opts := middleware.RateLimitOptions{
+		Default: middleware.Quota{
+			Reads:  cfg.RateLimit.ReadsPerMinute,
+			Writes: cfg.RateLimit.WritesPerMinute,
+		},
+		Routes: make(map[string]middleware.Quota),
+	}
+	routes, _ := cfg.RateLimit.RouteQuotas()
+	for _, q := range routes {
+		opts.Routes[q.Route] = middleware.Quota{Reads: q.Reads, Writes: q.Writes}
+	}
+	opts.TrustedProxies, _ = cfg.RateLimit.Proxies()
+	return opts
+}
+
+// reloadConfig перечитывает конфигурацию и применяет настройки, которые можно
+// менять на лету. Остальные изменения отклоняются до перезапуска.
+func reloadConfig(cfg *config.Config, responseCache *middleware.ResponseCache, limiter *middleware.RateLimiter, cors *middleware.CORS) *config.Config {
+	next, changes, err := cfg.Reload()
+	if err != nil {
+		log.Error().Err(err).Msg("Config reload failed, keeping the current configuration")
+		return cfg
+	}
+	if len(changes.Rejected) > 0 {
+		log.Warn().Strs("settings", changes.Rejected).Msg("Config changes require a restart, ignoring them")
+	}
+
+	logger.SetLevel(next.Log.Level)
+	responseCache.SetOptions(cacheOptions(next))
+	limiter.SetOptions(rateLimitOptions(next))
+	cors.SetOrigins(next.CORS.AllowedOrigins)
+
+	log.Info().Strs("applied", changes.Applied).Msg("Configuration reloaded")
+	return next
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"libraryapi/internal/api/middleware"
+	"libraryapi/internal/config"
+	"libraryapi/internal/pkg/cache"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// reloadConfig применяет изменённые live-настройки к работающим компонентам,
+// а изменения остальных настроек логирует и игнорирует.
+func TestReloadConfig(t *testing.T) {
+	t.Setenv(config.FileEnv, "")
+	t.Setenv("PORT", "")
+	t.Setenv("LOG_LEVEL", "")
+	t.Setenv("CORS_ALLOWED_ORIGINS", "")
+	var buf bytes.Buffer
+	global, level := log.Logger, zerolog.GlobalLevel()
+	log.Logger = zerolog.New(&buf)
+	t.Cleanup(func() { log.Logger = global; zerolog.SetGlobalLevel(level) })
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("server:\n  port: 9001\nlog:\n  level: warn\ncors:\n  allowed_origins: [https://a.example]\n")
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	cfg, err := config.Load(config.Default(), fs, []string{"-config", path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cors := middleware.NewCORS(cfg.CORS.AllowedOrigins)
+	limiter := middleware.NewRateLimiter(rateLimitOptions(cfg), nil, "")
+	responseCache := middleware.NewResponseCache(cache.NoopCache{}, cacheOptions(cfg))
+
+	write("server:\n  port: 9002\nlog:\n  level: debug\ncors:\n  allowed_origins: [https://b.example]\n")
+	next := reloadConfig(cfg, responseCache, limiter, cors)
+
+	if next.Server.Port != 9001 {
+		t.Errorf("server.port %d after reload, want 9001 until restart", next.Server.Port)
+	}
+	if zerolog.GlobalLevel() != zerolog.DebugLevel {
+		t.Errorf("log level %v after reload, want debug", zerolog.GlobalLevel())
+	}
+	allowed := func(origin string) bool {
+		r := httptest.NewRequest(http.MethodGet, "/api/books", nil)
+		r.Header.Set("Origin", origin)
+		w := httptest.NewRecorder()
+		cors.Handler(http.NotFoundHandler()).ServeHTTP(w, r)
+		return w.Header().Get("Access-Control-Allow-Origin") == origin
+	}
+	if allowed("https://a.example") || !allowed("https://b.example") {
+		t.Error("CORS origins were not replaced")
+	}
+	out := buf.String()
+	if !strings.Contains(out, "Config changes require a restart") || !strings.Contains(out, `"settings":["server.port"]`) {
+		t.Errorf("rejected change not logged:\n%s", out)
+	}
+	if !strings.Contains(out, `"applied":["log.level","cors.allowed_origins"]`) {
+		t.Errorf("applied changes not logged:\n%s", out)
+	}
+
+	// A broken file keeps the running configuration.
+	write("log:\n  level: loud\n")
+	if got := reloadConfig(next, responseCache, limiter, cors); got != next {
+		t.Error("reload of an invalid file replaced the configuration")
+	}
+	if !strings.Contains(buf.String(), "Config reload failed") {
+		t.Errorf("failed reload not logged:\n%s", buf.String())
+	}
+}
@@ -1,10 +1,14 @@
-/*package Storage
+package Storage
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"libraryapi/internal/api/dto"
+	"libraryapi/internal/domain"
 	"libraryapi/internal/domain/models"
 	"libraryapi/internal/domain/repositories"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -12,95 +16,164 @@ import (
 	"github.com/google/uuid"
 )
 
+// Memorystorage keeps books in process memory. It is meant for development,
+// tests and demos: data is lost on restart.
 type Memorystorage struct {
-	mu    sync.Mutex
+	mu    sync.RWMutex
 	books map[string]models.Book
+
+	apiKeys      map[string]models.APIKey
+	apiKeyHashes map[string]string // hash -> key ID
+
+	users          map[string]models.User
+	userEmails     map[string]string // lowercased email -> user ID
+	refreshTokens  map[string]models.RefreshToken
+	refreshHashes  map[string]string // hash -> token ID
+	passwordResets map[string]passwordReset
 }
 
 func NewMemory() repositories.BookRepository {
 	return &Memorystorage{
-		books: make(map[string]models.Book),
+		books:        make(map[string]models.Book),
+		apiKeys:      make(map[string]models.APIKey),
+		apiKeyHashes: make(map[string]string),
+
+		users:          make(map[string]models.User),
+		userEmails:     make(map[string]string),
+		refreshTokens:  make(map[string]models.RefreshToken),
+		refreshHashes:  make(map[string]string),
+		passwordResets: make(map[string]passwordReset),
 	}
 }
-func (m *Memorystorage) Getall(pagi dto.Pagination) ([]models.Book, int, error) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	totalitems := len(m.books)
-	if totalitems == 0 {
-		return []models.Book{}, 0, nil
+
+// ctxErr reports a done ctx the way the SQL backends report the error their
+// driver returns for it: a missed deadline is unavailable, a cancellation is
+// wrapped with the operation.
+func ctxErr(ctx context.Context, entity, op string) error {
+	err := ctx.Err()
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, context.DeadlineExceeded):
+		return domain.NewError(domain.ErrUnavailable, entity, op, err)
 	}
-	allbooks := make([]models.Book, 0, totalitems)
+	return fmt.Errorf("%s: %w", op, err)
+}
+
+// sorted returns the books in the same order as PostgresStorage:
+// newest first, ties broken by ID. Callers must hold the lock.
+func (m *Memorystorage) sorted(keep func(models.Book) bool) []models.Book {
+	books := make([]models.Book, 0, len(m.books))
 	for _, book := range m.books {
-		allbooks = append(allbooks, book)
+		if keep == nil || keep(book) {
+			books = append(books, book)
+		}
 	}
-	pagination := pagi.Offset()
-	if pagination > totalitems {
-		return []models.Book{}, 0, errors.New("pagination out of range")
-	} else if pagination+pagi.Limit > totalitems {
-		return allbooks[pagination:], totalitems, nil
-	} else {
-		return allbooks[pagination : pagination+pagi.Limit], totalitems, nil
+	sort.Slice(books, func(i, j int) bool {
+		if !books[i].Created_at.Equal(books[j].Created_at) {
+			return books[i].Created_at.After(books[j].Created_at)
+		}
+		return books[i].ID < books[j].ID
+	})
+	return books
+}
+
+func (m *Memorystorage) Getall(ctx context.Context, pagi dto.Pagination) ([]models.Book, int, error) {
+	if err := ctxErr(ctx, "book", "list books"); err != nil {
+		return nil, 0, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	allbooks := m.sorted(nil)
+	totalitems := len(allbooks)
+	offset := pagi.Offset()
+	if offset >= totalitems {
+		return []models.Book{}, totalitems, nil
 	}
+	end := offset + pagi.Limit
+	if end > totalitems {
+		end = totalitems
+	}
+	return allbooks[offset:end], totalitems, nil
 }
-func (m *Memorystorage) Create(title string, author string, year int) models.Book {
+
+func (m *Memorystorage) Create(ctx context.Context, title string, author string, year int) (models.Book, error) {
+	if err := ctxErr(ctx, "book", "create book"); err != nil {
+		return models.Book{}, err
+	}
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	now := time.Now()
 	book := models.Book{
 		ID:         uuid.New().String(),
 		Title:      title,
 		Author:     author,
 		Year:       year,
-		Created_at: time.Now(),
+		Created_at: now,
+		UpdatedAt:  now,
 	}
 	m.books[book.ID] = book
-	return book
+	return book, nil
 }
-func (m *Memorystorage) Getbyid(id string) (models.Book, error) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+
+func (m *Memorystorage) Getbyid(ctx context.Context, id string) (models.Book, error) {
+	if err := ctxErr(ctx, "book", "get book"); err != nil {
+		return models.Book{}, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	book, exists := m.books[id]
 	if !exists {
-		return models.Book{}, errors.New("book not found")
+		return models.Book{}, domain.NotFound("book", "get book")
 	}
 	return book, nil
-
 }
-func (m *Memorystorage) Delete(id string) error {
+
+func (m *Memorystorage) Delete(ctx context.Context, id string) error {
+	if err := ctxErr(ctx, "book", "delete book"); err != nil {
+		return err
+	}
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	if _, exists := m.books[id]; !exists {
-		return errors.New("book not found")
+		return domain.NotFound("book", "delete book")
 	}
 
 	delete(m.books, id)
 	return nil
 }
-func (m *Memorystorage) Update(id string, updated models.Book) (models.Book, error) {
+
+func (m *Memorystorage) Update(ctx context.Context, id string, updated models.Book) (models.Book, error) {
+	if err := ctxErr(ctx, "book", "update book"); err != nil {
+		return models.Book{}, err
+	}
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	if _, exists := m.books[id]; !exists {
-		return models.Book{}, errors.New("book not found")
+	existing, exists := m.books[id]
+	if !exists {
+		return models.Book{}, domain.NotFound("book", "update book")
 	}
-	updated.ID = id
-	updated.Created_at = m.books[id].Created_at
-	updated.UpdatedAt = time.Now()
-	m.books[id] = updated
-	return updated, nil
+	existing.Title = updated.Title
+	existing.Author = updated.Author
+	existing.Year = updated.Year
+	existing.UpdatedAt = time.Now()
+	m.books[id] = existing
+	return existing, nil
 }
 
-func (m *Memorystorage) Search(title, author string, year int) ([]models.Book, error) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	var result []models.Book
-	for _, book := range m.books {
-		if (title == "" || containsIgnoreCase(book.Title, title)) &&
-			(author == "" || containsIgnoreCase(book.Author, author)) &&
-			(year == 0 || book.Year == year) {
-			result = append(result, book)
-		}
+func (m *Memorystorage) Search(ctx context.Context, title, author string, year int) ([]models.Book, error) {
+	if err := ctxErr(ctx, "book", "search books"); err != nil {
+		return nil, err
 	}
-	return result, nil
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.sorted(func(book models.Book) bool {
+		return containsIgnoreCase(book.Title, title) &&
+			containsIgnoreCase(book.Author, author) &&
+			(year == 0 || book.Year == year)
+	}), nil
 }
 
 func containsIgnoreCase(s, substr string) bool {
@@ -108,4 +181,4 @@ func containsIgnoreCase(s, substr string) bool {
 		return true
 	}
 	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
-}*/
+}
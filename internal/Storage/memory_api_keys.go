@@ -0,0 +1,110 @@
+package Storage
+
+import (
+	"context"
+	"libraryapi/internal/domain"
+	"libraryapi/internal/domain/models"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// copyAPIKey detaches the scopes and timestamps of k from the stored value.
+func copyAPIKey(k models.APIKey) models.APIKey {
+	k.Scopes = append([]string{}, k.Scopes...)
+	for _, t := range []**time.Time{&k.ExpiresAt, &k.LastUsedAt, &k.RevokedAt} {
+		if *t != nil {
+			v := **t
+			*t = &v
+		}
+	}
+	return k
+}
+
+func (m *Memorystorage) CreateAPIKey(ctx context.Context, key models.APIKey, hash string) (models.APIKey, error) {
+	if err := ctxErr(ctx, "api_key", "create api key"); err != nil {
+		return models.APIKey{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.apiKeyHashes[hash]; ok {
+		return models.APIKey{}, domain.NewError(domain.ErrConflict, "api_key", "create api key", nil)
+	}
+	key.ID = uuid.New().String()
+	key.CreatedAt = time.Now()
+	key = copyAPIKey(key)
+	m.apiKeys[key.ID] = key
+	m.apiKeyHashes[hash] = key.ID
+	return copyAPIKey(key), nil
+}
+
+func (m *Memorystorage) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	if err := ctxErr(ctx, "api_key", "list api keys"); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := make([]models.APIKey, 0, len(m.apiKeys))
+	for _, key := range m.apiKeys {
+		keys = append(keys, copyAPIKey(key))
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.After(keys[j].CreatedAt)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+	return keys, nil
+}
+
+func (m *Memorystorage) APIKeyByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	if err := ctxErr(ctx, "api_key", "get api key"); err != nil {
+		return models.APIKey{}, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	id, ok := m.apiKeyHashes[hash]
+	if !ok {
+		return models.APIKey{}, domain.NotFound("api_key", "get api key")
+	}
+	return copyAPIKey(m.apiKeys[id]), nil
+}
+
+func (m *Memorystorage) RevokeAPIKey(ctx context.Context, id string) error {
+	if err := ctxErr(ctx, "api_key", "revoke api key"); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, ok := m.apiKeys[id]
+	if !ok {
+		return domain.NotFound("api_key", "revoke api key")
+	}
+	if key.RevokedAt == nil {
+		now := time.Now()
+		key.RevokedAt = &now
+		m.apiKeys[id] = key
+	}
+	return nil
+}
+
+func (m *Memorystorage) TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error {
+	if err := ctxErr(ctx, "api_key", "touch api key"); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, ok := m.apiKeys[id]
+	if !ok {
+		return domain.NotFound("api_key", "touch api key")
+	}
+	key.LastUsedAt = &usedAt
+	m.apiKeys[id] = key
+	return nil
+}
@@ -0,0 +1,13 @@
+package Storage
+
+import (
+	"libraryapi/internal/Storage/storagetest"
+	"libraryapi/internal/domain/repositories"
+	"testing"
+)
+
+func TestMemoryConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) repositories.BookRepository {
+		return NewMemory()
+	})
+}
@@ -0,0 +1,264 @@
+package Storage
+
+import (
+	"context"
+	"libraryapi/internal/domain"
+	"libraryapi/internal/domain/models"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type passwordReset struct {
+	userID    string
+	expiresAt time.Time
+	used      bool
+}
+
+// copyUser detaches the roles and lockout time of u from the stored value.
+func copyUser(u models.User) models.User {
+	u.Roles = append([]string{}, u.Roles...)
+	if u.LockedUntil != nil {
+		t := *u.LockedUntil
+		u.LockedUntil = &t
+	}
+	return u
+}
+
+func (m *Memorystorage) CreateUser(ctx context.Context, user models.User) (models.User, error) {
+	if err := ctxErr(ctx, "user", "create user"); err != nil {
+		return models.User{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	email := strings.ToLower(user.Email)
+	if _, ok := m.userEmails[email]; ok {
+		return models.User{}, domain.NewError(domain.ErrConflict, "user", "create user", nil)
+	}
+	user.ID = uuid.New().String()
+	user.CreatedAt = time.Now()
+	user = copyUser(user)
+	m.users[user.ID] = user
+	m.userEmails[email] = user.ID
+	return copyUser(user), nil
+}
+
+func (m *Memorystorage) UserByID(ctx context.Context, id string) (models.User, error) {
+	if err := ctxErr(ctx, "user", "get user"); err != nil {
+		return models.User{}, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return models.User{}, domain.NotFound("user", "get user")
+	}
+	return copyUser(user), nil
+}
+
+func (m *Memorystorage) UserByEmail(ctx context.Context, email string) (models.User, error) {
+	if err := ctxErr(ctx, "user", "get user"); err != nil {
+		return models.User{}, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	id, ok := m.userEmails[strings.ToLower(email)]
+	if !ok {
+		return models.User{}, domain.NotFound("user", "get user")
+	}
+	return copyUser(m.users[id]), nil
+}
+
+func (m *Memorystorage) ListUsers(ctx context.Context) ([]models.User, error) {
+	if err := ctxErr(ctx, "user", "list users"); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	users := make([]models.User, 0, len(m.users))
+	for _, user := range m.users {
+		users = append(users, copyUser(user))
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Email < users[j].Email })
+	return users, nil
+}
+
+// updateUser applies change to the stored user id. Callers must not hold the
+// lock.
+func (m *Memorystorage) updateUser(ctx context.Context, id, op string, change func(*models.User)) (models.User, error) {
+	if err := ctxErr(ctx, "user", op); err != nil {
+		return models.User{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return models.User{}, domain.NotFound("user", op)
+	}
+	change(&user)
+	user.UpdatedAt = time.Now()
+	user = copyUser(user)
+	m.users[id] = user
+	return copyUser(user), nil
+}
+
+func (m *Memorystorage) SetUserRoles(ctx context.Context, id string, roles []string) (models.User, error) {
+	return m.updateUser(ctx, id, "set user roles", func(u *models.User) { u.Roles = roles })
+}
+
+func (m *Memorystorage) SetPassword(ctx context.Context, id string, hash string) error {
+	_, err := m.updateUser(ctx, id, "set password", func(u *models.User) { u.PasswordHash = hash })
+	return err
+}
+
+func (m *Memorystorage) SetLoginState(ctx context.Context, id string, failedLogins int, lockedUntil *time.Time) error {
+	_, err := m.updateUser(ctx, id, "set login state", func(u *models.User) {
+		u.FailedLogins = failedLogins
+		u.LockedUntil = lockedUntil
+	})
+	return err
+}
+
+func (m *Memorystorage) RecordFailedLogin(ctx context.Context, id string, max int, lockedUntil time.Time) (bool, error) {
+	locked := false
+	_, err := m.updateUser(ctx, id, "record failed login", func(u *models.User) {
+		u.FailedLogins++
+		if u.FailedLogins >= max {
+			u.FailedLogins, u.LockedUntil, locked = 0, &lockedUntil, true
+		}
+	})
+	return locked, err
+}
+
+func (m *Memorystorage) CreateRefreshToken(ctx context.Context, token models.RefreshToken, hash string) error {
+	if err := ctxErr(ctx, "refresh_token", "create refresh token"); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.addRefreshToken(token, hash)
+}
+
+// addRefreshToken stores token. Callers must hold the lock.
+func (m *Memorystorage) addRefreshToken(token models.RefreshToken, hash string) error {
+	if _, ok := m.refreshHashes[hash]; ok {
+		return domain.NewError(domain.ErrConflict, "refresh_token", "create refresh token", nil)
+	}
+	token.CreatedAt = time.Now()
+	token.RevokedAt = nil
+	m.refreshTokens[token.ID] = token
+	m.refreshHashes[hash] = token.ID
+	return nil
+}
+
+func (m *Memorystorage) RefreshTokenByHash(ctx context.Context, hash string) (models.RefreshToken, error) {
+	if err := ctxErr(ctx, "refresh_token", "get refresh token"); err != nil {
+		return models.RefreshToken{}, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	id, ok := m.refreshHashes[hash]
+	if !ok {
+		return models.RefreshToken{}, domain.NotFound("refresh_token", "get refresh token")
+	}
+	token := m.refreshTokens[id]
+	if token.RevokedAt != nil {
+		t := *token.RevokedAt
+		token.RevokedAt = &t
+	}
+	return token, nil
+}
+
+func (m *Memorystorage) RotateRefreshToken(ctx context.Context, id string, next models.RefreshToken, nextHash string) error {
+	if err := ctxErr(ctx, "refresh_token", "rotate refresh token"); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, ok := m.refreshTokens[id]
+	if !ok {
+		return domain.NotFound("refresh_token", "rotate refresh token")
+	}
+	if token.RevokedAt != nil {
+		return domain.NewError(domain.ErrConflict, "refresh_token", "rotate refresh token", nil)
+	}
+	if err := m.addRefreshToken(next, nextHash); err != nil {
+		return err
+	}
+	now := time.Now()
+	token.RevokedAt = &now
+	token.ReplacedBy = next.ID
+	m.refreshTokens[id] = token
+	return nil
+}
+
+// revokeRefreshTokens revokes the live tokens that match. Callers must hold
+// the lock.
+func (m *Memorystorage) revokeRefreshTokens(match func(models.RefreshToken) bool) {
+	now := time.Now()
+	for id, token := range m.refreshTokens {
+		if token.RevokedAt == nil && match(token) {
+			token.RevokedAt = &now
+			m.refreshTokens[id] = token
+		}
+	}
+}
+
+func (m *Memorystorage) RevokeRefreshFamily(ctx context.Context, familyID string) error {
+	if err := ctxErr(ctx, "refresh_token", "revoke session"); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.revokeRefreshTokens(func(t models.RefreshToken) bool { return t.FamilyID == familyID })
+	return nil
+}
+
+func (m *Memorystorage) RevokeUserRefreshTokens(ctx context.Context, userID string) error {
+	if err := ctxErr(ctx, "refresh_token", "revoke user sessions"); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.revokeRefreshTokens(func(t models.RefreshToken) bool { return t.UserID == userID })
+	return nil
+}
+
+func (m *Memorystorage) CreatePasswordReset(ctx context.Context, userID, hash string, expiresAt time.Time) error {
+	if err := ctxErr(ctx, "password_reset", "create password reset"); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[userID]; !ok {
+		return domain.NotFound("user", "create password reset")
+	}
+	m.passwordResets[hash] = passwordReset{userID: userID, expiresAt: expiresAt}
+	return nil
+}
+
+func (m *Memorystorage) ConsumePasswordReset(ctx context.Context, hash string, now time.Time) (string, error) {
+	if err := ctxErr(ctx, "password_reset", "consume password reset"); err != nil {
+		return "", err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	reset, ok := m.passwordResets[hash]
+	if !ok || reset.used || !now.Before(reset.expiresAt) {
+		return "", domain.NotFound("password_reset", "consume password reset")
+	}
+	reset.used = true
+	m.passwordResets[hash] = reset
+	return reset.userID, nil
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"libraryapi/internal/domain"
+	"libraryapi/internal/domain/models"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const apiKeyColumns = "id, name, prefix, scopes, created_by, created_at, expires_at, last_used_at, revoked_at"
+
+func scanAPIKey(row interface{ Scan(...interface{}) error }) (models.APIKey, error) {
+	var (
+		key                          models.APIKey
+		expiresAt, lastUsed, revoked sql.NullTime
+	)
+	err := row.Scan(&key.ID, &key.Name, &key.Prefix, pq.Array(&key.Scopes), &key.CreatedBy,
+		&key.CreatedAt, &expiresAt, &lastUsed, &revoked)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	key.ExpiresAt = timePtr(expiresAt)
+	key.LastUsedAt = timePtr(lastUsed)
+	key.RevokedAt = timePtr(revoked)
+	return key, nil
+}
+
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// CreateAPIKey сохраняет ключ; в базе хранится только хеш
+func (p *PostgresStorage) CreateAPIKey(ctx context.Context, key models.APIKey, hash string) (models.APIKey, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	key.ID = uuid.New().String()
+	if key.Scopes == nil {
+		key.Scopes = []string{}
+	}
+	created, err := scanAPIKey(p.db.QueryRowContext(ctx,
+		`INSERT INTO api_keys (id, name, prefix, key_hash, scopes, created_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+apiKeyColumns,
+		key.ID, key.Name, key.Prefix, hash, pq.Array(key.Scopes), key.CreatedBy, key.ExpiresAt))
+	if err != nil {
+		return models.APIKey{}, wrapEntityErr("api_key", "create api key", err)
+	}
+	return created, nil
+}
+
+// ListAPIKeys возвращает все ключи, новые первыми
+func (p *PostgresStorage) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := p.db.QueryContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys ORDER BY created_at DESC, id")
+	if err != nil {
+		return nil, wrapEntityErr("api_key", "list api keys", err)
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, wrapEntityErr("api_key", "list api keys", err)
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapEntityErr("api_key", "list api keys", err)
+	}
+	return keys, nil
+}
+
+// APIKeyByHash ищет ключ по хешу
+func (p *PostgresStorage) APIKeyByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	key, err := scanAPIKey(p.db.QueryRowContext(ctx,
+		"SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash = $1", hash))
+	if err != nil {
+		return models.APIKey{}, wrapEntityErr("api_key", "get api key", err)
+	}
+	return key, nil
+}
+
+// RevokeAPIKey отзывает ключ; повторный отзыв ничего не меняет
+func (p *PostgresStorage) RevokeAPIKey(ctx context.Context, id string) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	result, err := p.db.ExecContext(ctx,
+		"UPDATE api_keys SET revoked_at = COALESCE(revoked_at, CURRENT_TIMESTAMP) WHERE id = $1", id)
+	if err != nil {
+		return wrapEntityErr("api_key", "revoke api key", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return wrapEntityErr("api_key", "revoke api key", err)
+	}
+	if rowsAffected == 0 {
+		return domain.NotFound("api_key", "revoke api key")
+	}
+	return nil
+}
+
+// TouchAPIKey запоминает время последнего использования ключа
+func (p *PostgresStorage) TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := p.db.ExecContext(ctx, "UPDATE api_keys SET last_used_at = $1 WHERE id = $2", usedAt, id); err != nil {
+		return wrapEntityErr("api_key", "touch api key", err)
+	}
+	return nil
+}
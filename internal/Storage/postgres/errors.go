@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"libraryapi/internal/domain"
+	"net"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// wrapErr classifies a database/sql or lib/pq error into a domain error kind.
+// Errors that fit no kind are wrapped as-is and end up as 500s.
+func wrapErr(op string, err error) error {
+	return wrapEntityErr("book", op, err)
+}
+
+// wrapEntityErr is wrapErr for queries on tables other than books.
+func wrapEntityErr(entity, op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if kind := classify(err); kind != nil {
+		return domain.NewError(kind, entity, op, err)
+	}
+	return fmt.Errorf("%s: %w", op, err)
+}
+
+func classify(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.ErrNotFound
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		code := string(pqErr.Code)
+		switch {
+		case pqErr.Code.Name() == "unique_violation":
+			return domain.ErrConflict
+		case strings.HasPrefix(code, "22"), // data exception
+			pqErr.Code.Name() == "not_null_violation",
+			pqErr.Code.Name() == "foreign_key_violation",
+			pqErr.Code.Name() == "check_violation":
+			return domain.ErrValidation
+		case strings.HasPrefix(code, "08"), // connection exception
+			strings.HasPrefix(code, "53"),         // insufficient resources
+			strings.HasPrefix(code, "57P"),        // shutdown / cannot connect now
+			pqErr.Code.Name() == "query_canceled": // statement timeout or cancelled context
+			return domain.ErrUnavailable
+		}
+		return nil
+	}
+
+	var netErr net.Error
+	if errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.As(err, &netErr) {
+		return domain.ErrUnavailable
+	}
+	return nil
+}
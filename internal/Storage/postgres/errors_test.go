@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"libraryapi/internal/domain"
+	"net"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"нет строк", sql.ErrNoRows, domain.ErrNotFound},
+		{"unique_violation", &pq.Error{Code: "23505"}, domain.ErrConflict},
+		{"foreign_key_violation", &pq.Error{Code: "23503"}, domain.ErrValidation},
+		{"check_violation", &pq.Error{Code: "23514"}, domain.ErrValidation},
+		{"not_null_violation", &pq.Error{Code: "23502"}, domain.ErrValidation},
+		{"invalid_text_representation", &pq.Error{Code: "22P02"}, domain.ErrValidation},
+		{"connection_failure", &pq.Error{Code: "08006"}, domain.ErrUnavailable},
+		{"too_many_connections", &pq.Error{Code: "53300"}, domain.ErrUnavailable},
+		{"admin_shutdown", &pq.Error{Code: "57P01"}, domain.ErrUnavailable},
+		{"query_canceled", &pq.Error{Code: "57014"}, domain.ErrUnavailable},
+		{"undefined_table", &pq.Error{Code: "42P01"}, nil},
+		{"обёрнутая ошибка pq", fmt.Errorf("insert: %w", &pq.Error{Code: "23505"}), domain.ErrConflict},
+		{"разорванное соединение", driver.ErrBadConn, domain.ErrUnavailable},
+		{"закрытое соединение", sql.ErrConnDone, domain.ErrUnavailable},
+		{"оборванный ответ", io.ErrUnexpectedEOF, domain.ErrUnavailable},
+		{"таймаут контекста", context.DeadlineExceeded, domain.ErrUnavailable},
+		{"сетевая ошибка", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, domain.ErrUnavailable},
+		{"прочее", errors.New("boom"), nil},
+	}
+	for _, tt := range tests {
+		if got := classify(tt.err); got != tt.want {
+			t.Errorf("%s: classify = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWrapEntityErr(t *testing.T) {
+	err := wrapEntityErr("user", "create user", &pq.Error{Code: "23505"})
+	var pqErr *pq.Error
+	if !errors.Is(err, domain.ErrConflict) || domain.EntityOf(err) != "user" || !errors.As(err, &pqErr) {
+		t.Errorf("wrapEntityErr = %v: want a user conflict that still unwraps to *pq.Error", err)
+	}
+	if err := wrapErr("list books", errors.New("boom")); domain.Kind(err) != nil || err.Error() != "list books: boom" {
+		t.Errorf("wrapErr of an unclassified error = %v", err)
+	}
+	if wrapErr("get book", nil) != nil {
+		t.Error("wrapErr(nil) != nil")
+	}
+}
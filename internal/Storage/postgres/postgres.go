@@ -1,48 +1,85 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
-	"errors"
 	"fmt"
 	"libraryapi/internal/api/dto"
+	"libraryapi/internal/domain"
 	"libraryapi/internal/domain/models"
 	"libraryapi/internal/domain/repositories"
 	"time"
 
+	"github.com/XSAM/otelsql"
 	"github.com/google/uuid"
 	_ "github.com/lib/pq" // Драйвер PostgreSQL
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
 )
 
 type PostgresStorage struct {
-	db *sql.DB
+	db           *sql.DB
+	queryTimeout time.Duration
 }
 
-func NewPostgres(connectionString string) (repositories.BookRepository, error) {
-	db, err := sql.Open("postgres", connectionString)
+// Options задаёт таймаут запросов и настройки пула соединений
+type Options struct {
+	// QueryTimeout ограничивает каждый запрос сверх дедлайна контекста
+	// вызывающего (0 — без ограничения)
+	QueryTimeout    time.Duration
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// NewPostgres подключается к базе. Каждый запрос, в том числе внутри
+// транзакций, пишется в трейс отдельным span'ом с текстом запроса
+func NewPostgres(connectionString string, opts Options) (repositories.BookRepository, error) {
+	db, err := otelsql.Open("postgres", connectionString,
+		otelsql.WithAttributes(semconv.DBSystemNamePostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			// Только запросы: без span'ов на чтение строк и служебные
+			// операции пула
+			OmitRows:             true,
+			OmitConnResetSession: true,
+			OmitConnPrepare:      true,
+		}))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
 	// Проверяем подключение
-	if err := db.Ping(); err != nil {
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		return nil, domain.NewError(domain.ErrUnavailable, "", "ping database", err)
 	}
 
 	// Устанавливаем настройки пула соединений
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(5)
-	db.SetConnMaxLifetime(5 * time.Minute)
+	db.SetMaxOpenConns(opts.MaxOpenConns)
+	db.SetMaxIdleConns(opts.MaxIdleConns)
+	db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+
+	return &PostgresStorage{db: db, queryTimeout: opts.QueryTimeout}, nil
+}
 
-	return &PostgresStorage{db: db}, nil
+// withTimeout накладывает таймаут запроса на контекст запроса
+func (p *PostgresStorage) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if p.queryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, p.queryTimeout)
 }
 
 // GetAll получает книги с пагинацией
-func (p *PostgresStorage) Getall(pagination dto.Pagination) ([]models.Book, int, error) {
+func (p *PostgresStorage) Getall(ctx context.Context, pagination dto.Pagination) ([]models.Book, int, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
 	// 1. Получаем общее количество книг
 	var totalItems int
-	err := p.db.QueryRow("SELECT COUNT(*) FROM books").Scan(&totalItems)
+	err := p.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM books").Scan(&totalItems)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to count books: %w", err)
+		return nil, 0, wrapErr("count books", err)
 	}
 
 	// 2. Если нет книг - возвращаем пустой список
@@ -55,13 +92,13 @@ func (p *PostgresStorage) Getall(pagination dto.Pagination) ([]models.Book, int,
 	query := `
 		SELECT id, title, author, year, created_at, updated_at 
 		FROM books 
-		ORDER BY created_at DESC 
+		ORDER BY created_at DESC, id
 		LIMIT $1 OFFSET $2
 	`
 
-	rows, err := p.db.Query(query, pagination.Limit, offset)
+	rows, err := p.db.QueryContext(ctx, query, pagination.Limit, offset)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to query books: %w", err)
+		return nil, 0, wrapErr("query books", err)
 	}
 	defer rows.Close()
 
@@ -78,20 +115,23 @@ func (p *PostgresStorage) Getall(pagination dto.Pagination) ([]models.Book, int,
 			&book.UpdatedAt,
 		)
 		if err != nil {
-			return nil, 0, fmt.Errorf("failed to scan book: %w", err)
+			return nil, 0, wrapErr("scan book", err)
 		}
 		books = append(books, book)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, 0, fmt.Errorf("rows error: %w", err)
+		return nil, 0, wrapErr("list books", err)
 	}
 
 	return books, totalItems, nil
 }
 
 // Getbyid получает книгу по ID
-func (p *PostgresStorage) Getbyid(id string) (models.Book, error) {
+func (p *PostgresStorage) Getbyid(ctx context.Context, id string) (models.Book, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
 	query := `
 		SELECT id, title, author, year, created_at, updated_at 
 		FROM books 
@@ -99,7 +139,7 @@ func (p *PostgresStorage) Getbyid(id string) (models.Book, error) {
 	`
 
 	var book models.Book
-	err := p.db.QueryRow(query, id).Scan(
+	err := p.db.QueryRowContext(ctx, query, id).Scan(
 		&book.ID,
 		&book.Title,
 		&book.Author,
@@ -109,17 +149,17 @@ func (p *PostgresStorage) Getbyid(id string) (models.Book, error) {
 	)
 
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return models.Book{}, errors.New("book not found")
-		}
-		return models.Book{}, fmt.Errorf("failed to get book: %w", err)
+		return models.Book{}, wrapErr("get book", err)
 	}
 
 	return book, nil
 }
 
 // Create создает новую книгу
-func (p *PostgresStorage) Create(title string, author string, year int) models.Book {
+func (p *PostgresStorage) Create(ctx context.Context, title string, author string, year int) (models.Book, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
 	query := `
 		INSERT INTO books (id, title, author, year, created_at)
 		VALUES ($1, $2, $3, $4, $5)
@@ -129,7 +169,7 @@ func (p *PostgresStorage) Create(title string, author string, year int) models.B
 	var book models.Book
 	id := uuid.New().String()
 
-	err := p.db.QueryRow(query, id, title, author, year, time.Now()).Scan(
+	err := p.db.QueryRowContext(ctx, query, id, title, author, year, time.Now()).Scan(
 		&book.ID,
 		&book.Title,
 		&book.Author,
@@ -139,22 +179,17 @@ func (p *PostgresStorage) Create(title string, author string, year int) models.B
 	)
 
 	if err != nil {
-		// В случае ошибки, возвращаем книгу с сгенерированным ID
-		// В реальном проекте нужно обрабатывать ошибку
-		return models.Book{
-			ID:         id,
-			Title:      title,
-			Author:     author,
-			Year:       year,
-			Created_at: time.Now(),
-		}
+		return models.Book{}, wrapErr("create book", err)
 	}
 
-	return book
+	return book, nil
 }
 
 // Update обновляет книгу
-func (p *PostgresStorage) Update(id string, updated models.Book) (models.Book, error) {
+func (p *PostgresStorage) Update(ctx context.Context, id string, updated models.Book) (models.Book, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
 	query := `
 		UPDATE books 
 		SET title = $1, author = $2, year = $3, updated_at = $4
@@ -163,7 +198,8 @@ func (p *PostgresStorage) Update(id string, updated models.Book) (models.Book, e
 	`
 
 	var book models.Book
-	err := p.db.QueryRow(
+	err := p.db.QueryRowContext(
+		ctx,
 		query,
 		updated.Title,
 		updated.Author,
@@ -180,49 +216,52 @@ func (p *PostgresStorage) Update(id string, updated models.Book) (models.Book, e
 	)
 
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return models.Book{}, errors.New("book not found")
-		}
-		return models.Book{}, fmt.Errorf("failed to update book: %w", err)
+		return models.Book{}, wrapErr("update book", err)
 	}
 
 	return book, nil
 }
 
 // Delete удаляет книгу
-func (p *PostgresStorage) Delete(id string) error {
+func (p *PostgresStorage) Delete(ctx context.Context, id string) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
 	query := "DELETE FROM books WHERE id = $1"
-	result, err := p.db.Exec(query, id)
+	result, err := p.db.ExecContext(ctx, query, id)
 	if err != nil {
-		return fmt.Errorf("failed to delete book: %w", err)
+		return wrapErr("delete book", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+		return wrapErr("delete book", err)
 	}
 
 	if rowsAffected == 0 {
-		return errors.New("book not found")
+		return domain.NotFound("book", "delete book")
 	}
 
 	return nil
 }
 
 // Search ищет книги по фильтрам
-func (p *PostgresStorage) Search(title, author string, year int) ([]models.Book, error) {
+func (p *PostgresStorage) Search(ctx context.Context, title, author string, year int) ([]models.Book, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
 	query := `
 		SELECT id, title, author, year, created_at, updated_at 
 		FROM books 
 		WHERE ($1 = '' OR title ILIKE '%' || $1 || '%')
 			AND ($2 = '' OR author ILIKE '%' || $2 || '%')
 			AND ($3 = 0 OR year = $3)
-		ORDER BY created_at DESC
+		ORDER BY created_at DESC, id
 	`
 
-	rows, err := p.db.Query(query, title, author, year)
+	rows, err := p.db.QueryContext(ctx, query, title, author, year)
 	if err != nil {
-		return nil, fmt.Errorf("failed to search books: %w", err)
+		return nil, wrapErr("search books", err)
 	}
 	defer rows.Close()
 
@@ -238,14 +277,32 @@ func (p *PostgresStorage) Search(title, author string, year int) ([]models.Book,
 			&book.UpdatedAt,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan book: %w", err)
+			return nil, wrapErr("scan book", err)
 		}
 		books = append(books, book)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("rows error: %w", err)
+		return nil, wrapErr("search books", err)
 	}
 
 	return books, nil
 }
+
+// Close закрывает пул соединений
+func (p *PostgresStorage) Close() error {
+	return p.db.Close()
+}
+
+// Stats возвращает статистику пула соединений для метрик
+func (p *PostgresStorage) Stats() sql.DBStats {
+	return p.db.Stats()
+}
+
+// Reindex перестраивает индексы таблицы books
+func (p *PostgresStorage) Reindex(ctx context.Context) error {
+	if _, err := p.db.ExecContext(ctx, "REINDEX TABLE books"); err != nil {
+		return wrapErr("reindex books", err)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"libraryapi/internal/Storage/storagetest"
+	"libraryapi/internal/domain"
+	"libraryapi/internal/domain/models"
+	"libraryapi/internal/domain/repositories"
+	"libraryapi/internal/pkg/migrate"
+	"libraryapi/migrations"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Тесты запускаются только при заданной TEST_POSTGRES_DSN, например:
+// TEST_POSTGRES_DSN="host=localhost user=postgres password=postgres dbname=library_test sslmode=disable"
+// Миграции применяются к этой базе, таблица books очищается перед каждым тестом.
+func TestPostgresConformance(t *testing.T) {
+	dsn := migratedDSN(t)
+	storagetest.Run(t, func(t *testing.T) repositories.BookRepository {
+		pg := openTest(t, dsn)
+		if _, err := pg.db.ExecContext(context.Background(), "TRUNCATE books"); err != nil {
+			t.Fatalf("truncate books: %v", err)
+		}
+		return pg
+	})
+}
+
+// migratedDSN возвращает TEST_POSTGRES_DSN после применения миграций
+func migratedDSN(t *testing.T) string {
+	t.Helper()
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	migrator, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	return dsn
+}
+
+func openTest(t *testing.T, dsn string) *PostgresStorage {
+	t.Helper()
+	repo, err := NewPostgres(dsn, Options{QueryTimeout: 5 * time.Second, MaxOpenConns: 5})
+	if err != nil {
+		t.Fatalf("NewPostgres: %v", err)
+	}
+	pg := repo.(*PostgresStorage)
+	t.Cleanup(func() { pg.db.Close() })
+	return pg
+}
+
+// Параллельные неудачные входы не должны терять инкременты: из 20 попыток
+// при пороге 5 ровно четыре блокируют учётную запись.
+func TestPostgresRecordFailedLogin(t *testing.T) {
+	pg := openTest(t, migratedDSN(t))
+	ctx := context.Background()
+	user, err := pg.CreateUser(ctx, models.User{
+		Email:        fmt.Sprintf("lockout-%d@example.com", time.Now().UnixNano()),
+		PasswordHash: "x",
+		Roles:        []string{"patron"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pg.db.Exec("DELETE FROM users WHERE id = $1", user.ID) })
+
+	var locks atomic.Int32
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Go(func() {
+			locked, err := pg.RecordFailedLogin(ctx, user.ID, 5, time.Now().Add(time.Minute))
+			if err != nil {
+				t.Error(err)
+			}
+			if locked {
+				locks.Add(1)
+			}
+		})
+	}
+	wg.Wait()
+	if got := locks.Load(); got != 4 {
+		t.Errorf("%d of 20 failures locked the account, want 4", got)
+	}
+	if _, err := pg.RecordFailedLogin(ctx, "00000000-0000-0000-0000-000000000000", 5, time.Now()); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("RecordFailedLogin(unknown user) = %v, want ErrNotFound", err)
+	}
+}
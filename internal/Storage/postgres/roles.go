@@ -0,0 +1,40 @@
+package storage
+
+import "context"
+
+// RolePermissions читает таблицу ролей с их правами
+func (p *PostgresStorage) RolePermissions(ctx context.Context) (map[string][]string, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT r.name, rp.permission
+		FROM roles r
+		LEFT JOIN role_permissions rp ON rp.role = r.name
+		ORDER BY r.name, rp.permission`)
+	if err != nil {
+		return nil, wrapEntityErr("role", "list roles", err)
+	}
+	defer rows.Close()
+
+	roles := make(map[string][]string)
+	for rows.Next() {
+		var (
+			role       string
+			permission *string
+		)
+		if err := rows.Scan(&role, &permission); err != nil {
+			return nil, wrapEntityErr("role", "list roles", err)
+		}
+		if _, ok := roles[role]; !ok {
+			roles[role] = []string{}
+		}
+		if permission != nil {
+			roles[role] = append(roles[role], *permission)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapEntityErr("role", "list roles", err)
+	}
+	return roles, nil
+}
@@ -0,0 +1,313 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"libraryapi/internal/domain"
+	"libraryapi/internal/domain/models"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Роли пользователя собираются из user_roles одним запросом
+const userSelect = `
+	SELECT u.id, u.email, u.password_hash, u.failed_logins, u.locked_until, u.created_at, u.updated_at,
+		COALESCE(ARRAY(SELECT ur.role FROM user_roles ur WHERE ur.user_id = u.id ORDER BY ur.role), '{}')
+	FROM users u`
+
+func scanUser(row interface{ Scan(...interface{}) error }) (models.User, error) {
+	var (
+		user                 models.User
+		lockedUntil, updated sql.NullTime
+	)
+	err := row.Scan(&user.ID, &user.Email, &user.PasswordHash, &user.FailedLogins, &lockedUntil,
+		&user.CreatedAt, &updated, pq.Array(&user.Roles))
+	if err != nil {
+		return models.User{}, err
+	}
+	user.LockedUntil = timePtr(lockedUntil)
+	if updated.Valid {
+		user.UpdatedAt = updated.Time
+	}
+	return user, nil
+}
+
+// inTx выполняет fn в транзакции и откатывает её при ошибке
+func (p *PostgresStorage) inTx(ctx context.Context, fn func(*sql.Tx) error) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertRoles(ctx context.Context, tx *sql.Tx, userID string, roles []string) error {
+	for _, role := range roles {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO user_roles (user_id, role) VALUES ($1, $2)", userID, role); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateUser создаёт пользователя вместе с его ролями
+func (p *PostgresStorage) CreateUser(ctx context.Context, user models.User) (models.User, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	user.ID = uuid.New().String()
+	err := p.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO users (id, email, password_hash) VALUES ($1, $2, $3)",
+			user.ID, user.Email, user.PasswordHash); err != nil {
+			return err
+		}
+		return insertRoles(ctx, tx, user.ID, user.Roles)
+	})
+	if err != nil {
+		return models.User{}, wrapEntityErr("user", "create user", err)
+	}
+	return p.UserByID(ctx, user.ID)
+}
+
+// UserByID ищет пользователя по ID
+func (p *PostgresStorage) UserByID(ctx context.Context, id string) (models.User, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	user, err := scanUser(p.db.QueryRowContext(ctx, userSelect+" WHERE u.id = $1", id))
+	if err != nil {
+		return models.User{}, wrapEntityErr("user", "get user", err)
+	}
+	return user, nil
+}
+
+// UserByEmail ищет пользователя по email без учёта регистра
+func (p *PostgresStorage) UserByEmail(ctx context.Context, email string) (models.User, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	user, err := scanUser(p.db.QueryRowContext(ctx, userSelect+" WHERE LOWER(u.email) = LOWER($1)", email))
+	if err != nil {
+		return models.User{}, wrapEntityErr("user", "get user", err)
+	}
+	return user, nil
+}
+
+// ListUsers возвращает всех пользователей по email
+func (p *PostgresStorage) ListUsers(ctx context.Context) ([]models.User, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := p.db.QueryContext(ctx, userSelect+" ORDER BY u.email")
+	if err != nil {
+		return nil, wrapEntityErr("user", "list users", err)
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, wrapEntityErr("user", "list users", err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapEntityErr("user", "list users", err)
+	}
+	return users, nil
+}
+
+// updateUser выполняет UPDATE users и сообщает NotFound, если строки нет
+func updateUser(ctx context.Context, exec interface {
+	ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
+}, op, query string, args ...interface{}) error {
+	result, err := exec.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return domain.NotFound("user", op)
+	}
+	return nil
+}
+
+// SetUserRoles заменяет роли пользователя
+func (p *PostgresStorage) SetUserRoles(ctx context.Context, id string, roles []string) (models.User, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	err := p.inTx(ctx, func(tx *sql.Tx) error {
+		if err := updateUser(ctx, tx, "set user roles",
+			"UPDATE users SET updated_at = CURRENT_TIMESTAMP WHERE id = $1", id); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM user_roles WHERE user_id = $1", id); err != nil {
+			return err
+		}
+		return insertRoles(ctx, tx, id, roles)
+	})
+	if err != nil {
+		return models.User{}, wrapEntityErr("user", "set user roles", err)
+	}
+	return p.UserByID(ctx, id)
+}
+
+// SetPassword сохраняет новый хеш пароля
+func (p *PostgresStorage) SetPassword(ctx context.Context, id string, hash string) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	err := updateUser(ctx, p.db, "set password",
+		"UPDATE users SET password_hash = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2", hash, id)
+	return wrapEntityErr("user", "set password", err)
+}
+
+// SetLoginState сохраняет счётчик неудачных входов и блокировку
+func (p *PostgresStorage) SetLoginState(ctx context.Context, id string, failedLogins int, lockedUntil *time.Time) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	err := updateUser(ctx, p.db, "set login state",
+		"UPDATE users SET failed_logins = $1, locked_until = $2 WHERE id = $3", failedLogins, lockedUntil, id)
+	return wrapEntityErr("user", "set login state", err)
+}
+
+// RecordFailedLogin увеличивает счётчик неудачных входов одним запросом,
+// без чтения перед записью. Счётчик обнуляется при блокировке, поэтому
+// нулевое значение после обновления означает, что учётная запись заблокирована
+func (p *PostgresStorage) RecordFailedLogin(ctx context.Context, id string, max int, lockedUntil time.Time) (bool, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	var locked bool
+	err := p.db.QueryRowContext(ctx,
+		`UPDATE users SET
+			failed_logins = CASE WHEN failed_logins + 1 >= $2 THEN 0 ELSE failed_logins + 1 END,
+			locked_until = CASE WHEN failed_logins + 1 >= $2 THEN $3 ELSE locked_until END
+		WHERE id = $1
+		RETURNING failed_logins = 0`,
+		id, max, lockedUntil).Scan(&locked)
+	return locked, wrapEntityErr("user", "record failed login", err)
+}
+
+// CreateRefreshToken сохраняет refresh-токен; в базе хранится только хеш
+func (p *PostgresStorage) CreateRefreshToken(ctx context.Context, token models.RefreshToken, hash string) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	_, err := p.db.ExecContext(ctx,
+		`INSERT INTO refresh_tokens (id, user_id, family_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4, $5)`,
+		token.ID, token.UserID, token.FamilyID, hash, token.ExpiresAt)
+	return wrapEntityErr("refresh_token", "create refresh token", err)
+}
+
+// RefreshTokenByHash ищет refresh-токен по хешу
+func (p *PostgresStorage) RefreshTokenByHash(ctx context.Context, hash string) (models.RefreshToken, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	var (
+		token      models.RefreshToken
+		revokedAt  sql.NullTime
+		replacedBy sql.NullString
+	)
+	err := p.db.QueryRowContext(ctx,
+		`SELECT id, user_id, family_id, expires_at, revoked_at, replaced_by, created_at
+		FROM refresh_tokens WHERE token_hash = $1`, hash).
+		Scan(&token.ID, &token.UserID, &token.FamilyID, &token.ExpiresAt, &revokedAt, &replacedBy, &token.CreatedAt)
+	if err != nil {
+		return models.RefreshToken{}, wrapEntityErr("refresh_token", "get refresh token", err)
+	}
+	token.RevokedAt = timePtr(revokedAt)
+	token.ReplacedBy = replacedBy.String
+	return token, nil
+}
+
+// RotateRefreshToken отзывает токен id и выдаёт вместо него next. Условие
+// revoked_at IS NULL не даёт двум параллельным запросам обменять один токен.
+func (p *PostgresStorage) RotateRefreshToken(ctx context.Context, id string, next models.RefreshToken, nextHash string) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	err := p.inTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx,
+			`UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP, replaced_by = $1
+			WHERE id = $2 AND revoked_at IS NULL`, next.ID, id)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return domain.NewError(domain.ErrConflict, "refresh_token", "rotate refresh token", nil)
+		}
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO refresh_tokens (id, user_id, family_id, token_hash, expires_at)
+			VALUES ($1, $2, $3, $4, $5)`,
+			next.ID, next.UserID, next.FamilyID, nextHash, next.ExpiresAt)
+		return err
+	})
+	return wrapEntityErr("refresh_token", "rotate refresh token", err)
+}
+
+// RevokeRefreshFamily отзывает все токены одной сессии
+func (p *PostgresStorage) RevokeRefreshFamily(ctx context.Context, familyID string) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	_, err := p.db.ExecContext(ctx,
+		"UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE family_id = $1 AND revoked_at IS NULL", familyID)
+	return wrapEntityErr("refresh_token", "revoke session", err)
+}
+
+// RevokeUserRefreshTokens отзывает все сессии пользователя
+func (p *PostgresStorage) RevokeUserRefreshTokens(ctx context.Context, userID string) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	_, err := p.db.ExecContext(ctx,
+		"UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL", userID)
+	return wrapEntityErr("refresh_token", "revoke user sessions", err)
+}
+
+// CreatePasswordReset сохраняет хеш токена сброса пароля
+func (p *PostgresStorage) CreatePasswordReset(ctx context.Context, userID, hash string, expiresAt time.Time) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	_, err := p.db.ExecContext(ctx,
+		"INSERT INTO password_reset_tokens (token_hash, user_id, expires_at) VALUES ($1, $2, $3)",
+		hash, userID, expiresAt)
+	return wrapEntityErr("password_reset", "create password reset", err)
+}
+
+// ConsumePasswordReset помечает токен использованным и возвращает его владельца
+func (p *PostgresStorage) ConsumePasswordReset(ctx context.Context, hash string, now time.Time) (string, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	var userID string
+	err := p.db.QueryRowContext(ctx,
+		`UPDATE password_reset_tokens SET used_at = $2
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > $2
+		RETURNING user_id`, hash, now).Scan(&userID)
+	if err != nil {
+		return "", wrapEntityErr("password_reset", "consume password reset", err)
+	}
+	return userID, nil
+}
@@ -0,0 +1,52 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"libraryapi/internal/domain"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// wrapErr classifies an SQLite error into a domain error kind. Errors that
+// fit no kind are wrapped as-is and end up as 500s.
+func wrapErr(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if kind := classify(err); kind != nil {
+		return domain.NewError(kind, "book", op, err)
+	}
+	return fmt.Errorf("%s: %w", op, err)
+}
+
+func classify(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.ErrNotFound
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return domain.ErrUnavailable
+	}
+
+	var liteErr *sqlite.Error
+	if !errors.As(err, &liteErr) {
+		return nil
+	}
+	switch code := liteErr.Code(); {
+	case code == sqlite3.SQLITE_CONSTRAINT_UNIQUE, code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+		return domain.ErrConflict
+	case code&0xff == sqlite3.SQLITE_CONSTRAINT:
+		return domain.ErrValidation
+	case code&0xff == sqlite3.SQLITE_BUSY,
+		code&0xff == sqlite3.SQLITE_LOCKED,
+		code&0xff == sqlite3.SQLITE_IOERR,
+		code&0xff == sqlite3.SQLITE_CANTOPEN,
+		code&0xff == sqlite3.SQLITE_FULL,
+		code&0xff == sqlite3.SQLITE_INTERRUPT:
+		return domain.ErrUnavailable
+	}
+	return nil
+}
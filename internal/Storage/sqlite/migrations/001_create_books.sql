@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS books (
+ seq INTEGER PRIMARY KEY,
+ id TEXT NOT NULL UNIQUE,
+ title TEXT NOT NULL,
+ author TEXT NOT NULL,
+ year INTEGER NOT NULL,
+ created_at INTEGER NOT NULL,
+ updated_at INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS idx_books_created_at ON books(created_at DESC, id);
+CREATE INDEX IF NOT EXISTS idx_books_year ON books(year);
+
+-- Trigram FTS5 index: substring, case-insensitive matching like Postgres ILIKE
+CREATE VIRTUAL TABLE IF NOT EXISTS books_fts USING fts5(
+ title,
+ author,
+ content='books',
+ content_rowid='seq',
+ tokenize='trigram'
+);
+
+CREATE TRIGGER IF NOT EXISTS books_fts_insert AFTER INSERT ON books BEGIN
+ INSERT INTO books_fts(rowid, title, author) VALUES (new.seq, new.title, new.author);
+END;
+
+CREATE TRIGGER IF NOT EXISTS books_fts_delete AFTER DELETE ON books BEGIN
+ INSERT INTO books_fts(books_fts, rowid, title, author) VALUES ('delete', old.seq, old.title, old.author);
+END;
+
+CREATE TRIGGER IF NOT EXISTS books_fts_update AFTER UPDATE ON books BEGIN
+ INSERT INTO books_fts(books_fts, rowid, title, author) VALUES ('delete', old.seq, old.title, old.author);
+ INSERT INTO books_fts(rowid, title, author) VALUES (new.seq, new.title, new.author);
+END;
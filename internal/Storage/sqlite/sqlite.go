@@ -0,0 +1,312 @@
+// Package sqlite is a BookRepository backed by an SQLite file, for single-node
+// and offline deployments. It uses the pure-Go modernc.org/sqlite driver, so
+// no cgo toolchain is needed.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"embed"
+	"fmt"
+	"libraryapi/internal/api/dto"
+	"libraryapi/internal/domain"
+	"libraryapi/internal/domain/models"
+	"libraryapi/internal/domain/repositories"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"modernc.org/sqlite"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+func init() {
+	// contains_fold(s, substr) mirrors Postgres ILIKE '%substr%' for search
+	// terms too short for the trigram index.
+	sqlite.MustRegisterDeterministicScalarFunction("contains_fold", 2,
+		func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+			s, _ := args[0].(string)
+			substr, _ := args[1].(string)
+			return strings.Contains(strings.ToLower(s), strings.ToLower(substr)), nil
+		})
+}
+
+type SQLiteStorage struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+// NewSQLite opens (or creates) the database at path and applies pending
+// migrations. queryTimeout bounds every query on top of the caller's context
+// (0 disables it).
+func NewSQLite(path string, queryTimeout time.Duration) (repositories.BookRepository, error) {
+	dsn := "file:" + path + "?" + url.Values{
+		"_pragma": {"busy_timeout(5000)", "journal_mode(WAL)", "foreign_keys(1)"},
+	}.Encode()
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	// SQLite allows a single writer; one connection also keeps ":memory:"
+	// databases from being split across connections.
+	db.SetMaxOpenConns(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := migrate(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLiteStorage{db: db, queryTimeout: queryTimeout}, nil
+}
+
+// migrate applies embedded migrations newer than the schema version recorded
+// in PRAGMA user_version. Files are named NNN_description.sql.
+func migrate(ctx context.Context, db *sql.DB) error {
+	var current int
+	if err := db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&current); err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+
+	entries, err := migrations.ReadDir("migrations")
+	if err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	for _, entry := range entries {
+		prefix, _, _ := strings.Cut(entry.Name(), "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return fmt.Errorf("migration %s: invalid version prefix", entry.Name())
+		}
+		if version <= current {
+			continue
+		}
+		script, err := migrations.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			return err
+		}
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, string(script)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %s: %w", entry.Name(), err)
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", version)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %s: %w", entry.Name(), err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migration %s: %w", entry.Name(), err)
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteStorage) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.queryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.queryTimeout)
+}
+
+// Close releases the database file.
+func (s *SQLiteStorage) Close() error {
+	return s.db.Close()
+}
+
+// Stats reports the connection pool statistics.
+func (s *SQLiteStorage) Stats() sql.DBStats {
+	return s.db.Stats()
+}
+
+const bookColumns = "id, title, author, year, created_at, updated_at"
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanBook(row rowScanner) (models.Book, error) {
+	var (
+		book      models.Book
+		createdAt int64
+		updatedAt sql.NullInt64
+	)
+	if err := row.Scan(&book.ID, &book.Title, &book.Author, &book.Year, &createdAt, &updatedAt); err != nil {
+		return models.Book{}, err
+	}
+	book.Created_at = time.Unix(0, createdAt)
+	if updatedAt.Valid {
+		book.UpdatedAt = time.Unix(0, updatedAt.Int64)
+	}
+	return book, nil
+}
+
+func (s *SQLiteStorage) queryBooks(ctx context.Context, op, query string, args ...interface{}) ([]models.Book, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, wrapErr(op, err)
+	}
+	defer rows.Close()
+
+	var books []models.Book
+	for rows.Next() {
+		book, err := scanBook(rows)
+		if err != nil {
+			return nil, wrapErr(op, err)
+		}
+		books = append(books, book)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr(op, err)
+	}
+	return books, nil
+}
+
+func (s *SQLiteStorage) Getall(ctx context.Context, pagination dto.Pagination) ([]models.Book, int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var totalItems int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM books").Scan(&totalItems); err != nil {
+		return nil, 0, wrapErr("count books", err)
+	}
+	if totalItems == 0 {
+		return []models.Book{}, 0, nil
+	}
+
+	books, err := s.queryBooks(ctx, "list books",
+		"SELECT "+bookColumns+" FROM books ORDER BY created_at DESC, id LIMIT ? OFFSET ?",
+		pagination.Limit, pagination.Offset())
+	if err != nil {
+		return nil, 0, err
+	}
+	return books, totalItems, nil
+}
+
+func (s *SQLiteStorage) Getbyid(ctx context.Context, id string) (models.Book, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	book, err := scanBook(s.db.QueryRowContext(ctx, "SELECT "+bookColumns+" FROM books WHERE id = ?", id))
+	if err != nil {
+		return models.Book{}, wrapErr("get book", err)
+	}
+	return book, nil
+}
+
+func (s *SQLiteStorage) Create(ctx context.Context, title string, author string, year int) (models.Book, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	now := time.Now()
+	book := models.Book{
+		ID:         uuid.New().String(),
+		Title:      title,
+		Author:     author,
+		Year:       year,
+		Created_at: now,
+		UpdatedAt:  now,
+	}
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO books (id, title, author, year, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
+		book.ID, book.Title, book.Author, book.Year, now.UnixNano(), now.UnixNano())
+	if err != nil {
+		return models.Book{}, wrapErr("create book", err)
+	}
+	return book, nil
+}
+
+func (s *SQLiteStorage) Update(ctx context.Context, id string, updated models.Book) (models.Book, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	book, err := scanBook(s.db.QueryRowContext(ctx,
+		"UPDATE books SET title = ?, author = ?, year = ?, updated_at = ? WHERE id = ? RETURNING "+bookColumns,
+		updated.Title, updated.Author, updated.Year, time.Now().UnixNano(), id))
+	if err != nil {
+		return models.Book{}, wrapErr("update book", err)
+	}
+	return book, nil
+}
+
+func (s *SQLiteStorage) Delete(ctx context.Context, id string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, "DELETE FROM books WHERE id = ?", id)
+	if err != nil {
+		return wrapErr("delete book", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return wrapErr("delete book", err)
+	}
+	if rowsAffected == 0 {
+		return domain.NotFound("book", "delete book")
+	}
+	return nil
+}
+
+// Search matches title and author as case-insensitive substrings, like the
+// ILIKE filters of PostgresStorage. Terms of three or more characters go
+// through the trigram FTS5 index; shorter ones, which trigrams cannot match,
+// fall back to a scan with contains_fold.
+func (s *SQLiteStorage) Search(ctx context.Context, title, author string, year int) ([]models.Book, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var (
+		where []string
+		args  []interface{}
+	)
+	for _, f := range []struct{ column, term string }{{"title", title}, {"author", author}} {
+		switch {
+		case f.term == "":
+		case utf8.RuneCountInString(f.term) >= 3:
+			where = append(where, "seq IN (SELECT rowid FROM books_fts WHERE books_fts MATCH ?)")
+			args = append(args, f.column+" : "+ftsPhrase(f.term))
+		default:
+			where = append(where, "contains_fold("+f.column+", ?)")
+			args = append(args, f.term)
+		}
+	}
+	if year != 0 {
+		where = append(where, "year = ?")
+		args = append(args, year)
+	}
+
+	query := "SELECT " + bookColumns + " FROM books"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY created_at DESC, id"
+	return s.queryBooks(ctx, "search books", query, args...)
+}
+
+// ftsPhrase quotes term as a single FTS5 phrase so user input cannot inject
+// query syntax.
+func ftsPhrase(term string) string {
+	return `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+}
+
+// Reindex rebuilds the FTS5 index from the books table.
+func (s *SQLiteStorage) Reindex(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, "INSERT INTO books_fts(books_fts) VALUES ('rebuild')"); err != nil {
+		return wrapErr("reindex books", err)
+	}
+	return nil
+}
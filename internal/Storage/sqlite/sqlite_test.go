@@ -0,0 +1,31 @@
+package sqlite
+
+import (
+	"libraryapi/internal/Storage/storagetest"
+	"libraryapi/internal/domain/repositories"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSQLiteConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) repositories.BookRepository {
+		repo, err := NewSQLite(filepath.Join(t.TempDir(), "library.db"), 5*time.Second)
+		if err != nil {
+			t.Fatalf("NewSQLite: %v", err)
+		}
+		t.Cleanup(func() { repo.(*SQLiteStorage).Close() })
+		return repo
+	})
+}
+
+func TestMigrationsAreIdempotent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "library.db")
+	for i := 0; i < 2; i++ {
+		repo, err := NewSQLite(path, 0)
+		if err != nil {
+			t.Fatalf("open #%d: %v", i+1, err)
+		}
+		repo.(*SQLiteStorage).Close()
+	}
+}
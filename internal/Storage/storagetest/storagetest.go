@@ -0,0 +1,271 @@
+// Package storagetest is the behavior suite every BookRepository backend must
+// pass. Backends call Run from their own tests with a factory that returns an
+// empty repository.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"libraryapi/internal/api/dto"
+	"libraryapi/internal/domain"
+	"libraryapi/internal/domain/models"
+	"libraryapi/internal/domain/repositories"
+	"testing"
+	"time"
+)
+
+// Factory returns an empty repository. Cleanup should be registered on t.
+type Factory func(t *testing.T) repositories.BookRepository
+
+// Run executes the conformance suite against the backend built by newRepo.
+func Run(t *testing.T, newRepo Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, repo repositories.BookRepository)
+	}{
+		{"CreateAndGet", testCreateAndGet},
+		{"GetMissing", testGetMissing},
+		{"Update", testUpdate},
+		{"UpdateMissing", testUpdateMissing},
+		{"Delete", testDelete},
+		{"DeleteMissing", testDeleteMissing},
+		{"GetallOrderingAndPagination", testGetall},
+		{"GetallEmpty", testGetallEmpty},
+		{"Search", testSearch},
+		{"CanceledContext", testCanceledContext},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newRepo(t))
+		})
+	}
+}
+
+func mustCreate(t *testing.T, repo repositories.BookRepository, title, author string, year int) models.Book {
+	t.Helper()
+	book, err := repo.Create(context.Background(), title, author, year)
+	if err != nil {
+		t.Fatalf("Create(%q): %v", title, err)
+	}
+	return book
+}
+
+func testCreateAndGet(t *testing.T, repo repositories.BookRepository) {
+	ctx := context.Background()
+	created := mustCreate(t, repo, "1984", "George Orwell", 1949)
+	if created.ID == "" {
+		t.Fatal("Create returned a book without ID")
+	}
+	if created.Created_at.IsZero() {
+		t.Error("Create returned a book without created_at")
+	}
+	if created.UpdatedAt.IsZero() {
+		t.Error("Create returned a book without updated_at")
+	}
+
+	got, err := repo.Getbyid(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("Getbyid: %v", err)
+	}
+	if got.ID != created.ID || got.Title != "1984" || got.Author != "George Orwell" || got.Year != 1949 {
+		t.Errorf("Getbyid = %+v, want the created book %+v", got, created)
+	}
+}
+
+func testGetMissing(t *testing.T, repo repositories.BookRepository) {
+	_, err := repo.Getbyid(context.Background(), "00000000-0000-0000-0000-000000000000")
+	if !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("Getbyid(missing) error = %v, want domain.ErrNotFound", err)
+	}
+}
+
+func testUpdate(t *testing.T, repo repositories.BookRepository) {
+	ctx := context.Background()
+	created := mustCreate(t, repo, "Animal Farm", "Orwell", 1944)
+
+	changed := created
+	changed.Author = "George Orwell"
+	changed.Year = 1945
+	updated, err := repo.Update(ctx, created.ID, changed)
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if updated.ID != created.ID || updated.Author != "George Orwell" || updated.Year != 1945 {
+		t.Errorf("Update = %+v, want author and year changed", updated)
+	}
+	if !updated.Created_at.Equal(created.Created_at) {
+		t.Errorf("Update changed created_at from %v to %v", created.Created_at, updated.Created_at)
+	}
+	if updated.UpdatedAt.IsZero() {
+		t.Error("Update did not set updated_at")
+	}
+
+	got, err := repo.Getbyid(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("Getbyid after update: %v", err)
+	}
+	if got.Author != "George Orwell" || got.Year != 1945 {
+		t.Errorf("Getbyid after update = %+v, want the updated book", got)
+	}
+}
+
+func testUpdateMissing(t *testing.T, repo repositories.BookRepository) {
+	_, err := repo.Update(context.Background(), "00000000-0000-0000-0000-000000000000",
+		models.Book{Title: "x", Author: "y", Year: 1})
+	if !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("Update(missing) error = %v, want domain.ErrNotFound", err)
+	}
+}
+
+func testDelete(t *testing.T, repo repositories.BookRepository) {
+	ctx := context.Background()
+	created := mustCreate(t, repo, "Brave New World", "Aldous Huxley", 1932)
+	if err := repo.Delete(ctx, created.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := repo.Getbyid(ctx, created.ID); !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("Getbyid after delete error = %v, want domain.ErrNotFound", err)
+	}
+}
+
+func testDeleteMissing(t *testing.T, repo repositories.BookRepository) {
+	err := repo.Delete(context.Background(), "00000000-0000-0000-0000-000000000000")
+	if !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("Delete(missing) error = %v, want domain.ErrNotFound", err)
+	}
+}
+
+// before reports whether a sorts before b in the canonical listing order:
+// newest first, ties broken by ID.
+func before(a, b models.Book) bool {
+	if !a.Created_at.Equal(b.Created_at) {
+		return a.Created_at.After(b.Created_at)
+	}
+	return a.ID < b.ID
+}
+
+func testGetall(t *testing.T, repo repositories.BookRepository) {
+	ctx := context.Background()
+	const total = 7
+	for i := 0; i < total; i++ {
+		mustCreate(t, repo, "Book", "Author", 1900+i)
+	}
+
+	seen := make(map[string]bool)
+	var listed []models.Book
+	for page := 1; page <= 4; page++ {
+		books, totalItems, err := repo.Getall(ctx, dto.Pagination{Page: page, Limit: 3})
+		if err != nil {
+			t.Fatalf("Getall(page %d): %v", page, err)
+		}
+		if totalItems != total {
+			t.Errorf("Getall(page %d) total = %d, want %d", page, totalItems, total)
+		}
+		want := 3
+		switch page {
+		case 3:
+			want = 1
+		case 4:
+			want = 0
+		}
+		if len(books) != want {
+			t.Fatalf("Getall(page %d) returned %d books, want %d", page, len(books), want)
+		}
+		for _, b := range books {
+			if seen[b.ID] {
+				t.Errorf("book %s listed on more than one page", b.ID)
+			}
+			seen[b.ID] = true
+		}
+		listed = append(listed, books...)
+	}
+
+	for i := 1; i < len(listed); i++ {
+		if before(listed[i], listed[i-1]) {
+			t.Fatalf("Getall order broken at %d: %s (%v) listed after %s (%v)",
+				i, listed[i].ID, listed[i].Created_at, listed[i-1].ID, listed[i-1].Created_at)
+		}
+	}
+
+	again, _, err := repo.Getall(ctx, dto.Pagination{Page: 1, Limit: total})
+	if err != nil {
+		t.Fatalf("Getall(all): %v", err)
+	}
+	for i := range again {
+		if again[i].ID != listed[i].ID {
+			t.Fatalf("Getall is not deterministic: position %d is %s, was %s", i, again[i].ID, listed[i].ID)
+		}
+	}
+}
+
+func testGetallEmpty(t *testing.T, repo repositories.BookRepository) {
+	books, total, err := repo.Getall(context.Background(), dto.Pagination{Page: 1, Limit: 10})
+	if err != nil {
+		t.Fatalf("Getall: %v", err)
+	}
+	if len(books) != 0 || total != 0 {
+		t.Fatalf("Getall on empty repository = %d books, total %d; want none", len(books), total)
+	}
+}
+
+func testSearch(t *testing.T, repo repositories.BookRepository) {
+	ctx := context.Background()
+	mustCreate(t, repo, "1984", "George Orwell", 1949)
+	mustCreate(t, repo, "Animal Farm", "George Orwell", 1945)
+	mustCreate(t, repo, "Brave New World", "Aldous Huxley", 1932)
+	mustCreate(t, repo, "Мастер и Маргарита", "Михаил Булгаков", 1967)
+
+	tests := []struct {
+		name   string
+		title  string
+		author string
+		year   int
+		want   int
+	}{
+		{"no filters", "", "", 0, 4},
+		{"author substring, any case", "", "orWELL", 0, 2},
+		{"title substring", "farm", "", 0, 1},
+		{"short title", "19", "", 0, 1},
+		{"year", "", "", 1932, 1},
+		{"combined", "", "orwell", 1949, 1},
+		{"cyrillic, any case", "МАРГАРИТ", "", 0, 1},
+		{"no match", "dune", "", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			books, err := repo.Search(ctx, tt.title, tt.author, tt.year)
+			if err != nil {
+				t.Fatalf("Search: %v", err)
+			}
+			if len(books) != tt.want {
+				t.Fatalf("Search(%q, %q, %d) returned %d books, want %d: %+v",
+					tt.title, tt.author, tt.year, len(books), tt.want, books)
+			}
+			for i := 1; i < len(books); i++ {
+				if before(books[i], books[i-1]) {
+					t.Fatalf("Search results not in listing order at %d", i)
+				}
+			}
+		})
+	}
+}
+
+// A canceled context stays recognizable as such; a missed deadline is
+// reported as unavailable so the client gets a 503.
+func testCanceledContext(t *testing.T, repo repositories.BookRepository) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := repo.Create(ctx, "Dune", "Frank Herbert", 1965); !errors.Is(err, context.Canceled) || err == context.Canceled {
+		t.Errorf("Create with a canceled context error = %v, want a wrapped context.Canceled", err)
+	}
+	if _, _, err := repo.Getall(ctx, dto.Pagination{Page: 1, Limit: 10}); !errors.Is(err, context.Canceled) || err == context.Canceled {
+		t.Errorf("Getall with a canceled context error = %v, want a wrapped context.Canceled", err)
+	}
+
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	if _, err := repo.Getbyid(ctx, "00000000-0000-0000-0000-000000000000"); !errors.Is(err, domain.ErrUnavailable) {
+		t.Errorf("Getbyid past the deadline error = %v, want domain.ErrUnavailable", err)
+	}
+}
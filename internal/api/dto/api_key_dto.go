@@ -0,0 +1,13 @@
+package dto
+
+import "time"
+
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" validate:"required,min=1,max=100"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1,dive,required"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty" validate:"omitempty"`
+}
+
+func (r *CreateAPIKeyRequest) Validate() error {
+	return validate.Struct(r)
+}
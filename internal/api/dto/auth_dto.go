@@ -0,0 +1,52 @@
+package dto
+
+type RegisterRequest struct {
+	Email    string `json:"email" validate:"required,email,max=254"`
+	Password string `json:"password" validate:"required,min=8,max=128"`
+}
+
+type LoginRequest struct {
+	Email    string `json:"email" validate:"required,max=254"`
+	Password string `json:"password" validate:"required,max=128"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email,max=254"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=8,max=128"`
+}
+
+type UpdateUserRolesRequest struct {
+	Roles []string `json:"roles" validate:"required,dive,required"`
+}
+
+func (r *RegisterRequest) Validate() error {
+	return validate.Struct(r)
+}
+
+func (r *LoginRequest) Validate() error {
+	return validate.Struct(r)
+}
+
+func (r *RefreshRequest) Validate() error {
+	return validate.Struct(r)
+}
+
+func (r *ForgotPasswordRequest) Validate() error {
+	return validate.Struct(r)
+}
+
+func (r *ResetPasswordRequest) Validate() error {
+	return validate.Struct(r)
+}
+
+func (r *UpdateUserRolesRequest) Validate() error {
+	return validate.Struct(r)
+}
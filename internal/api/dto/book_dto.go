@@ -1,6 +1,17 @@
 package dto
 
-import "github.com/go-playground/validator/v10"
+import (
+	"libraryapi/internal/pkg/i18n"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/ru"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	en_translations "github.com/go-playground/validator/v10/translations/en"
+	ru_translations "github.com/go-playground/validator/v10/translations/ru"
+)
 
 type CreateBookRequest struct {
 	Title  string `json:"title" validate:"required,min=1,max=200"`
@@ -14,10 +25,44 @@ type UpdateBookRequest struct {
 	Year   *int    `json:"year,omitempty" validate:"omitempty,min=0,max=2026"`
 }
 
-var validate *validator.Validate
+var (
+	validate    *validator.Validate
+	translators = make(map[string]ut.Translator)
+)
 
 func init() {
 	validate = validator.New()
+	// Report fields by their JSON names so errors match the request body.
+	validate.RegisterTagNameFunc(func(fld reflect.StructField) string {
+		name, _, _ := strings.Cut(fld.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+
+	uni := ut.New(en.New(), en.New(), ru.New())
+	registrations := map[string]func(*validator.Validate, ut.Translator) error{
+		i18n.English: en_translations.RegisterDefaultTranslations,
+		i18n.Russian: ru_translations.RegisterDefaultTranslations,
+	}
+	for lang, register := range registrations {
+		trans, _ := uni.GetTranslator(lang)
+		if err := register(validate, trans); err != nil {
+			panic("dto: register " + lang + " validator translations: " + err.Error())
+		}
+		translators[lang] = trans
+	}
+}
+
+// FieldMessage renders a validation failure in the given language, falling
+// back to the default language.
+func FieldMessage(fe validator.FieldError, lang string) string {
+	trans, ok := translators[lang]
+	if !ok {
+		trans = translators[i18n.Default()]
+	}
+	return fe.Translate(trans)
 }
 
 func (r *CreateBookRequest) Validate() error {
@@ -1,7 +1,7 @@
 package dto
 
 import (
-	"errors"
+	"libraryapi/internal/pkg/i18n"
 	"strconv"
 )
 
@@ -30,10 +30,10 @@ func Newpaginationfromrequest(query map[string]string) Pagination {
 }
 func (p *Pagination) Validate() error {
 	if p.Page < 1 {
-		return errors.New("Page must be greater than 0")
+		return i18n.Error("pagination.invalid_page")
 	}
 	if p.Limit < 1 && p.Limit > 15000 {
-		return errors.New("Limit must be between 1 and 15000")
+		return i18n.Error("pagination.invalid_limit")
 	}
 	return nil
 }
@@ -46,10 +46,10 @@ func (p *Pagination) Offset() int {
 }
 
 type PaginationInfo struct {
-	CurrentPage int  `json:"current_page"`
-	PerPage     int  `json:"per_page"`
-	TotalPages  int  `json:"total_pages"`
-	TotalItems  int  `json:"total_items"`
-	HasNext     bool `json:"has_next"`
-	HasPrev     bool `json:"has_prev"`
+	CurrentPage int  `json:"current_page" xml:"current_page"`
+	PerPage     int  `json:"per_page" xml:"per_page"`
+	TotalPages  int  `json:"total_pages" xml:"total_pages"`
+	TotalItems  int  `json:"total_items" xml:"total_items"`
+	HasNext     bool `json:"has_next" xml:"has_next"`
+	HasPrev     bool `json:"has_prev" xml:"has_prev"`
 }
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"libraryapi/internal/api/dto"
+	"libraryapi/internal/api/responses"
+	"libraryapi/internal/domain/models"
+	"libraryapi/internal/domain/repositories"
+	"libraryapi/internal/pkg/auth"
+	"libraryapi/internal/pkg/i18n"
+	"libraryapi/internal/pkg/logger"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type APIKeyHandler struct {
+	keys   *auth.APIKeys
+	repo   repositories.APIKeyRepository
+	policy *auth.Policy
+}
+
+// NewAPIKeyHandler serves the API key endpoints. policy keeps callers from
+// issuing keys with permissions they do not hold themselves.
+func NewAPIKeyHandler(repo repositories.APIKeyRepository, policy *auth.Policy) *APIKeyHandler {
+	return &APIKeyHandler{keys: auth.NewAPIKeys(repo), repo: repo, policy: policy}
+}
+
+// createdAPIKey is the only response that carries the plaintext key.
+type createdAPIKey struct {
+	XMLName xml.Name `json:"-" msgpack:"-" csv:"-" xml:"api_key"`
+	models.APIKey
+	Key string `json:"key" xml:"key"`
+}
+
+func (h *APIKeyHandler) APIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.ListAPIKeys(w, r)
+	case http.MethodPost:
+		h.CreateAPIKey(w, r)
+	default:
+		responses.MethodNotAllowed(w, r)
+	}
+}
+
+func (h *APIKeyHandler) APIKeyByIDHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/keys/")
+	if id == "" || strings.Contains(id, "/") {
+		responses.NotFound(w, r, i18n.Error("api_key.not_found"))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodDelete:
+		h.RevokeAPIKey(w, r, id)
+	default:
+		responses.MethodNotAllowed(w, r)
+	}
+}
+
+func (h *APIKeyHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.repo.ListAPIKeys(r.Context())
+	if err != nil {
+		repoLogEvent(r, err).Err(err).Msg("Failed to list API keys")
+		responses.FromError(w, r, err)
+		return
+	}
+	if err := responses.Success(w, r, keys, ""); err != nil {
+		logger.Ctx(r.Context()).Error().Err(err).Msg("Failed to send API key list")
+	}
+}
+
+func (h *APIKeyHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req dto.CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Ctx(r.Context()).Warn().Err(err).Msg("Failed to decode request body")
+		responses.BadRequest(w, r, i18n.Error("request.invalid_json"))
+		return
+	}
+	if err := req.Validate(); err != nil {
+		logger.Ctx(r.Context()).Warn().Err(err).Msg("Validation failed for create API key request")
+		responses.ValidationFailed(w, r, err)
+		return
+	}
+
+	principal := auth.FromContext(r.Context())
+	createdBy := ""
+	if principal != nil {
+		createdBy = principal.Subject
+	}
+	for _, scope := range req.Scopes {
+		if !auth.KnownPermission(auth.Permission(scope)) {
+			responses.BadRequest(w, r, i18n.Error("api_key.unknown_scope", scope))
+			return
+		}
+		if !h.policy.Allowed(principal, auth.Permission(scope)) {
+			logger.Ctx(r.Context()).Warn().Str("subject", createdBy).Str("scope", scope).Msg("Refused to grant a scope the caller lacks")
+			responses.Forbidden(w, r, i18n.Error("auth.forbidden"))
+			return
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		responses.BadRequest(w, r, i18n.Error("api_key.expired"))
+		return
+	}
+
+	key, plaintext, err := h.keys.Issue(r.Context(), req.Name, req.Scopes, req.ExpiresAt, createdBy)
+	if err != nil {
+		repoLogEvent(r, err).Err(err).Msg("Failed to create API key")
+		responses.FromError(w, r, err)
+		return
+	}
+
+	logger.Ctx(r.Context()).Info().
+		Str("api_key", key.Prefix).
+		Str("name", key.Name).
+		Strs("scopes", key.Scopes).
+		Str("created_by", createdBy).
+		Msg("API key created")
+
+	if err := responses.Success(w, r, createdAPIKey{APIKey: key, Key: plaintext}, "api_key.created"); err != nil {
+		logger.Ctx(r.Context()).Error().Err(err).Msg("Failed to send create API key response")
+	}
+}
+
+func (h *APIKeyHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request, id string) {
+	if err := h.repo.RevokeAPIKey(r.Context(), id); err != nil {
+		repoLogEvent(r, err).Str("api_key_id", id).Err(err).Msg("Failed to revoke API key")
+		responses.FromError(w, r, err)
+		return
+	}
+
+	logger.Ctx(r.Context()).Info().Str("api_key_id", id).Msg("API key revoked")
+
+	if err := responses.Success(w, r, nil, "api_key.revoked"); err != nil {
+		logger.Ctx(r.Context()).Error().Err(err).Msg("Failed to send revoke API key response")
+	}
+}
@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"libraryapi/internal/api/dto"
+	"libraryapi/internal/api/responses"
+	"libraryapi/internal/domain"
+	"libraryapi/internal/domain/models"
+	"libraryapi/internal/domain/repositories"
+	"libraryapi/internal/pkg/auth"
+	"libraryapi/internal/pkg/i18n"
+	"libraryapi/internal/pkg/logger"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// AuthHandler serves registration, login and session endpoints under
+// /api/auth and user administration under /api/users.
+type AuthHandler struct {
+	accounts *auth.Accounts
+	users    repositories.UserRepository
+	policy   *auth.Policy
+}
+
+func NewAuthHandler(accounts *auth.Accounts, users repositories.UserRepository, policy *auth.Policy) *AuthHandler {
+	return &AuthHandler{accounts: accounts, users: users, policy: policy}
+}
+
+// session is the body returned by login and refresh, shaped after the
+// OAuth 2 token response.
+type session struct {
+	XMLName      xml.Name     `json:"-" msgpack:"-" csv:"-" xml:"session"`
+	AccessToken  string       `json:"access_token" xml:"access_token"`
+	RefreshToken string       `json:"refresh_token" xml:"refresh_token"`
+	TokenType    string       `json:"token_type" xml:"token_type"`
+	ExpiresIn    int          `json:"expires_in" xml:"expires_in"`
+	User         *models.User `json:"user,omitempty" xml:"user,omitempty"`
+}
+
+func newSession(t auth.Tokens, user *models.User) session {
+	return session{
+		AccessToken:  t.AccessToken,
+		RefreshToken: t.RefreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(time.Until(t.ExpiresAt).Seconds()),
+		User:         user,
+	}
+}
+
+// decode reads a JSON body into req and validates it, writing the error
+// response itself when it fails.
+func decode(w http.ResponseWriter, r *http.Request, req interface{ Validate() error }) bool {
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		logger.Ctx(r.Context()).Warn().Err(err).Msg("Failed to decode request body")
+		responses.BadRequest(w, r, i18n.Error("request.invalid_json"))
+		return false
+	}
+	if err := req.Validate(); err != nil {
+		logger.Ctx(r.Context()).Warn().Err(err).Msg("Validation failed")
+		responses.ValidationFailed(w, r, err)
+		return false
+	}
+	return true
+}
+
+// post guards the /api/auth endpoints, which all take POST.
+func post(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			responses.MethodNotAllowed(w, r)
+			return
+		}
+		h(w, r)
+	}
+}
+
+func (h *AuthHandler) RegisterHandler(w http.ResponseWriter, r *http.Request) {
+	post(h.Register)(w, r)
+}
+
+func (h *AuthHandler) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	post(h.Login)(w, r)
+}
+
+func (h *AuthHandler) RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	post(h.Refresh)(w, r)
+}
+
+func (h *AuthHandler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	post(h.Logout)(w, r)
+}
+
+func (h *AuthHandler) ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	post(h.ForgotPassword)(w, r)
+}
+
+func (h *AuthHandler) ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	post(h.ResetPassword)(w, r)
+}
+
+func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
+	var req dto.RegisterRequest
+	if !decode(w, r, &req) {
+		return
+	}
+
+	user, err := h.accounts.Register(r.Context(), req.Email, req.Password)
+	if err != nil {
+		if errors.Is(err, domain.ErrConflict) {
+			logger.Ctx(r.Context()).Warn().Msg("Registration with a taken email")
+		} else {
+			repoLogEvent(r, err).Err(err).Msg("Failed to register user")
+		}
+		responses.FromError(w, r, err)
+		return
+	}
+
+	logger.Ctx(r.Context()).Info().Str("user_id", user.ID).Msg("User registered")
+
+	if err := responses.Success(w, r, user, "user.registered"); err != nil {
+		logger.Ctx(r.Context()).Error().Err(err).Msg("Failed to send register response")
+	}
+}
+
+func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	var req dto.LoginRequest
+	if !decode(w, r, &req) {
+		return
+	}
+
+	tokens, user, err := h.accounts.Login(r.Context(), req.Email, req.Password)
+	switch {
+	case errors.Is(err, auth.ErrInvalidCredentials):
+		logger.Ctx(r.Context()).Warn().Msg("Failed login")
+		responses.Unauthorized(w, r, i18n.Error("auth.invalid_credentials"))
+		return
+	case errors.Is(err, auth.ErrAccountLocked):
+		logger.Ctx(r.Context()).Warn().Err(err).Msg("Login to a locked account")
+		responses.Locked(w, r, i18n.Error("auth.account_locked"))
+		return
+	case err != nil:
+		repoLogEvent(r, err).Err(err).Msg("Failed to log in")
+		responses.FromError(w, r, err)
+		return
+	}
+
+	logger.Ctx(r.Context()).Info().Str("user_id", user.ID).Msg("User logged in")
+
+	if err := responses.Success(w, r, newSession(tokens, &user), ""); err != nil {
+		logger.Ctx(r.Context()).Error().Err(err).Msg("Failed to send login response")
+	}
+}
+
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req dto.RefreshRequest
+	if !decode(w, r, &req) {
+		return
+	}
+
+	tokens, err := h.accounts.Refresh(r.Context(), req.RefreshToken)
+	if errors.Is(err, auth.ErrInvalidRefreshToken) {
+		responses.Unauthorized(w, r, i18n.Error("auth.refresh_token_invalid"))
+		return
+	}
+	if err != nil {
+		repoLogEvent(r, err).Err(err).Msg("Failed to refresh session")
+		responses.FromError(w, r, err)
+		return
+	}
+
+	if err := responses.Success(w, r, newSession(tokens, nil), ""); err != nil {
+		logger.Ctx(r.Context()).Error().Err(err).Msg("Failed to send refresh response")
+	}
+}
+
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	var req dto.RefreshRequest
+	if !decode(w, r, &req) {
+		return
+	}
+
+	if err := h.accounts.Logout(r.Context(), req.RefreshToken); err != nil {
+		repoLogEvent(r, err).Err(err).Msg("Failed to log out")
+		responses.FromError(w, r, err)
+		return
+	}
+
+	if err := responses.Success(w, r, nil, "auth.logged_out"); err != nil {
+		logger.Ctx(r.Context()).Error().Err(err).Msg("Failed to send logout response")
+	}
+}
+
+func (h *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req dto.ForgotPasswordRequest
+	if !decode(w, r, &req) {
+		return
+	}
+
+	err := h.accounts.RequestPasswordReset(r.Context(), req.Email)
+	if errors.Is(err, auth.ErrResetUnavailable) {
+		responses.NotImplemented(w, r, i18n.Error("auth.reset_unavailable"))
+		return
+	}
+	if err != nil {
+		repoLogEvent(r, err).Err(err).Msg("Failed to start password reset")
+		responses.FromError(w, r, err)
+		return
+	}
+
+	if err := responses.Success(w, r, nil, "auth.reset_requested"); err != nil {
+		logger.Ctx(r.Context()).Error().Err(err).Msg("Failed to send forgot password response")
+	}
+}
+
+func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req dto.ResetPasswordRequest
+	if !decode(w, r, &req) {
+		return
+	}
+
+	err := h.accounts.ResetPassword(r.Context(), req.Token, req.Password)
+	if errors.Is(err, auth.ErrInvalidResetToken) {
+		responses.BadRequest(w, r, i18n.Error("auth.reset_token_invalid"))
+		return
+	}
+	if err != nil {
+		repoLogEvent(r, err).Err(err).Msg("Failed to reset password")
+		responses.FromError(w, r, err)
+		return
+	}
+
+	logger.Ctx(r.Context()).Info().Msg("Password reset")
+
+	if err := responses.Success(w, r, nil, "auth.password_reset"); err != nil {
+		logger.Ctx(r.Context()).Error().Err(err).Msg("Failed to send reset password response")
+	}
+}
+
+// Me returns the account of the caller.
+func (h *AuthHandler) Me(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		responses.MethodNotAllowed(w, r)
+		return
+	}
+	principal := auth.FromContext(r.Context())
+	if principal == nil || principal.APIKeyID != "" {
+		responses.NotFound(w, r, i18n.Error("user.not_found"))
+		return
+	}
+
+	user, err := h.users.UserByID(r.Context(), principal.Subject)
+	if err != nil {
+		repoLogEvent(r, err).Str("user_id", principal.Subject).Err(err).Msg("Failed to get current user")
+		responses.FromError(w, r, err)
+		return
+	}
+	if err := responses.Success(w, r, user, ""); err != nil {
+		logger.Ctx(r.Context()).Error().Err(err).Msg("Failed to send current user")
+	}
+}
+
+func (h *AuthHandler) UsersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		responses.MethodNotAllowed(w, r)
+		return
+	}
+	users, err := h.users.ListUsers(r.Context())
+	if err != nil {
+		repoLogEvent(r, err).Err(err).Msg("Failed to list users")
+		responses.FromError(w, r, err)
+		return
+	}
+	if err := responses.Success(w, r, users, ""); err != nil {
+		logger.Ctx(r.Context()).Error().Err(err).Msg("Failed to send user list")
+	}
+}
+
+func (h *AuthHandler) UserByIDHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/users/")
+	if id == "" || strings.Contains(id, "/") {
+		responses.NotFound(w, r, i18n.Error("user.not_found"))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPatch:
+		h.UpdateUserRoles(w, r, id)
+	default:
+		responses.MethodNotAllowed(w, r)
+	}
+}
+
+// UpdateUserRoles replaces the roles of a user. They take effect at the
+// user's next refresh, when the access token is reissued.
+func (h *AuthHandler) UpdateUserRoles(w http.ResponseWriter, r *http.Request, id string) {
+	var req dto.UpdateUserRolesRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	for _, role := range req.Roles {
+		if !h.policy.KnownRole(role) {
+			responses.BadRequest(w, r, i18n.Error("user.unknown_role", role))
+			return
+		}
+	}
+
+	user, err := h.users.SetUserRoles(r.Context(), id, req.Roles)
+	if err != nil {
+		repoLogEvent(r, err).Str("user_id", id).Err(err).Msg("Failed to update user roles")
+		responses.FromError(w, r, err)
+		return
+	}
+
+	principal := auth.FromContext(r.Context())
+	changedBy := ""
+	if principal != nil {
+		changedBy = principal.Subject
+	}
+	logger.Ctx(r.Context()).Info().Str("user_id", id).Strs("roles", user.Roles).Str("changed_by", changedBy).Msg("User roles updated")
+
+	if err := responses.Success(w, r, user, "user.updated"); err != nil {
+		logger.Ctx(r.Context()).Error().Err(err).Msg("Failed to send update user response")
+	}
+}
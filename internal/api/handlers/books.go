@@ -1,31 +1,50 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"libraryapi/internal/api/dto"
+	"libraryapi/internal/api/middleware"
 	"libraryapi/internal/api/responses"
+	"libraryapi/internal/domain"
 	"libraryapi/internal/domain/models"
 	"libraryapi/internal/domain/repositories"
-	"libraryapi/internal/pkg/cache"
+	"libraryapi/internal/pkg/i18n"
+	"libraryapi/internal/pkg/logger"
 	"net/http"
-	"strconv"
 	"strings"
-	"time"
 
-	"github.com/rs/zerolog/log"
+	"github.com/rs/zerolog"
 )
 
 type BookHandler struct {
-	repo  repositories.BookRepository
-	cache cache.Cache
+	repo    repositories.BookRepository
+	onWrite func(op string)
 }
 
-func NewBookHandler(repo repositories.BookRepository, cache cache.Cache) *BookHandler {
-	return &BookHandler{
-		repo:  repo,
-		cache: cache,
-	}
+func NewBookHandler(repo repositories.BookRepository) *BookHandler {
+	return &BookHandler{repo: repo, onWrite: func(string) {}}
+}
+
+// OnWrite sets fn to be called after every successful write with op
+// "create", "update" or "delete", e.g. to count them. Call it before the
+// handler serves requests.
+func (h *BookHandler) OnWrite(fn func(op string)) {
+	h.onWrite = fn
+}
+
+// Surrogate keys of book responses. Every write changes the list, so it
+// purges the list key besides the key of the book itself.
+const booksListKey = "books:list"
+
+func bookKey(id string) string {
+	return "book:" + id
+}
+
+// tag sets the surrogate keys of the response; see middleware.ResponseCache.
+func tag(w http.ResponseWriter, keys ...string) {
+	w.Header().Set(middleware.SurrogateKeyHeader, strings.Join(keys, " "))
 }
 
 func (h *BookHandler) BooksHandler(w http.ResponseWriter, r *http.Request) {
@@ -35,20 +54,20 @@ func (h *BookHandler) BooksHandler(w http.ResponseWriter, r *http.Request) {
 	case http.MethodPost:
 		h.AddBook(w, r)
 	default:
-		responses.MethodNotAllowed(w)
+		responses.MethodNotAllowed(w, r)
 	}
 }
 
 func (h *BookHandler) BookByIDHandler(w http.ResponseWriter, r *http.Request) {
 	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
 	if len(parts) < 2 {
-		responses.BadRequest(w, errors.New("invalid URL: book ID required"))
+		responses.BadRequest(w, r, i18n.Error("request.book_id_required"))
 		return
 	}
 
 	id := parts[len(parts)-1]
 	if id == "" {
-		responses.BadRequest(w, errors.New("book ID cannot be empty"))
+		responses.BadRequest(w, r, i18n.Error("request.book_id_empty"))
 		return
 	}
 
@@ -60,31 +79,35 @@ func (h *BookHandler) BookByIDHandler(w http.ResponseWriter, r *http.Request) {
 	case http.MethodDelete:
 		h.DeleteBook(w, r, id)
 	default:
-		responses.MethodNotAllowed(w)
+		responses.MethodNotAllowed(w, r)
 	}
 }
 
+// repoLogEvent picks the level of a failed storage call: missing entities
+// are warnings, requests the client gave up on debug and everything else an
+// error.
+func repoLogEvent(r *http.Request, err error) *zerolog.Event {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return logger.Ctx(r.Context()).Debug()
+	case errors.Is(err, domain.ErrNotFound):
+		return logger.Ctx(r.Context()).Warn()
+	}
+	return logger.Ctx(r.Context()).Error()
+}
+
 // extra functions for Getbooks w pagination
 
 type paginatedresponse struct {
-	Data []models.Book      `json:"data"`
-	Meta dto.PaginationInfo `json:"meta"`
+	Data []models.Book      `json:"data" xml:"items>book"`
+	Meta dto.PaginationInfo `json:"meta" xml:"meta"`
 }
 
-func hasfilters(queryparams map[string]string) bool {
-	params := []string{"author", "year", "title"}
-	for _, param := range params {
-		if _, ok := queryparams[param]; ok {
-			return true
-		}
-	}
-	return false
-}
-func generatePaginationCacheKey(pagination dto.Pagination) string {
-	k := strconv.Itoa(pagination.Page)
-	j := strconv.Itoa(pagination.Limit)
-	return "books:page:" + k + ":limit:" + j
+// Items exposes the page rows to list-only formats such as CSV.
+func (p paginatedresponse) Items() interface{} {
+	return p.Data
 }
+
 func calculateTotalPages(totalItems, perPage int) int {
 	if perPage == 0 {
 		return 0
@@ -108,35 +131,19 @@ func (h *BookHandler) GetBooks(w http.ResponseWriter, r *http.Request) {
 	}
 	pagination := dto.Newpaginationfromrequest(queryparams)
 	if err := pagination.Validate(); err != nil {
-		responses.BadRequest(w, err)
+		responses.BadRequest(w, r, err)
 		return
 	}
 
-	cacheKey := ""
-	if !hasfilters(queryparams) {
-		cacheKey = generatePaginationCacheKey(pagination)
-		var cachedresponse paginatedresponse
-		if err := h.cache.Get(cacheKey, &cachedresponse); err == nil {
-			if err := responses.Success(w, cachedresponse, ""); err != nil {
-				log.Error().Err(err).Msg("Failed to send cached response")
-				if err := h.cache.Delete(cacheKey); err != nil {
-					log.Error().Err(err).Msg("Failed to delete cache")
-				}
-			} else {
-				log.Debug().Str("cache_key", cacheKey).Msg("Cache hit for paginated books")
-				return
-			}
-		}
-	}
-	books, totalItems, err := h.repo.Getall(pagination)
+	books, totalItems, err := h.repo.Getall(r.Context(), pagination)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to get books from repository")
-		responses.InternalError(w, errors.New("failed to get books"))
+		repoLogEvent(r, err).Err(err).Msg("Failed to get books from repository")
+		responses.FromError(w, r, err)
 		return
 	}
 	if len(books) == 0 {
-		responses.NotFound(w, errors.New("no books found"))
-		log.Warn().Msg("No books found")
+		responses.NotFound(w, r, i18n.Error("book.list_empty"))
+		logger.Ctx(r.Context()).Warn().Msg("No books found")
 		return
 	}
 	totalpages := calculateTotalPages(totalItems, pagination.Limit)
@@ -151,13 +158,9 @@ func (h *BookHandler) GetBooks(w http.ResponseWriter, r *http.Request) {
 			HasPrev:     pagination.Page > 1,
 		},
 	}
-	if cacheKey != "" {
-		if err := h.cache.Set(cacheKey, books, 5*time.Minute); err != nil {
-			log.Warn().Err(err).Msg("Failed to cache books")
-		}
-	}
-	if err := responses.Success(w, response, ""); err != nil {
-		log.Error().Err(err).Msg("Failed to send response")
+	tag(w, booksListKey)
+	if err := responses.Success(w, r, response, ""); err != nil {
+		logger.Ctx(r.Context()).Error().Err(err).Msg("Failed to send response")
 		return
 	}
 }
@@ -166,58 +169,47 @@ func (h *BookHandler) AddBook(w http.ResponseWriter, r *http.Request) {
 	var req dto.CreateBookRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Warn().Err(err).Msg("Failed to decode request body")
-		responses.BadRequest(w, errors.New("invalid JSON format"))
+		logger.Ctx(r.Context()).Warn().Err(err).Msg("Failed to decode request body")
+		responses.BadRequest(w, r, i18n.Error("request.invalid_json"))
 		return
 	}
 
 	if err := req.Validate(); err != nil {
-		log.Warn().Err(err).Msg("Validation failed for create book request")
-		responses.BadRequest(w, err)
+		logger.Ctx(r.Context()).Warn().Err(err).Msg("Validation failed for create book request")
+		responses.ValidationFailed(w, r, err)
 		return
 	}
 
-	book := h.repo.Create(req.Title, req.Author, req.Year)
-	if err := h.cache.Delete("books:all"); err != nil {
-		log.Warn().Err(err).Msg("Failed to invalidate cache")
+	book, err := h.repo.Create(r.Context(), req.Title, req.Author, req.Year)
+	if err != nil {
+		repoLogEvent(r, err).Err(err).Msg("Failed to create book")
+		responses.FromError(w, r, err)
+		return
 	}
+	tag(w, booksListKey)
+	h.onWrite("create")
 
-	log.Info().
+	logger.Ctx(r.Context()).Info().
 		Str("book_id", book.ID).
 		Str("title", book.Title).
 		Msg("Book created")
 
-	if err := responses.Success(w, book, "Book created successfully"); err != nil {
-		log.Error().Err(err).Msg("Failed to send create book response")
+	if err := responses.Success(w, r, book, "book.created"); err != nil {
+		logger.Ctx(r.Context()).Error().Err(err).Msg("Failed to send create book response")
 	}
 }
 
 func (h *BookHandler) GetBookByID(w http.ResponseWriter, r *http.Request, id string) {
-	cacheKey := "book:" + id
-	var cachedBook models.Book
-
-	if err := h.cache.Get(cacheKey, &cachedBook); err == nil {
-		log.Debug().Str("cache_key", cacheKey).Str("book_id", id).Msg("Cache hit for book")
-
-		if err := responses.Success(w, cachedBook, ""); err != nil {
-			log.Error().Err(err).Msg("Failed to send cached book response")
-		}
-		return
-	}
-
-	book, err := h.repo.Getbyid(id)
+	book, err := h.repo.Getbyid(r.Context(), id)
 	if err != nil {
-		log.Warn().Str("book_id", id).Err(err).Msg("Book not found")
-		responses.NotFound(w, errors.New("book not found"))
+		repoLogEvent(r, err).Str("book_id", id).Err(err).Msg("Failed to get book")
+		responses.FromError(w, r, err)
 		return
 	}
 
-	if err := h.cache.Set(cacheKey, book, 10*time.Minute); err != nil {
-		log.Warn().Err(err).Str("cache_key", cacheKey).Msg("Failed to cache book")
-	}
-
-	if err := responses.Success(w, book, ""); err != nil {
-		log.Error().Err(err).Msg("Failed to send book response")
+	tag(w, bookKey(id))
+	if err := responses.Success(w, r, book, ""); err != nil {
+		logger.Ctx(r.Context()).Error().Err(err).Msg("Failed to send book response")
 	}
 }
 
@@ -225,21 +217,21 @@ func (h *BookHandler) UpdateBook(w http.ResponseWriter, r *http.Request, id stri
 	var req dto.UpdateBookRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Warn().Err(err).Msg("Failed to decode request body")
-		responses.BadRequest(w, errors.New("invalid JSON format"))
+		logger.Ctx(r.Context()).Warn().Err(err).Msg("Failed to decode request body")
+		responses.BadRequest(w, r, i18n.Error("request.invalid_json"))
 		return
 	}
 
 	if err := req.Validate(); err != nil {
-		log.Warn().Err(err).Msg("Validation failed for update book request")
-		responses.BadRequest(w, err)
+		logger.Ctx(r.Context()).Warn().Err(err).Msg("Validation failed for update book request")
+		responses.ValidationFailed(w, r, err)
 		return
 	}
 
-	existingBook, err := h.repo.Getbyid(id)
+	existingBook, err := h.repo.Getbyid(r.Context(), id)
 	if err != nil {
-		log.Warn().Str("book_id", id).Err(err).Msg("Book not found for update")
-		responses.NotFound(w, errors.New("book not found"))
+		repoLogEvent(r, err).Str("book_id", id).Err(err).Msg("Failed to get book for update")
+		responses.FromError(w, r, err)
 		return
 	}
 
@@ -258,70 +250,40 @@ func (h *BookHandler) UpdateBook(w http.ResponseWriter, r *http.Request, id stri
 	}
 
 	if !updated {
-		responses.BadRequest(w, errors.New("no changes provided"))
+		responses.BadRequest(w, r, i18n.Error("request.no_changes"))
 		return
 	}
 
-	updatedBook, err := h.repo.Update(id, existingBook)
+	updatedBook, err := h.repo.Update(r.Context(), id, existingBook)
 	if err != nil {
-		log.Error().Err(err).Str("book_id", id).Msg("Failed to update book")
-		responses.InternalError(w, errors.New("failed to update book"))
+		repoLogEvent(r, err).Err(err).Str("book_id", id).Msg("Failed to update book")
+		responses.FromError(w, r, err)
 		return
 	}
 
-	// Invalidate caches
-	cacheKeys := []string{"books:all", "book:" + id}
-	for _, key := range cacheKeys {
-		if err := h.cache.Delete(key); err != nil {
-			log.Warn().Err(err).Str("cache_key", key).Msg("Failed to invalidate cache")
-		}
-	}
+	tag(w, bookKey(id), booksListKey)
+	h.onWrite("update")
 
-	log.Info().Str("book_id", id).Msg("Book updated")
+	logger.Ctx(r.Context()).Info().Str("book_id", id).Msg("Book updated")
 
-	if err := responses.Success(w, updatedBook, "Book updated successfully"); err != nil {
-		log.Error().Err(err).Msg("Failed to send update book response")
+	if err := responses.Success(w, r, updatedBook, "book.updated"); err != nil {
+		logger.Ctx(r.Context()).Error().Err(err).Msg("Failed to send update book response")
 	}
 }
 
 func (h *BookHandler) DeleteBook(w http.ResponseWriter, r *http.Request, id string) {
-	if err := h.repo.Delete(id); err != nil {
-		log.Warn().Str("book_id", id).Err(err).Msg("Book not found for deletion")
-		responses.NotFound(w, errors.New("book not found"))
+	if err := h.repo.Delete(r.Context(), id); err != nil {
+		repoLogEvent(r, err).Str("book_id", id).Err(err).Msg("Failed to delete book")
+		responses.FromError(w, r, err)
 		return
 	}
 
-	// Invalidate caches
-	cacheKeys := []string{"books:all", "book:" + id}
-	for _, key := range cacheKeys {
-		if err := h.cache.Delete(key); err != nil {
-			log.Warn().Err(err).Str("cache_key", key).Msg("Failed to invalidate cache")
-		}
-	}
+	tag(w, bookKey(id), booksListKey)
+	h.onWrite("delete")
 
-	log.Info().Str("book_id", id).Msg("Book deleted")
+	logger.Ctx(r.Context()).Info().Str("book_id", id).Msg("Book deleted")
 
-	if err := responses.Success(w, nil, "Book deleted successfully"); err != nil {
-		log.Error().Err(err).Msg("Failed to send delete book response")
+	if err := responses.Success(w, r, nil, "book.deleted"); err != nil {
+		logger.Ctx(r.Context()).Error().Err(err).Msg("Failed to send delete book response")
 	}
 }
-
-func (h *BookHandler) AddTestBooks() {
-	books := []struct {
-		title  string
-		author string
-		year   int
-	}{
-		{"1984", "George Orwell", 1949},
-		{"Animal Farm", "George Orwell", 1945},
-		{"Brave New World", "Aldous Huxley", 1932},
-		{"To Kill a Mockingbird", "Harper Lee", 1960},
-		{"The Great Gatsby", "F. Scott Fitzgerald", 1925},
-	}
-
-	for _, b := range books {
-		h.repo.Create(b.title, b.author, b.year)
-	}
-
-	log.Info().Int("count", len(books)).Msg("Added test books")
-}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+// HealthCheck reports whether a dependency works; nil means healthy.
+type HealthCheck func() error
+
+type healthResponse struct {
+	Status string            `json:"status"` // ok or degraded
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Health serves the state of the server's dependencies. A failing check
+// only degrades the server, which keeps answering from storage, so the
+// status code stays 200 and load balancers keep routing to it.
+func Health(checks map[string]HealthCheck) http.HandlerFunc {
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp := healthResponse{Status: "ok", Checks: make(map[string]string, len(names))}
+		for _, name := range names {
+			if err := checks[name](); err != nil {
+				resp.Status = "degraded"
+				resp.Checks[name] = err.Error()
+			} else {
+				resp.Checks[name] = "ok"
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
@@ -1,3 +1,108 @@
 package middleware
 
-// Auth middleware will be implemented in a future stage
+import (
+	"context"
+	"errors"
+	"libraryapi/internal/api/responses"
+	"libraryapi/internal/pkg/auth"
+	"libraryapi/internal/pkg/i18n"
+	"libraryapi/internal/pkg/logger"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// Authenticator identifies the caller of a request by a bearer JWT or an API
+// key and stores the principal in the request context. Requests without
+// credentials are rejected, except reads when publicReads is set.
+// Credentials that are present are always verified.
+type Authenticator struct {
+	verifier    *auth.Verifier
+	keys        *auth.APIKeys
+	publicReads bool
+}
+
+// NewAuthenticator accepts bearer tokens checked by verifier and, when keys
+// is not nil, API keys in X-API-Key or "Authorization: ApiKey <key>".
+func NewAuthenticator(verifier *auth.Verifier, keys *auth.APIKeys, publicReads bool) *Authenticator {
+	return &Authenticator{verifier: verifier, keys: keys, publicReads: publicReads}
+}
+
+const bearerChallenge = `Bearer realm="library-api"`
+
+// credentials returns the scheme ("bearer" or "apikey") and value of the
+// credentials sent with r.
+func credentials(r *http.Request) (scheme, value string) {
+	if scheme, value, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok {
+		if value = strings.TrimSpace(value); value != "" {
+			return strings.ToLower(scheme), value
+		}
+	}
+	if key := strings.TrimSpace(r.Header.Get("X-API-Key")); key != "" {
+		return "apikey", key
+	}
+	return "", ""
+}
+
+// rejected reports whether err means the credentials are bad, as opposed to
+// a failure while checking them.
+func rejected(err error) bool {
+	return errors.Is(err, auth.ErrInvalidToken) ||
+		errors.Is(err, auth.ErrTokenExpired) ||
+		errors.Is(err, auth.ErrInvalidAPIKey)
+}
+
+func (a *Authenticator) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			principal *auth.Principal
+			err       error
+		)
+		switch scheme, value := credentials(r); {
+		case scheme == "" && a.publicReads && isRead(r.Method):
+			next.ServeHTTP(w, r)
+			return
+		case scheme == "":
+			w.Header().Set("WWW-Authenticate", bearerChallenge)
+			responses.Unauthorized(w, r, i18n.Error("auth.token_required"))
+			return
+		case scheme == "bearer":
+			principal, err = a.verifier.Verify(r.Context(), value)
+		case scheme == "apikey" && a.keys != nil:
+			principal, err = a.keys.Verify(r.Context(), value)
+		default:
+			err = auth.ErrInvalidToken
+		}
+
+		if err != nil {
+			if !rejected(err) {
+				// The key store failed; that is not the caller's fault,
+				// unless the caller went away.
+				event := logger.Ctx(r.Context()).Error()
+				if errors.Is(err, context.Canceled) {
+					event = logger.Ctx(r.Context()).Debug()
+				}
+				event.Err(err).Msg("Failed to verify credentials")
+				responses.FromError(w, r, err)
+				return
+			}
+			logger.Ctx(r.Context()).Warn().Err(err).Msg("Rejected credentials")
+			key := "auth.token_invalid"
+			switch {
+			case errors.Is(err, auth.ErrTokenExpired):
+				key = "auth.token_expired"
+			case errors.Is(err, auth.ErrInvalidAPIKey):
+				key = "auth.api_key_invalid"
+			}
+			w.Header().Set("WWW-Authenticate", bearerChallenge+`, error="invalid_token"`)
+			responses.Unauthorized(w, r, i18n.Error(key))
+			return
+		}
+
+		logger.Update(r.Context(), func(c zerolog.Context) zerolog.Context {
+			return c.Str("user", principal.Subject)
+		})
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+	})
+}
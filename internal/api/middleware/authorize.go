@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"libraryapi/internal/api/responses"
+	"libraryapi/internal/pkg/auth"
+	"libraryapi/internal/pkg/i18n"
+	"libraryapi/internal/pkg/logger"
+	"net/http"
+)
+
+// Authorize rejects requests whose caller lacks the permission that perm
+// picks for the request. It runs after Authenticator: anonymous callers
+// without the permission get 401 so they know to authenticate, identified
+// ones get 403.
+func Authorize(policy *auth.Policy, perm func(r *http.Request) auth.Permission) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal := auth.FromContext(r.Context())
+			required := perm(r)
+			if policy.Allowed(principal, required) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if principal == nil {
+				w.Header().Set("WWW-Authenticate", bearerChallenge)
+				responses.Unauthorized(w, r, i18n.Error("auth.token_required"))
+				return
+			}
+			logger.Ctx(r.Context()).Warn().
+				Str("subject", principal.Subject).
+				Strs("roles", principal.Roles).
+				Str("permission", string(required)).
+				Msg("Permission denied")
+			responses.Forbidden(w, r, i18n.Error("auth.forbidden"))
+		})
+	}
+}
+
+// ByMethod requires read for GET, HEAD and OPTIONS requests and write for
+// every other method.
+func ByMethod(read, write auth.Permission) func(r *http.Request) auth.Permission {
+	return func(r *http.Request) auth.Permission {
+		if isRead(r.Method) {
+			return read
+		}
+		return write
+	}
+}
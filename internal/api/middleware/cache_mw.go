@@ -1,3 +1,589 @@
 package middleware
 
-// Cache middleware will be implemented in a future stage
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"libraryapi/internal/api/responses"
+	"libraryapi/internal/pkg/cache"
+	"libraryapi/internal/pkg/i18n"
+	"libraryapi/internal/pkg/logger"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// SurrogateKeyHeader is set by handlers to tag a response with the
+// space-separated surrogate keys it depends on, e.g. "book:42 books:list".
+// On a cached GET the keys tag the entry; on a successful write every entry
+// tagged with one of them is purged. The header never reaches the client.
+const SurrogateKeyHeader = "Surrogate-Key"
+
+// ResponseCache caches successful GET responses, keyed by URL, negotiated
+// media type and language, in a cache.Cache. Entries are tagged with
+// surrogate keys so writes can purge every response they affect.
+//
+// Purging does not delete entries. Every surrogate key has a generation,
+// bumped by each purge, and an entry records the generations of its keys
+// when it is stored; an entry whose generations are no longer current is a
+// miss. One bump thus invalidates any number of entries at once, e.g. every
+// page of the book list.
+//
+// Concurrent misses of an entry are coalesced: one request runs the handler
+// and the others share its response. When the cache is a cache.Locker the
+// same holds across instances, which wait for the instance filling the
+// entry instead of querying the database themselves. Entries about to
+// expire are refreshed early and expired ones are served stale for a while,
+// each by a single background request, so a popular entry is rarely missed.
+type ResponseCache struct {
+	cache      cache.Cache
+	opts       atomic.Pointer[ResponseCacheOptions]
+	flights    singleflight.Group
+	refreshing sync.Map // keys being refreshed in the background
+	// purgeFailed is set when a purge could not reach the cache; the next
+	// request then invalidates every entry.
+	purgeFailed atomic.Bool
+	observer    CacheObserver
+}
+
+// CacheObserver is told how the ResponseCache handled each request of a
+// route, e.g. to count hits.
+type CacheObserver interface {
+	// CacheLookup reports the result of a GET: "hit", "stale", "miss" or,
+	// when the client asked to skip the cache, "bypass".
+	CacheLookup(route, result string)
+	// CacheError reports a cache operation that failed: "get", "set",
+	// "lock" or "purge". Purges outside a route have an empty route.
+	CacheError(route, op string)
+}
+
+type nopObserver struct{}
+
+func (nopObserver) CacheLookup(route, result string) {}
+func (nopObserver) CacheError(route, op string)      {}
+
+// CachePolicy configures the caching of one route's responses.
+type CachePolicy struct {
+	TTL time.Duration // 0 disables caching
+	// StaleTTL is how long past its TTL an entry is still served while it
+	// is refreshed in the background. Purged entries are never served.
+	StaleTTL time.Duration
+	// EarlyRefresh scales how early before its TTL an entry may be
+	// refreshed in the background, relative to how long the handler took
+	// to produce it; 0 disables, 1 suits most routes.
+	EarlyRefresh float64
+}
+
+type ResponseCacheOptions struct {
+	Routes map[string]CachePolicy
+	// LockWait bounds how long a miss waits for another instance filling
+	// the same entry before it runs the handler itself.
+	LockWait time.Duration
+}
+
+func NewResponseCache(c cache.Cache, opts ResponseCacheOptions) *ResponseCache {
+	rc := &ResponseCache{cache: c, observer: nopObserver{}}
+	rc.SetOptions(opts)
+	return rc
+}
+
+// SetObserver reports lookups and errors to o. Call it before the cache
+// serves requests.
+func (rc *ResponseCache) SetObserver(o CacheObserver) {
+	rc.observer = o
+}
+
+// SetOptions replaces the cache policies from now on; entries already
+// cached keep the TTL they were stored with.
+func (rc *ResponseCache) SetOptions(opts ResponseCacheOptions) {
+	rc.opts.Store(&opts)
+}
+
+const (
+	// lockTTL bounds how long a crashed instance can hold a fill lock.
+	lockTTL = 10 * time.Second
+	// lockPoll is how often a waiting miss looks for the filled entry.
+	lockPoll = 25 * time.Millisecond
+	// refreshTimeout bounds a background refresh, which has no client
+	// to cancel it.
+	refreshTimeout = 30 * time.Second
+)
+
+// errFilling means another instance holds the fill lock of an entry.
+var errFilling = errors.New("entry is being filled by another instance")
+
+// cachedResponse is a stored response.
+type cachedResponse struct {
+	Status      int              `json:"status"`
+	Header      http.Header      `json:"header"`
+	Body        []byte           `json:"body"`
+	StoredAt    time.Time        `json:"stored_at"`
+	TTL         time.Duration    `json:"ttl"`
+	Delta       time.Duration    `json:"delta"`       // how long the handler took
+	Generations map[string]int64 `json:"generations"` // of its surrogate keys
+}
+
+// refreshEarly decides whether a fresh entry of age is refreshed now. The
+// probability rises towards 1 as the entry nears its TTL, and entries that
+// are slow to produce start earlier ("optimal probabilistic cache stampede
+// prevention", Vattani et al.).
+func (e cachedResponse) refreshEarly(age time.Duration, beta float64) bool {
+	if beta <= 0 || e.Delta <= 0 {
+		return false
+	}
+	gap := time.Duration(float64(e.Delta) * beta * -math.Log(1-rand.Float64()))
+	return age+gap >= e.TTL
+}
+
+// cacheControl holds the request directives the cache honours.
+type cacheControl struct {
+	noCache, noStore, onlyIfCached bool
+	maxAge                         time.Duration // -1 when not given
+}
+
+func parseCacheControl(header string) cacheControl {
+	cc := cacheControl{maxAge: -1}
+	for _, directive := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-cache":
+			cc.noCache = true
+		case "no-store":
+			cc.noStore = true
+		case "only-if-cached":
+			cc.onlyIfCached = true
+		case "max-age":
+			if n, err := strconv.Atoi(strings.Trim(value, `"`)); err == nil && n >= 0 {
+				cc.maxAge = time.Duration(n) * time.Second
+			}
+		}
+	}
+	return cc
+}
+
+// responseKey identifies the representation r asks for. Accept and
+// Accept-Language enter through the media type and language they negotiate
+// to, so equivalent headers share an entry.
+func responseKey(r *http.Request) string {
+	mediaType, _ := responses.Negotiate(r)
+	sum := sha256.Sum256([]byte(r.URL.RequestURI() + "\n" + mediaType + "\n" + i18n.FromRequest(r)))
+	return "http:" + hex.EncodeToString(sum[:16])
+}
+
+func tagKey(tag string) string {
+	return "surrogate:" + tag
+}
+
+// purgeKey holds a generation bumped by every purge, whatever its tags.
+const purgeKey = "surrogate:*"
+
+// allTag tags every entry, so all of them can be invalidated at once.
+const allTag = "all"
+
+// generation returns the current generation of key; a missing key is 0.
+func (rc *ResponseCache) generation(ctx context.Context, key string) int64 {
+	var g int64
+	if err := rc.cache.Get(ctx, key, &g); err != nil {
+		return 0
+	}
+	return g
+}
+
+func (rc *ResponseCache) bump(ctx context.Context, key string) error {
+	if c, ok := rc.cache.(cache.Counter); ok {
+		_, err := c.Incr(ctx, key)
+		return err
+	}
+	// Without atomic increments any new value does; concurrent bumps
+	// still both leave the generation changed.
+	return rc.cache.Set(ctx, key, time.Now().UnixNano(), 0)
+}
+
+// current reports whether the surrogate keys of entry are still at the
+// generations it was stored with.
+func (rc *ResponseCache) current(ctx context.Context, entry cachedResponse) bool {
+	for tag, g := range entry.Generations {
+		if rc.generation(ctx, tagKey(tag)) != g {
+			return false
+		}
+	}
+	return true
+}
+
+// Route caches the GET responses of the named route and purges the tags of
+// its writes. It must run after authentication and authorization so only
+// permitted requests reach the cache.
+func (rc *ResponseCache) Route(name string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rc.retryPurge(r.Context(), name)
+			if r.Method != http.MethodGet {
+				if r.Method == http.MethodHead || r.Method == http.MethodOptions {
+					StripSurrogateKeys(next).ServeHTTP(w, r)
+					return
+				}
+				pw := &purgingWriter{ResponseWriter: w, rc: rc, ctx: r.Context(), route: name}
+				next.ServeHTTP(pw, r)
+				if !pw.wroteHeader {
+					pw.WriteHeader(http.StatusOK) // what net/http would send
+				}
+				return
+			}
+
+			cc := parseCacheControl(r.Header.Get("Cache-Control"))
+			key := responseKey(r)
+			policy := rc.opts.Load().Routes[name]
+			if !cc.noCache && !cc.noStore {
+				var entry cachedResponse
+				err := rc.cache.Get(r.Context(), key, &entry)
+				if err != nil && !errors.Is(err, cache.ErrMiss) {
+					rc.observer.CacheError(name, "get")
+				}
+				if err == nil && rc.current(r.Context(), entry) {
+					age := time.Since(entry.StoredAt)
+					// Ages are whole seconds, so max-age=0 accepts an entry
+					// stored this second.
+					if cc.maxAge < 0 || age.Truncate(time.Second) <= cc.maxAge {
+						switch {
+						case age < entry.TTL:
+							if entry.refreshEarly(age, policy.EarlyRefresh) {
+								rc.refresh(name, key, r, next)
+							}
+							rc.observer.CacheLookup(name, "hit")
+							writeCached(w, entry, age, "HIT")
+							return
+						case age < entry.TTL+policy.StaleTTL:
+							rc.refresh(name, key, r, next)
+							rc.observer.CacheLookup(name, "stale")
+							writeCached(w, entry, age, "STALE")
+							return
+						}
+					}
+				}
+			}
+			if cc.onlyIfCached {
+				rc.observer.CacheLookup(name, "miss")
+				responses.Error(w, r, http.StatusGatewayTimeout, i18n.Error("request.not_cached"), "NOT_CACHED")
+				return
+			}
+
+			if cc.noCache || cc.noStore {
+				// The client wants a response fresher than any other
+				// request could share.
+				rc.observer.CacheLookup(name, "bypass")
+				entry, _, _ := rc.fill(name, key, r, next, !cc.noStore, false)
+				writeCached(w, entry, 0, "MISS")
+				return
+			}
+			ch := rc.flights.DoChan(key, func() (any, error) {
+				entry, hit, err := rc.fill(name, key, r, next, true, false)
+				return flight{entry, hit}, err
+			})
+			select {
+			case res := <-ch:
+				if res.Err != nil {
+					// The request that ran the handler was cancelled, so
+					// its response cannot be shared.
+					if r.Context().Err() != nil {
+						return
+					}
+					entry, _, _ := rc.fill(name, key, r, next, true, false)
+					rc.observer.CacheLookup(name, "miss")
+					writeCached(w, entry, 0, "MISS")
+					return
+				}
+				f := res.Val.(flight)
+				if f.hit {
+					rc.observer.CacheLookup(name, "hit")
+					writeCached(w, f.entry, time.Since(f.entry.StoredAt), "HIT")
+					return
+				}
+				rc.observer.CacheLookup(name, "miss")
+				writeCached(w, f.entry, 0, "MISS")
+			case <-r.Context().Done():
+			}
+		})
+	}
+}
+
+// flight is the result of a coalesced fill.
+type flight struct {
+	entry cachedResponse
+	hit   bool // filled by another instance
+}
+
+// fill runs the handler for a miss of key and stores the response if store
+// is set. With a cache.Locker only one instance fills an entry at a time;
+// the others wait up to LockWait for it to be stored, reporting a hit, or
+// with background set give up with errFilling. fill also fails when r was
+// cancelled while the handler ran.
+func (rc *ResponseCache) fill(name, key string, r *http.Request, next http.Handler, store, background bool) (cachedResponse, bool, error) {
+	opts := rc.opts.Load()
+	policy := opts.Routes[name]
+	if locker, ok := rc.cache.(cache.Locker); ok && store && policy.TTL > 0 {
+		unlock, locked, err := locker.TryLock(r.Context(), "lock:"+key, lockTTL)
+		switch {
+		case err != nil:
+			rc.observer.CacheError(name, "lock")
+			logger.Ctx(r.Context()).Warn().Err(err).Str("cache_key", key).Msg("Failed to take cache fill lock")
+		case locked:
+			defer unlock()
+		case background:
+			return cachedResponse{}, false, errFilling
+		default:
+			if entry, ok := rc.await(r.Context(), key, opts.LockWait); ok {
+				return entry, true, nil
+			}
+		}
+	}
+
+	// A purge while the handler runs may come after it read the data but
+	// before the generations below are read; the response is then not
+	// stored.
+	purges := rc.generation(r.Context(), purgeKey)
+	rec := &recordingWriter{header: make(http.Header), status: http.StatusOK}
+	start := time.Now()
+	next.ServeHTTP(rec, r)
+	tags := strings.Fields(rec.header.Get(SurrogateKeyHeader))
+	rec.header.Del(SurrogateKeyHeader)
+	entry := cachedResponse{
+		Status:   rec.status,
+		Header:   rec.header,
+		Body:     rec.body.Bytes(),
+		StoredAt: time.Now(),
+		TTL:      policy.TTL,
+		Delta:    time.Since(start),
+	}
+	if err := r.Context().Err(); err != nil {
+		return entry, false, err
+	}
+	if store && policy.TTL > 0 && rec.status == http.StatusOK && cacheable(rec.header) {
+		// The response is complete, so storing it is not cancelled with r.
+		rc.store(context.WithoutCancel(r.Context()), name, key, tags, policy.TTL+policy.StaleTTL, purges, entry)
+	}
+	return entry, false, nil
+}
+
+// await polls for a fresh, current entry under key until wait passes.
+func (rc *ResponseCache) await(ctx context.Context, key string, wait time.Duration) (cachedResponse, bool) {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	ticker := time.NewTicker(lockPoll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			var entry cachedResponse
+			if err := rc.cache.Get(ctx, key, &entry); err == nil && time.Since(entry.StoredAt) < entry.TTL && rc.current(ctx, entry) {
+				return entry, true
+			}
+		case <-timer.C:
+			return cachedResponse{}, false
+		case <-ctx.Done():
+			return cachedResponse{}, false
+		}
+	}
+}
+
+// refresh fills key again in the background, unless it is already being
+// refreshed here or, with a cache.Locker, filled by another instance. The
+// refresh outlives r, so it runs on a copy detached from its cancellation.
+func (rc *ResponseCache) refresh(name, key string, r *http.Request, next http.Handler) {
+	if _, busy := rc.refreshing.LoadOrStore(key, struct{}{}); busy {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), refreshTimeout)
+	r = r.Clone(ctx)
+	go func() {
+		defer rc.refreshing.Delete(key)
+		defer cancel()
+		_, err, _ := rc.flights.Do(key, func() (any, error) {
+			entry, hit, err := rc.fill(name, key, r, next, true, true)
+			return flight{entry, hit}, err
+		})
+		if err != nil && !errors.Is(err, errFilling) {
+			logger.Ctx(r.Context()).Warn().Err(err).Str("cache_key", key).Msg("Background cache refresh failed")
+		}
+	}()
+}
+
+// cacheable reports whether the handler allows its response to be shared.
+func cacheable(h http.Header) bool {
+	cc := strings.ToLower(h.Get("Cache-Control"))
+	return !strings.Contains(cc, "no-store") && !strings.Contains(cc, "private") && h.Get("Set-Cookie") == ""
+}
+
+// writeCached sends entry with X-Cache set to state; Age is sent for
+// entries that come from the cache.
+func writeCached(w http.ResponseWriter, entry cachedResponse, age time.Duration, state string) {
+	for k, v := range entry.Header {
+		w.Header()[k] = slices.Clone(v)
+	}
+	if state != "MISS" {
+		w.Header().Set("Age", strconv.Itoa(int(age.Seconds())))
+	}
+	w.Header().Set("X-Cache", state)
+	w.WriteHeader(entry.Status)
+	w.Write(entry.Body)
+}
+
+// store saves entry of route under key for ttl with the current generations
+// of tags, unless a purge happened since purges was read.
+func (rc *ResponseCache) store(ctx context.Context, route, key string, tags []string, ttl time.Duration, purges int64, entry cachedResponse) {
+	entry.Generations = make(map[string]int64, len(tags)+1)
+	for _, tag := range append(tags, allTag) {
+		entry.Generations[tag] = rc.generation(ctx, tagKey(tag))
+	}
+	if rc.generation(ctx, purgeKey) != purges {
+		logger.Ctx(ctx).Debug().Str("cache_key", key).Msg("Purge during request, not caching the response")
+		return
+	}
+	if err := rc.cache.Set(ctx, key, entry, ttl); err != nil {
+		rc.observer.CacheError(route, "set")
+		logger.Ctx(ctx).Warn().Err(err).Str("cache_key", key).Msg("Failed to cache response")
+	}
+}
+
+// Purge invalidates every cached response tagged with one of tags. The
+// purge generation is bumped first, so a response being cached concurrently
+// either sees it and is not stored, or records the old tag generations and
+// is invalidated by the bumps that follow.
+func (rc *ResponseCache) Purge(ctx context.Context, tags ...string) {
+	rc.purge(ctx, "", tags)
+}
+
+// purge is Purge on behalf of route.
+func (rc *ResponseCache) purge(ctx context.Context, route string, tags []string) {
+	if len(tags) == 0 {
+		return
+	}
+	if err := rc.bump(ctx, purgeKey); err != nil {
+		rc.purgeFailure(ctx, route, err, "*")
+	}
+	for _, tag := range tags {
+		if err := rc.bump(ctx, tagKey(tag)); err != nil {
+			rc.purgeFailure(ctx, route, err, tag)
+			continue
+		}
+		logger.Ctx(ctx).Debug().Str("surrogate_key", tag).Msg("Purged cached responses")
+	}
+}
+
+// purgeFailure remembers that entries may not have been purged. While the
+// cache is unavailable every purge fails, so only other errors are logged.
+func (rc *ResponseCache) purgeFailure(ctx context.Context, route string, err error, tag string) {
+	rc.purgeFailed.Store(true)
+	rc.observer.CacheError(route, "purge")
+	if !errors.Is(err, cache.ErrUnavailable) {
+		logger.Ctx(ctx).Error().Err(err).Str("surrogate_key", tag).Msg("Failed to purge cached responses")
+	}
+}
+
+// retryPurge invalidates every entry once the cache can be reached after a
+// purge failed, so responses a write made stale while the cache was down
+// are not served when it is back.
+func (rc *ResponseCache) retryPurge(ctx context.Context, route string) {
+	if rc.purgeFailed.CompareAndSwap(true, false) {
+		rc.purge(context.WithoutCancel(ctx), route, []string{allTag})
+		if !rc.purgeFailed.Load() {
+			logger.Ctx(ctx).Info().Msg("Invalidated every cached response after a failed purge")
+		}
+	}
+}
+
+// recordingWriter buffers a response so it can be stored before it is sent.
+type recordingWriter struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rw *recordingWriter) Header() http.Header {
+	return rw.header
+}
+
+func (rw *recordingWriter) WriteHeader(code int) {
+	if !rw.wroteHeader {
+		rw.status, rw.wroteHeader = code, true
+	}
+}
+
+func (rw *recordingWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	return rw.body.Write(b)
+}
+
+// purgingWriter purges the surrogate keys of a successful write before its
+// response is sent, so the client's next read cannot hit a stale entry.
+type purgingWriter struct {
+	http.ResponseWriter
+	rc          *ResponseCache
+	ctx         context.Context // of the request
+	route       string
+	wroteHeader bool
+}
+
+func (pw *purgingWriter) WriteHeader(code int) {
+	if !pw.wroteHeader {
+		pw.wroteHeader = true
+		tags := strings.Fields(pw.Header().Get(SurrogateKeyHeader))
+		pw.Header().Del(SurrogateKeyHeader)
+		if code >= 200 && code < 300 {
+			// The write happened, so its purge must not be cancelled
+			// with the request.
+			pw.rc.purge(context.WithoutCancel(pw.ctx), pw.route, tags)
+		}
+	}
+	pw.ResponseWriter.WriteHeader(code)
+}
+
+func (pw *purgingWriter) Write(b []byte) (int, error) {
+	if !pw.wroteHeader {
+		pw.WriteHeader(http.StatusOK)
+	}
+	return pw.ResponseWriter.Write(b)
+}
+
+// StripSurrogateKeys removes the surrogate keys handlers set from responses
+// no ResponseCache handles, e.g. when caching is disabled, so they never
+// reach the client either.
+func StripSurrogateKeys(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &strippingWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+		if !sw.wroteHeader {
+			w.Header().Del(SurrogateKeyHeader)
+		}
+	})
+}
+
+type strippingWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (sw *strippingWriter) WriteHeader(code int) {
+	if !sw.wroteHeader {
+		sw.wroteHeader = true
+		sw.Header().Del(SurrogateKeyHeader)
+	}
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *strippingWriter) Write(b []byte) (int, error) {
+	if !sw.wroteHeader {
+		sw.WriteHeader(http.StatusOK)
+	}
+	return sw.ResponseWriter.Write(b)
+}
@@ -0,0 +1,347 @@
+package middleware
+
+import (
+	"context"
+	"libraryapi/internal/pkg/cache"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newMemoryCache() *cache.MemoryCache {
+	return cache.NewMemoryCache(1 << 20)
+}
+
+// lockingCache adds cache.Locker to a MemoryCache, as if it were shared by
+// several instances.
+type lockingCache struct {
+	*cache.MemoryCache
+	locks sync.Map
+}
+
+func (c *lockingCache) TryLock(ctx context.Context, key string, ttl time.Duration) (func(), bool, error) {
+	if _, held := c.locks.LoadOrStore(key, true); held {
+		return nil, false, nil
+	}
+	return func() { c.locks.Delete(key) }, true, nil
+}
+
+func policies(route string, p CachePolicy) ResponseCacheOptions {
+	return ResponseCacheOptions{Routes: map[string]CachePolicy{route: p}, LockWait: time.Second}
+}
+
+// eventually polls cond for up to a second.
+func eventually(t *testing.T, cond func() bool) bool {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if cond() {
+			return true
+		}
+	}
+	return false
+}
+
+// counting serves a response tagged with book:1 and counts the calls that
+// reach it.
+type counting struct{ calls int }
+
+func (h *counting) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.calls++
+	w.Header().Set(SurrogateKeyHeader, "book:1")
+	if r.Method != http.MethodGet {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"lang":"` + r.Header.Get("Accept-Language") + `"}`))
+}
+
+func get(h http.Handler, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/api/books/1", nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestResponseCache(t *testing.T) {
+	backend := &counting{}
+	rc := NewResponseCache(newMemoryCache(), policies("book", CachePolicy{TTL: time.Minute}))
+	h := rc.Route("book")(backend)
+
+	first := get(h)
+	if first.Header().Get("X-Cache") != "MISS" || first.Header().Get(SurrogateKeyHeader) != "" {
+		t.Fatalf("first GET: X-Cache %q, Surrogate-Key %q", first.Header().Get("X-Cache"), first.Header().Get(SurrogateKeyHeader))
+	}
+	second := get(h)
+	if second.Header().Get("X-Cache") != "HIT" || second.Body.String() != first.Body.String() {
+		t.Fatalf("second GET: X-Cache %q, body %q", second.Header().Get("X-Cache"), second.Body.String())
+	}
+	if second.Header().Get("Content-Type") != "application/json" || second.Header().Get("Age") == "" {
+		t.Errorf("cached headers %v lack Content-Type or Age", second.Header())
+	}
+	if backend.calls != 1 {
+		t.Errorf("handler called %d times, want 1", backend.calls)
+	}
+
+	// Another language is another representation.
+	if w := get(h, "Accept-Language", "ru"); w.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("GET in ru: X-Cache %q, want MISS", w.Header().Get("X-Cache"))
+	}
+
+	// Clients may skip the cache.
+	calls := backend.calls
+	if w := get(h, "Cache-Control", "no-cache"); w.Header().Get("X-Cache") != "MISS" || backend.calls != calls+1 {
+		t.Errorf("no-cache GET: X-Cache %q", w.Header().Get("X-Cache"))
+	}
+	if w := get(h, "Cache-Control", "max-age=0"); w.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("max-age=0 GET of a fresh entry: X-Cache %q, want HIT", w.Header().Get("X-Cache"))
+	}
+
+	// A successful write purges every entry tagged with its keys.
+	r := httptest.NewRequest(http.MethodPut, "/api/books/1", nil)
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if w := get(h, "Cache-Control", "only-if-cached"); w.Code != http.StatusGatewayTimeout {
+		t.Errorf("only-if-cached after purge: status %d, want 504", w.Code)
+	}
+	if w := get(h, "Accept-Language", "ru", "Cache-Control", "only-if-cached"); w.Code != http.StatusGatewayTimeout {
+		t.Errorf("only-if-cached in ru after purge: status %d, want 504", w.Code)
+	}
+}
+
+func TestParseCacheControl(t *testing.T) {
+	cc := parseCacheControl(`no-store, Max-Age="30", only-if-cached`)
+	if !cc.noStore || cc.noCache || !cc.onlyIfCached || cc.maxAge != 30*time.Second {
+		t.Errorf("parseCacheControl = %+v", cc)
+	}
+	if cc := parseCacheControl(""); cc.maxAge != -1 {
+		t.Errorf("maxAge without directive = %v, want -1", cc.maxAge)
+	}
+}
+
+func TestResponseCachePurgeDuringRequest(t *testing.T) {
+	rc := NewResponseCache(newMemoryCache(), policies("books", CachePolicy{TTL: time.Minute}))
+	version := "old"
+	// The handler reads its data, then a write commits and purges before the
+	// response is cached.
+	h := rc.Route("books")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := version
+		if version == "old" {
+			version = "new"
+			rc.Purge(t.Context(), "books:list")
+		}
+		w.Header().Set(SurrogateKeyHeader, "books:list")
+		w.Write([]byte(body))
+	}))
+
+	if w := get(h); w.Body.String() != "old" {
+		t.Fatalf("first GET = %q", w.Body.String())
+	}
+	if w := get(h); w.Body.String() != "new" || w.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("GET after concurrent purge = %q (X-Cache %s), want a fresh %q", w.Body.String(), w.Header().Get("X-Cache"), "new")
+	}
+	if w := get(h); w.Body.String() != "new" || w.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("third GET = %q (X-Cache %s), want cached %q", w.Body.String(), w.Header().Get("X-Cache"), "new")
+	}
+}
+
+func TestResponseCacheCoalescesMisses(t *testing.T) {
+	rc := NewResponseCache(newMemoryCache(), policies("books", CachePolicy{TTL: time.Minute}))
+	var calls atomic.Int32
+	release := make(chan struct{})
+	h := rc.Route("books")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		w.Write([]byte("page"))
+	}))
+
+	const clients = 10
+	var wg sync.WaitGroup
+	bodies := make(chan string, clients)
+	for range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bodies <- get(h).Body.String()
+		}()
+	}
+	// Let every client join the flight before the handler returns.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(bodies)
+
+	for body := range bodies {
+		if body != "page" {
+			t.Errorf("coalesced GET = %q, want %q", body, "page")
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("handler called %d times for %d concurrent misses, want 1", n, clients)
+	}
+}
+
+func TestResponseCacheServesStale(t *testing.T) {
+	rc := NewResponseCache(newMemoryCache(), policies("book", CachePolicy{TTL: 20 * time.Millisecond, StaleTTL: time.Minute}))
+	var calls atomic.Int32
+	h := rc.Route("book")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		w.Header().Set(SurrogateKeyHeader, "book:1")
+		w.Write([]byte("v" + strconv.Itoa(int(n))))
+	}))
+
+	get(h)
+	time.Sleep(30 * time.Millisecond)
+	if w := get(h); w.Body.String() != "v1" || w.Header().Get("X-Cache") != "STALE" {
+		t.Fatalf("GET of an expired entry = %q (X-Cache %s), want stale %q", w.Body.String(), w.Header().Get("X-Cache"), "v1")
+	}
+	if !eventually(t, func() bool { w := get(h); return w.Body.String() == "v2" && w.Header().Get("X-Cache") == "HIT" }) {
+		t.Fatal("the stale entry was not refreshed in the background")
+	}
+
+	// A purged entry is never served stale.
+	rc.Purge(t.Context(), "book:1")
+	if w := get(h); w.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("GET after purge: X-Cache %q, want MISS", w.Header().Get("X-Cache"))
+	}
+}
+
+func TestRefreshEarly(t *testing.T) {
+	entry := cachedResponse{TTL: time.Minute, Delta: time.Millisecond}
+	if entry.refreshEarly(time.Second, 1) {
+		t.Error("a new entry that is quick to produce was refreshed early")
+	}
+	if !entry.refreshEarly(time.Minute, 1) {
+		t.Error("an entry at its TTL was not refreshed")
+	}
+	if entry.refreshEarly(time.Minute, 0) {
+		t.Error("early refresh with beta 0 was not disabled")
+	}
+	slow := cachedResponse{TTL: time.Minute, Delta: time.Hour}
+	if !slow.refreshEarly(time.Second, 1) {
+		t.Error("an entry slower to produce than its TTL was not refreshed early")
+	}
+}
+
+func TestResponseCacheWaitsForOtherInstance(t *testing.T) {
+	shared := &lockingCache{MemoryCache: newMemoryCache()}
+	policy := CachePolicy{TTL: time.Minute}
+	var calls atomic.Int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Write([]byte("page"))
+	})
+	local := NewResponseCache(shared, policies("books", policy)).Route("books")(handler)
+	// The other instance holds the fill lock while it runs the handler.
+	unlock, _, _ := shared.TryLock(t.Context(), "lock:"+responseKey(httptest.NewRequest(http.MethodGet, "/api/books/1", nil)), time.Minute)
+	other := NewResponseCache(shared.MemoryCache, policies("books", policy)).Route("books")(handler)
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- get(local) }()
+	time.Sleep(50 * time.Millisecond)
+	get(other)
+	unlock()
+
+	if w := <-done; w.Body.String() != "page" || w.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("GET waiting for another instance = %q (X-Cache %s), want its cached response", w.Body.String(), w.Header().Get("X-Cache"))
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("handler called %d times across instances, want 1", n)
+	}
+}
+
+// downCache fails increments while down, like a BreakerCache whose circuit
+// is open.
+type downCache struct {
+	*cache.MemoryCache
+	down bool
+}
+
+func (c *downCache) Incr(ctx context.Context, key string) (int64, error) {
+	if c.down {
+		return 0, cache.ErrUnavailable
+	}
+	return c.MemoryCache.Incr(ctx, key)
+}
+
+func TestResponseCacheRetriesFailedPurge(t *testing.T) {
+	c := &downCache{MemoryCache: newMemoryCache()}
+	rc := NewResponseCache(c, policies("book", CachePolicy{TTL: time.Minute}))
+	h := rc.Route("book")(&counting{})
+	get(h)
+
+	// The write cannot purge while the cache is down.
+	c.down = true
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/api/books/1", nil))
+	if !rc.purgeFailed.Load() {
+		t.Fatal("failed purge was not remembered")
+	}
+
+	// Once it is back, the next request invalidates every entry.
+	c.down = false
+	if w := get(h); w.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("GET after the cache came back: X-Cache %q, want MISS", w.Header().Get("X-Cache"))
+	}
+	if rc.purgeFailed.Load() {
+		t.Error("purge still pending after it succeeded")
+	}
+}
+
+func TestResponseCacheCodecs(t *testing.T) {
+	for _, codec := range []cache.Codec{cache.JSON, cache.MsgPack, cache.Gob} {
+		c := newMemoryCache()
+		c.Serializer = cache.NewSerializer(codec, cache.Zstd, 0)
+		h := NewResponseCache(c, policies("book", CachePolicy{TTL: time.Minute})).Route("book")(&counting{})
+		first := get(h)
+		second := get(h)
+		if second.Header().Get("X-Cache") != "HIT" || second.Body.String() != first.Body.String() ||
+			second.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("%s: cached GET: X-Cache %q, body %q, headers %v", codec.Name(), second.Header().Get("X-Cache"), second.Body.String(), second.Header())
+		}
+	}
+}
+
+// countingObserver counts what a ResponseCache reports.
+type countingObserver struct {
+	mu     sync.Mutex
+	events map[string]int
+}
+
+func (o *countingObserver) record(event string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.events == nil {
+		o.events = make(map[string]int)
+	}
+	o.events[event]++
+}
+
+func (o *countingObserver) CacheLookup(route, result string) { o.record(route + " " + result) }
+func (o *countingObserver) CacheError(route, op string)      { o.record(route + " error " + op) }
+
+func TestResponseCacheObserver(t *testing.T) {
+	c := &downCache{MemoryCache: newMemoryCache()}
+	rc := NewResponseCache(c, policies("book", CachePolicy{TTL: time.Minute}))
+	o := &countingObserver{}
+	rc.SetObserver(o)
+	h := rc.Route("book")(&counting{})
+
+	get(h)
+	get(h)
+	get(h)
+	get(h, "Cache-Control", "no-cache")
+	c.down = true
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/api/books/1", nil))
+
+	want := map[string]int{"book miss": 1, "book hit": 2, "book bypass": 1, "book error purge": 2}
+	for event, n := range want {
+		if o.events[event] != n {
+			t.Errorf("%q reported %d times, want %d; all: %v", event, o.events[event], n, o.events)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	corsAllowMethods  = "GET, HEAD, POST, PUT, PATCH, DELETE"
+	corsExposeHeaders = "Content-Language, Retry-After, RateLimit-Policy, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, X-Request-ID"
+	corsMaxAge        = "600"
+)
+
+// CORS lets browsers on the allowed origins call the API. "*" allows any
+// origin.
+type CORS struct {
+	origins atomic.Pointer[[]string]
+}
+
+func NewCORS(origins []string) *CORS {
+	c := &CORS{}
+	c.SetOrigins(origins)
+	return c
+}
+
+// SetOrigins replaces the allowed origins, effective immediately.
+func (c *CORS) SetOrigins(origins []string) {
+	c.origins.Store(&origins)
+}
+
+func (c *CORS) allowed(origin string) (string, bool) {
+	for _, o := range *c.origins.Load() {
+		if o == "*" {
+			return "*", true
+		}
+		if strings.EqualFold(o, origin) {
+			return origin, true
+		}
+	}
+	return "", false
+}
+
+func (c *CORS) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		allowOrigin, ok := c.allowed(origin)
+		if !ok {
+			// Without the headers the browser blocks the response itself.
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Set("Access-Control-Allow-Origin", allowOrigin)
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			h.Set("Access-Control-Allow-Methods", corsAllowMethods)
+			if reqHeaders := r.Header.Get("Access-Control-Request-Headers"); reqHeaders != "" {
+				h.Set("Access-Control-Allow-Headers", reqHeaders)
+			}
+			h.Set("Access-Control-Max-Age", corsMaxAge)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h.Set("Access-Control-Expose-Headers", corsExposeHeaders)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -1,10 +1,10 @@
 package middleware
 
 import (
+	"context"
+	"libraryapi/internal/pkg/logger"
 	"net/http"
 	"time"
-
-	"github.com/rs/zerolog/log"
 )
 
 type responseWriter struct {
@@ -24,26 +24,67 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 	return n, err
 }
 
-func Logger(next http.Handler) http.Handler {
+// RequestObserver is told about every request Logger logs: route is the
+// ServeMux pattern that matched it, empty if none did (see RecordRoute).
+type RequestObserver func(r *http.Request, route string, status, bytes int, d time.Duration)
+
+type routeKey struct{}
+
+// RecordRoute wraps the ServeMux of the server so Logger learns the pattern
+// each request matched, also when the handler panics. Logger cannot read
+// r.Pattern itself: middleware in between may hand the mux a copy of the
+// request.
+func RecordRoute(mux http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
+		defer func() {
+			if route, ok := r.Context().Value(routeKey{}).(*string); ok {
+				*route = r.Pattern
+			}
+		}()
+		mux.ServeHTTP(w, r)
+	})
+}
 
-		rw := &responseWriter{
-			ResponseWriter: w,
-			statusCode:     http.StatusOK,
-		}
+// withRoute returns r with a place for RecordRoute to store the route in,
+// shared with the middleware further out that made one.
+func withRoute(r *http.Request) (*http.Request, *string) {
+	if route, ok := r.Context().Value(routeKey{}).(*string); ok {
+		return r, route
+	}
+	route := new(string)
+	return r.WithContext(context.WithValue(r.Context(), routeKey{}, route)), route
+}
 
-		next.ServeHTTP(rw, r)
+// Logger logs every request and reports it to observers once it was served.
+// It logs with the request's logger, so RequestID should run further out
+// to attach the request ID, method and path, and Recovery further in, so a
+// request that panics is logged with the 500 Recovery sends.
+func Logger(observers ...RequestObserver) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
 
-		duration := time.Since(start)
+			rw := &responseWriter{
+				ResponseWriter: w,
+				statusCode:     http.StatusOK,
+			}
+			r, route := withRoute(r)
 
-		log.Info().
-			Str("method", r.Method).
-			Str("path", r.URL.Path).
-			Str("remote_addr", r.RemoteAddr).
-			Int("status", rw.statusCode).
-			Int("bytes", rw.bytesWritten).
-			Dur("duration", duration).
-			Msg("HTTP request")
-	})
+			next.ServeHTTP(rw, r)
+
+			duration := time.Since(start)
+
+			logger.Ctx(r.Context()).Info().
+				Str("route", *route).
+				Str("remote_addr", r.RemoteAddr).
+				Int("status", rw.statusCode).
+				Int("bytes", rw.bytesWritten).
+				Dur("duration", duration).
+				Msg("HTTP request")
+
+			for _, observe := range observers {
+				observe(r, *route, rw.statusCode, rw.bytesWritten, duration)
+			}
+		})
+	}
 }
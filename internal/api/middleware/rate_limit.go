@@ -1,3 +1,232 @@
 package middleware
 
-// RateLimit middleware will be implemented in a future stage
+import (
+	"context"
+	"libraryapi/internal/api/responses"
+	"libraryapi/internal/pkg/auth"
+	"libraryapi/internal/pkg/i18n"
+	"libraryapi/internal/pkg/logger"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Quota is the number of requests a client may make per minute. Reads are
+// GET, HEAD and OPTIONS requests; everything else is a write. 0 disables the
+// limit.
+type Quota struct {
+	Reads  int
+	Writes int
+}
+
+// RateLimitOptions are the settings of a RateLimiter that can change while
+// it runs.
+type RateLimitOptions struct {
+	Default Quota
+	// Routes overrides Default for the routes named in Route.
+	Routes map[string]Quota
+	// TrustedProxies are the peers whose X-Forwarded-For header is believed.
+	TrustedProxies []netip.Prefix
+}
+
+// RateLimiter limits each client with a token bucket per route and request
+// class. Buckets refill continuously, so a client that used its quota gets a
+// request back every minute/limit. With a Redis client the buckets live in
+// Redis and every API instance shares them; while Redis is unreachable each
+// instance falls back to buckets of its own.
+type RateLimiter struct {
+	opts   atomic.Pointer[RateLimitOptions]
+	redis  redis.UniversalClient
+	prefix string // of the bucket keys in Redis
+	local  *localBuckets
+	warned atomic.Int64 // unix time of the last fallback warning
+}
+
+// NewRateLimiter keeps buckets in client under keys starting with keyPrefix,
+// or in process memory when client is nil.
+func NewRateLimiter(opts RateLimitOptions, client redis.UniversalClient, keyPrefix string) *RateLimiter {
+	l := &RateLimiter{redis: client, prefix: keyPrefix, local: newLocalBuckets()}
+	l.SetOptions(opts)
+	return l
+}
+
+// SetOptions changes the limits for every client, effective immediately.
+func (l *RateLimiter) SetOptions(opts RateLimitOptions) {
+	l.opts.Store(&opts)
+}
+
+func isRead(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// clientIP is the address of the peer or, when the peer is a trusted proxy,
+// the rightmost X-Forwarded-For address that is not a trusted proxy itself.
+// Addresses left of it could have been made up by the client.
+func clientIP(r *http.Request, trusted []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	peer, err := netip.ParseAddr(host)
+	if err != nil || !isTrusted(peer.Unmap(), trusted) {
+		return host
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		if !isTrusted(addr.Unmap(), trusted) {
+			return addr.Unmap().String()
+		}
+		host = addr.Unmap().String()
+	}
+	return host
+}
+
+func isTrusted(addr netip.Addr, trusted []netip.Prefix) bool {
+	for _, p := range trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientKey names the client of r: its API key or user when the request was
+// authenticated, its IP address otherwise.
+func clientKey(r *http.Request, trusted []netip.Prefix) string {
+	if p := auth.FromContext(r.Context()); p != nil {
+		if p.APIKeyID != "" {
+			return "key:" + p.APIKeyID
+		}
+		return "user:" + p.Subject
+	}
+	return "ip:" + clientIP(r, trusted)
+}
+
+// Route limits requests to the named route. It must run after the
+// authenticator so clients are told apart by their credentials.
+func (l *RateLimiter) Route(name string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			opts := l.opts.Load()
+			q, ok := opts.Routes[name]
+			if !ok {
+				q = opts.Default
+			}
+			class, limit := "write", q.Writes
+			if isRead(r.Method) {
+				class, limit = "read", q.Reads
+			}
+			if limit <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := name + ":" + class + ":" + clientKey(r, opts.TrustedProxies)
+			d := l.take(r.Context(), key, limit, 1)
+
+			h := w.Header()
+			h.Set("RateLimit-Policy", strconv.Itoa(limit)+";w=60")
+			h.Set("RateLimit-Limit", strconv.Itoa(limit))
+			h.Set("RateLimit-Remaining", strconv.Itoa(d.remaining))
+			h.Set("RateLimit-Reset", seconds(d.reset))
+			if !d.allowed {
+				h.Set("Retry-After", seconds(d.retryAfter))
+				responses.TooManyRequests(w, r, i18n.Error("request.rate_limited"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Failures limits the credentials a client may have rejected with 401 to
+// the write quota of the named route, per IP address as a rejected client
+// has no other name. It runs in front of the authenticator: a client whose
+// failures used up the quota gets 429 before its credentials are checked,
+// so tokens and API keys, each a key store lookup, cannot be guessed at
+// full speed.
+func (l *RateLimiter) Failures(name string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			opts := l.opts.Load()
+			q, ok := opts.Routes[name]
+			if !ok {
+				q = opts.Default
+			}
+			if q.Writes <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := name + ":failed:ip:" + clientIP(r, opts.TrustedProxies)
+			if d := l.take(r.Context(), key, q.Writes, 0); !d.allowed {
+				w.Header().Set("Retry-After", seconds(d.retryAfter))
+				responses.TooManyRequests(w, r, i18n.Error("request.rate_limited"))
+				return
+			}
+			rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			next.ServeHTTP(rw, r)
+			if rw.statusCode == http.StatusUnauthorized {
+				l.take(r.Context(), key, q.Writes, 1)
+			}
+		})
+	}
+}
+
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// decision is the outcome of taking a token from a bucket.
+type decision struct {
+	allowed    bool
+	remaining  int           // whole tokens left
+	reset      time.Duration // until the bucket is full again
+	retryAfter time.Duration // until the next token, when not allowed
+}
+
+// newDecision describes a bucket of limit tokens per minute that holds
+// tokens after the request was counted.
+func newDecision(allowed bool, tokens float64, limit int) decision {
+	perToken := float64(time.Minute) / float64(limit)
+	d := decision{
+		allowed:   allowed,
+		remaining: int(math.Floor(tokens)),
+		reset:     time.Duration((float64(limit) - tokens) * perToken),
+	}
+	if !allowed {
+		d.retryAfter = time.Duration((1 - tokens) * perToken)
+	}
+	return d
+}
+
+// take spends cost tokens, 1 or 0 to only check for one, from the bucket of
+// key, in Redis when there is one.
+func (l *RateLimiter) take(ctx context.Context, key string, limit, cost int) decision {
+	if l.redis != nil {
+		d, err := takeRedis(ctx, l.redis, l.prefix+key, limit, cost)
+		if err == nil {
+			return d
+		}
+		if now := time.Now().Unix(); now-l.warned.Load() >= 60 {
+			l.warned.Store(now)
+			logger.Ctx(ctx).Warn().Err(err).Msg("Rate limit store unavailable, limiting per instance")
+		}
+	}
+	return l.local.take(key, limit, cost, time.Now())
+}
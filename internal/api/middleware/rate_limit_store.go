@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// tokenBucket refills KEYS[1] for the time since its last use, then, if a
+// token is left, takes ARGV[2] of them: 1, or 0 to only check. ARGV[1] is
+// the capacity, refilled over one minute. Redis's own clock is used so instances with skewed clocks agree. The
+// remaining tokens are returned as a string: Lua numbers would be truncated.
+var tokenBucket = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local cost = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(bucket[1]) or capacity
+local ts = tonumber(bucket[2]) or now
+if now > ts then
+	tokens = math.min(capacity, tokens + (now - ts) * capacity / 60000)
+end
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - cost
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], 60000)
+return {allowed, tostring(tokens)}
+`)
+
+func takeRedis(ctx context.Context, client redis.UniversalClient, key string, limit, cost int) (decision, error) {
+	// A slow Redis must not hold up every request.
+	ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+
+	res, err := tokenBucket.Run(ctx, client, []string{key}, limit, cost).Slice()
+	if err != nil {
+		return decision{}, err
+	}
+	allowed, _ := res[0].(int64)
+	s, _ := res[1].(string)
+	tokens, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return decision{}, err
+	}
+	return newDecision(allowed == 1, tokens, limit), nil
+}
+
+// localBuckets are token buckets in process memory, used without Redis.
+type localBuckets struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newLocalBuckets() *localBuckets {
+	return &localBuckets{buckets: make(map[string]*bucket), lastSweep: time.Now()}
+}
+
+func (l *localBuckets) take(key string, limit, cost int, now time.Time) decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	perToken := time.Minute / time.Duration(limit)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(limit), b.tokens+float64(now.Sub(b.last))/float64(perToken))
+	b.last = now
+
+	if b.tokens < 1 {
+		return newDecision(false, b.tokens, limit)
+	}
+	b.tokens -= float64(cost)
+	return newDecision(true, b.tokens, limit)
+}
+
+// sweep drops buckets idle for over a minute; they would be full again anyway.
+func (l *localBuckets) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > time.Minute {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
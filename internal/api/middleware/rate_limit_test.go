@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	tests := []struct {
+		name   string
+		remote string
+		xff    []string
+		want   string
+	}{
+		{"direct", "203.0.113.7:5000", nil, "203.0.113.7"},
+		{"untrusted peer ignores header", "203.0.113.7:5000", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"trusted proxy", "10.0.0.2:5000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"spoofed left hops", "10.0.0.2:5000", []string{"1.2.3.4, 198.51.100.1, 10.0.0.3"}, "198.51.100.1"},
+		{"split headers", "10.0.0.2:5000", []string{"1.2.3.4", "198.51.100.1"}, "198.51.100.1"},
+		{"only proxies", "10.0.0.2:5000", []string{"10.0.0.3"}, "10.0.0.3"},
+		{"garbage hop", "10.0.0.2:5000", []string{"nonsense"}, "10.0.0.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remote
+			for _, v := range tt.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := clientIP(r, trusted); got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func serve(h http.Handler, method string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, "/api/books", nil)
+	r.RemoteAddr = "203.0.113.7:5000"
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestRateLimiterRoute(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	// An unreachable Redis falls back to in-process buckets.
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer client.Close()
+	l := NewRateLimiter(RateLimitOptions{
+		Default: Quota{Reads: 100, Writes: 100},
+		Routes:  map[string]Quota{"auth": {Reads: 0, Writes: 2}},
+	}, client, "test:ratelimit:")
+	h := l.Route("auth")(ok)
+
+	for i, remaining := range []string{"1", "0"} {
+		w := serve(h, http.MethodPost)
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d, want 200", i+1, w.Code)
+		}
+		if got := w.Header().Get("RateLimit-Remaining"); got != remaining {
+			t.Errorf("request %d: RateLimit-Remaining = %q, want %q", i+1, got, remaining)
+		}
+	}
+	w := serve(h, http.MethodPost)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("third write: status %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("Retry-After = %q, want 30", got)
+	}
+	if got := w.Header().Get("RateLimit-Limit"); got != "2" {
+		t.Errorf("RateLimit-Limit = %q, want 2", got)
+	}
+
+	// Reads on the route are unlimited; other routes keep their own buckets.
+	if w := serve(h, http.MethodGet); w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "" {
+		t.Errorf("unlimited read: status %d, RateLimit-Limit %q", w.Code, w.Header().Get("RateLimit-Limit"))
+	}
+	if w := serve(l.Route("books")(ok), http.MethodPost); w.Code != http.StatusOK {
+		t.Errorf("other route: status %d, want 200", w.Code)
+	}
+}
+
+// testRedisClient connects to REDIS_HOST:REDIS_PORT (localhost:6379 by
+// default) and skips the test when Redis is not reachable.
+func testRedisClient(t *testing.T) *redis.Client {
+	t.Helper()
+	host, port := os.Getenv("REDIS_HOST"), os.Getenv("REDIS_PORT")
+	if host == "" {
+		host = "localhost"
+	}
+	if port == "" {
+		port = "6379"
+	}
+	client := redis.NewClient(&redis.Options{Addr: net.JoinHostPort(host, port), Password: os.Getenv("REDIS_PASSWORD")})
+	t.Cleanup(func() { client.Close() })
+	if err := client.Ping(t.Context()).Err(); err != nil {
+		t.Skipf("redis not available: %v", err)
+	}
+	return client
+}
+
+// Deployments sharing a Redis database keep their buckets under their own
+// key prefix.
+func TestRateLimiterRedisKeyPrefix(t *testing.T) {
+	client := testRedisClient(t)
+	keys, _ := client.Keys(t.Context(), "test:rl:*").Result()
+	if len(keys) > 0 {
+		client.Del(t.Context(), keys...)
+	}
+	opts := RateLimitOptions{Routes: map[string]Quota{"auth": {Reads: 10, Writes: 1}}}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	a := NewRateLimiter(opts, client, "test:rl:a:")
+	b := NewRateLimiter(opts, client, "test:rl:b:")
+
+	if w := serve(a.Route("auth")(ok), http.MethodPost); w.Code != http.StatusOK {
+		t.Fatalf("first write on a: status %d", w.Code)
+	}
+	if w := serve(a.Route("auth")(ok), http.MethodPost); w.Code != http.StatusTooManyRequests {
+		t.Errorf("second write on a: status %d, want 429", w.Code)
+	}
+	if w := serve(b.Route("auth")(ok), http.MethodPost); w.Code != http.StatusOK {
+		t.Errorf("first write on b: status %d, want 200 from its own bucket", w.Code)
+	}
+
+	// Failures only checks the bucket until a request is rejected.
+	rejected := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusUnauthorized) })
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusUnauthorized, http.StatusTooManyRequests} {
+		h := a.Failures("auth")(ok)
+		if i >= 2 {
+			h = a.Failures("auth")(rejected)
+		}
+		if w := serve(h, http.MethodGet); w.Code != want {
+			t.Errorf("request %d through Failures: status %d, want %d", i+1, w.Code, want)
+		}
+	}
+
+	keys, err := client.Keys(t.Context(), "test:rl:*").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(keys)
+	want := []string{"test:rl:a:auth:failed:ip:203.0.113.7", "test:rl:a:auth:write:ip:203.0.113.7", "test:rl:b:auth:write:ip:203.0.113.7"}
+	if !slices.Equal(keys, want) {
+		t.Errorf("keys %q, want %q", keys, want)
+	}
+}
@@ -1,24 +1,23 @@
 package middleware
 
 import (
+	"libraryapi/internal/api/responses"
+	"libraryapi/internal/pkg/i18n"
+	"libraryapi/internal/pkg/logger"
 	"net/http"
 	"runtime/debug"
-
-	"github.com/rs/zerolog/log"
 )
 
 func Recovery(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
-				log.Error().
+				logger.Ctx(r.Context()).Error().
 					Interface("error", err).
-					Str("path", r.URL.Path).
-					Str("method", r.Method).
 					Bytes("stack", debug.Stack()).
 					Msg("Panic recovered")
 
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				responses.InternalError(w, r, i18n.Error("server.internal_error"))
 			}
 		}()
 
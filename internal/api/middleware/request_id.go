@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"libraryapi/internal/pkg/logger"
+	"libraryapi/internal/pkg/requestid"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+)
+
+// RequestID identifies every request by the X-Request-ID it came with or,
+// if it has none or an unusable one, a new random ID. The ID is echoed in
+// the response and carried in the request context together with a logger
+// that has the ID, method and path attached (see logger.Ctx). It runs
+// outside Logger and Recovery so their lines carry the ID too.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestid.Header)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+		w.Header().Set(requestid.Header, id)
+
+		ctx := requestid.NewContext(r.Context(), id)
+		l := log.Logger.With().
+			Ctx(ctx). // for the trace ID of the request's span
+			Str("request_id", id).
+			Str("method", r.Method).
+			Str("path", r.URL.Path).
+			Logger()
+		next.ServeHTTP(w, r.WithContext(logger.NewContext(ctx, &l)))
+	})
+}
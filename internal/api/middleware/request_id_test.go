@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"libraryapi/internal/api/responses"
+	"libraryapi/internal/pkg/logger"
+	"libraryapi/internal/pkg/requestid"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func TestRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	global := log.Logger
+	log.Logger = zerolog.New(&buf)
+	t.Cleanup(func() { log.Logger = global })
+
+	h := Chain(RequestID, Logger())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger.Update(r.Context(), func(c zerolog.Context) zerolog.Context { return c.Str("user", "ann") })
+		logger.Ctx(r.Context()).Warn().Msg("handler")
+		responses.WriteProblem(w, r, responses.NewProblem(r, http.StatusNotFound, "not_found", "No such book"))
+	}))
+
+	for _, tc := range []struct{ in, want string }{
+		{"client-7f3a:1", "client-7f3a:1"},
+		{"", ""},
+		{"bad id\n", ""},
+		{strings.Repeat("a", 129), ""},
+	} {
+		buf.Reset()
+		r := httptest.NewRequest(http.MethodGet, "/api/books/1", nil)
+		if tc.in != "" {
+			r.Header.Set(requestid.Header, tc.in)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		id := w.Header().Get(requestid.Header)
+		if tc.want != "" && id != tc.want || tc.want == "" && (id == tc.in || !requestid.Valid(id)) {
+			t.Errorf("X-Request-ID %q for incoming %q", id, tc.in)
+			continue
+		}
+		var body struct {
+			RequestID string `json:"request_id"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.RequestID != id {
+			t.Errorf("problem request_id %q, want %q (%v)", body.RequestID, id, err)
+		}
+		// Both the handler's line and the access log carry the request's
+		// fields, including the user added after the logger was created.
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("logged %d lines, want 2: %s", len(lines), buf.String())
+		}
+		for _, line := range lines {
+			var fields map[string]any
+			if err := json.Unmarshal([]byte(line), &fields); err != nil {
+				t.Fatal(err)
+			}
+			if fields["request_id"] != id || fields["method"] != "GET" || fields["path"] != "/api/books/1" || fields["user"] != "ann" {
+				t.Errorf("log line without the request's fields: %s", line)
+			}
+		}
+	}
+}
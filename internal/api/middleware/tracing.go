@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing starts a server span for every request, continuing the trace of
+// an incoming traceparent header. The span is named after the route the
+// request matched (see RecordRoute), so it must run outside the router.
+// It runs outside Logger too, so the access log carries the trace ID.
+func Tracing(provider trace.TracerProvider, propagator propagation.TextMapPropagator) Middleware {
+	tracer := provider.Tracer("libraryapi/internal/api/middleware")
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			ctx, span := tracer.Start(ctx, r.Method,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					semconv.HTTPRequestMethodKey.String(r.Method),
+					semconv.URLPath(r.URL.Path),
+					semconv.ClientAddress(r.RemoteAddr),
+					semconv.UserAgentOriginal(r.UserAgent()),
+				))
+			defer span.End()
+
+			rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			r, route := withRoute(r.WithContext(ctx))
+			next.ServeHTTP(rw, r)
+
+			if *route != "" {
+				span.SetName(r.Method + " " + *route)
+				span.SetAttributes(semconv.HTTPRoute(*route))
+			}
+			span.SetAttributes(semconv.HTTPResponseStatusCode(rw.statusCode))
+			if rw.statusCode >= 500 {
+				span.SetStatus(codes.Error, http.StatusText(rw.statusCode))
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	mux := http.NewServeMux()
+	var handlerSpan trace.SpanContext
+	mux.HandleFunc("/api/books/", func(w http.ResponseWriter, r *http.Request) {
+		handlerSpan = trace.SpanContextFromContext(r.Context())
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	h := Chain(Tracing(provider, propagation.TraceContext{}), Logger())(RecordRoute(mux))
+
+	r := httptest.NewRequest(http.MethodGet, "/api/books/1", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("ended %d spans, want 1", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "GET /api/books/" || span.SpanKind() != trace.SpanKindServer {
+		t.Errorf("span %q of kind %v, want server span GET /api/books/", span.Name(), span.SpanKind())
+	}
+	if got := span.Parent().SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("parent span %s, want the one from traceparent", got)
+	}
+	if got := span.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace %s, want the one from traceparent", got)
+	}
+	if handlerSpan.SpanID() != span.SpanContext().SpanID() {
+		t.Error("handler does not see the server span in its context")
+	}
+	attrs := attribute.NewSet(span.Attributes()...)
+	if v, _ := attrs.Value("http.response.status_code"); v.AsInt64() != http.StatusServiceUnavailable {
+		t.Errorf("status code attribute %v", v.Emit())
+	}
+	if v, _ := attrs.Value("http.route"); v.AsString() != "/api/books/" {
+		t.Errorf("route attribute %q", v.AsString())
+	}
+	if span.Status().Code.String() != "Error" {
+		t.Errorf("span status %v, want Error for a 503", span.Status().Code)
+	}
+}
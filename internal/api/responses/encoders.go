@@ -0,0 +1,213 @@
+package responses
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Encoder renders a response envelope in a particular media type.
+type Encoder interface {
+	Encode(w io.Writer, v interface{}) error
+}
+
+// EncoderFunc adapts a plain function to the Encoder interface.
+type EncoderFunc func(w io.Writer, v interface{}) error
+
+func (f EncoderFunc) Encode(w io.Writer, v interface{}) error {
+	return f(w, v)
+}
+
+// ErrNotEncodable is returned by an encoder that cannot represent the given
+// value, e.g. the CSV encoder for anything that is not a list.
+var ErrNotEncodable = errors.New("value cannot be represented in the requested format")
+
+type registeredEncoder struct {
+	mediaType string
+	encoder   Encoder
+}
+
+var (
+	encodersMu sync.RWMutex
+	encoders   []registeredEncoder
+)
+
+// Register makes an encoder available for content negotiation under the given
+// media type. Registering the same media type twice replaces the encoder.
+// Encoders registered first win when the client accepts several types equally.
+func Register(mediaType string, enc Encoder) {
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+	for i := range encoders {
+		if encoders[i].mediaType == mediaType {
+			encoders[i].encoder = enc
+			return
+		}
+	}
+	encoders = append(encoders, registeredEncoder{mediaType: mediaType, encoder: enc})
+}
+
+// MediaTypes lists the registered media types in preference order.
+func MediaTypes() []string {
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+	types := make([]string, 0, len(encoders))
+	for _, e := range encoders {
+		types = append(types, e.mediaType)
+	}
+	return types
+}
+
+func lookupEncoder(mediaType string) (Encoder, bool) {
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+	for _, e := range encoders {
+		if e.mediaType == mediaType {
+			return e.encoder, true
+		}
+	}
+	return nil, false
+}
+
+func init() {
+	Register(MediaTypeJSON, EncoderFunc(encodeJSON))
+	Register("application/xml", EncoderFunc(encodeXML))
+	Register("text/xml", EncoderFunc(encodeXML))
+	Register("text/csv", EncoderFunc(encodeCSV))
+	Register("application/msgpack", EncoderFunc(encodeMsgpack))
+	Register("application/x-msgpack", EncoderFunc(encodeMsgpack))
+	Register("application/vnd.msgpack", EncoderFunc(encodeMsgpack))
+}
+
+func encodeJSON(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+func encodeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	if err := xml.NewEncoder(w).Encode(v); err != nil {
+		var unsupported *xml.UnsupportedTypeError
+		if errors.As(err, &unsupported) {
+			return fmt.Errorf("%w: %v", ErrNotEncodable, err)
+		}
+		return err
+	}
+	return nil
+}
+
+func encodeMsgpack(w io.Writer, v interface{}) error {
+	enc := msgpack.NewEncoder(w)
+	enc.SetCustomStructTag("json")
+	return enc.Encode(v)
+}
+
+// Lister is implemented by payloads that wrap a list of records, such as a
+// paginated page, so list-only formats like CSV can reach the rows.
+type Lister interface {
+	Items() interface{}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// encodeCSV writes a list of structs as CSV with one header row. Column names
+// come from the `csv` tag, falling back to the `json` tag and the field name.
+func encodeCSV(w io.Writer, v interface{}) error {
+	if resp, ok := v.(Response); ok {
+		v = resp.Data
+	}
+	if l, ok := v.(Lister); ok {
+		v = l.Items()
+	}
+
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() || (rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array) {
+		return ErrNotEncodable
+	}
+	elem := rv.Type().Elem()
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	if elem.Kind() != reflect.Struct || elem == timeType {
+		return ErrNotEncodable
+	}
+
+	var (
+		header  []string
+		indexes []int
+	)
+	for i := 0; i < elem.NumField(); i++ {
+		f := elem.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := csvColumn(f)
+		if name == "-" {
+			continue
+		}
+		header = append(header, name)
+		indexes = append(indexes, i)
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	record := make([]string, len(indexes))
+	for i := 0; i < rv.Len(); i++ {
+		item := rv.Index(i)
+		if item.Kind() == reflect.Ptr {
+			if item.IsNil() {
+				continue
+			}
+			item = item.Elem()
+		}
+		for j, idx := range indexes {
+			record[j] = csvValue(item.Field(idx))
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func csvColumn(f reflect.StructField) string {
+	for _, key := range []string{"csv", "json"} {
+		if tag, ok := f.Tag.Lookup(key); ok {
+			if name, _, _ := strings.Cut(tag, ","); name != "" {
+				return name
+			}
+		}
+	}
+	return f.Name
+}
+
+func csvValue(v reflect.Value) string {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(time.RFC3339)
+	}
+	return fmt.Sprint(v.Interface())
+}
@@ -0,0 +1,172 @@
+package responses
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type testBook struct {
+	ID        string     `json:"id" xml:"id"`
+	Title     string     `json:"title" xml:"title"`
+	Year      int        `json:"year" xml:"year"`
+	Hidden    string     `json:"-" xml:"-" csv:"-"`
+	Shelf     *string    `json:"shelf,omitempty" xml:"shelf,omitempty" csv:"shelf_code"`
+	CreatedAt time.Time  `json:"created_at" xml:"created_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty" xml:"deleted_at,omitempty"`
+	secret    string
+}
+
+// page wraps a list like the paginated book list does.
+type page struct {
+	Books []testBook `json:"books" xml:"books>book"`
+	Total int        `json:"total" xml:"total"`
+}
+
+func (p page) Items() interface{} { return p.Books }
+
+func testBooks() []testBook {
+	shelf := "A-1"
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	return []testBook{
+		{ID: "1", Title: "Dune", Year: 1965, Hidden: "x", Shelf: &shelf, CreatedAt: created, secret: "s"},
+		{ID: "2", Title: `Comma, "Quoted"`, Year: 1999},
+	}
+}
+
+func encodeWith(t *testing.T, mediaType string, v interface{}) []byte {
+	t.Helper()
+	body, err := encode(mediaType, v)
+	if err != nil {
+		t.Fatalf("encode %s: %v", mediaType, err)
+	}
+	return body
+}
+
+func TestEncodeJSON(t *testing.T) {
+	body := encodeWith(t, MediaTypeJSON, Response{Success: true, Data: testBooks()})
+	var got struct {
+		Success bool       `json:"success"`
+		Data    []testBook `json:"data"`
+	}
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Success || len(got.Data) != 2 || got.Data[0].Title != "Dune" || got.Data[0].Hidden != "" {
+		t.Errorf("decoded %+v from %s", got, body)
+	}
+}
+
+func TestEncodeXML(t *testing.T) {
+	body := encodeWith(t, "application/xml", Response{Success: true, Data: page{Books: testBooks(), Total: 2}})
+	if !bytes.HasPrefix(body, []byte(xml.Header)) {
+		t.Errorf("no XML declaration: %s", body)
+	}
+	var got struct {
+		XMLName xml.Name `xml:"response"`
+		Success bool     `xml:"success"`
+		Titles  []string `xml:"data>books>book>title"`
+		Total   int      `xml:"data>total"`
+	}
+	if err := xml.Unmarshal(body, &got); err != nil {
+		t.Fatalf("%v\n%s", err, body)
+	}
+	if !got.Success || got.Total != 2 || len(got.Titles) != 2 || got.Titles[1] != `Comma, "Quoted"` {
+		t.Errorf("decoded %+v from %s", got, body)
+	}
+
+	// Maps have no XML form.
+	if _, err := encode("application/xml", map[string]int{"a": 1}); !errors.Is(err, ErrNotEncodable) {
+		t.Errorf("encode map as XML error = %v, want ErrNotEncodable", err)
+	}
+}
+
+func TestEncodeMsgpack(t *testing.T) {
+	for _, mediaType := range []string{"application/msgpack", "application/x-msgpack", "application/vnd.msgpack"} {
+		body := encodeWith(t, mediaType, Response{Success: true, Message: "ok", Data: testBooks()})
+		var got map[string]interface{}
+		if err := msgpack.Unmarshal(body, &got); err != nil {
+			t.Fatal(err)
+		}
+		// Field names follow the json tags.
+		books, _ := got["data"].([]interface{})
+		if got["success"] != true || got["message"] != "ok" || len(books) != 2 {
+			t.Fatalf("%s: decoded %v", mediaType, got)
+		}
+		if first, _ := books[0].(map[string]interface{}); first["title"] != "Dune" || first["Hidden"] != nil {
+			t.Errorf("%s: first book %v", mediaType, first)
+		}
+	}
+}
+
+func TestEncodeCSV(t *testing.T) {
+	want := "id,title,year,shelf_code,created_at,deleted_at\n" +
+		"1,Dune,1965,A-1,2024-05-01T12:00:00Z,\n" +
+		"2,\"Comma, \"\"Quoted\"\"\",1999,,,\n"
+	for name, v := range map[string]interface{}{
+		"slice":                 testBooks(),
+		"pointers":              []*testBook{&testBooks()[0], nil, &testBooks()[1]},
+		"envelope":              Response{Success: true, Data: testBooks()},
+		"paginated in envelope": Response{Success: true, Data: page{Books: testBooks(), Total: 2}},
+	} {
+		if got := string(encodeWith(t, "text/csv", v)); got != want {
+			t.Errorf("%s:\n%s\nwant\n%s", name, got, want)
+		}
+	}
+
+	if got := string(encodeWith(t, "text/csv", []testBook{})); got != "id,title,year,shelf_code,created_at,deleted_at\n" {
+		t.Errorf("empty list: %q, want only the header", got)
+	}
+	for name, v := range map[string]interface{}{
+		"single record": testBooks()[0],
+		"list of times": []time.Time{time.Now()},
+		"list of ints":  []int{1, 2},
+		"nil":           nil,
+		"empty data":    Response{Success: true},
+	} {
+		if _, err := encode("text/csv", v); !errors.Is(err, ErrNotEncodable) {
+			t.Errorf("%s: error = %v, want ErrNotEncodable", name, err)
+		}
+	}
+}
+
+// CSV cannot carry a single record or an error: a single record is 406, an
+// error falls back to JSON so the client still sees it.
+func TestRenderCSVFallbacks(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/books/1", nil)
+	r.Header.Set("Accept", "text/csv")
+
+	w := httptest.NewRecorder()
+	Render(w, r, http.StatusOK, Response{Success: true, Data: testBooks()[0]})
+	if w.Code != http.StatusNotAcceptable {
+		t.Errorf("single record as CSV: status %d, want 406", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	NotFound(w, r, errors.New("book not found"))
+	if w.Code != http.StatusNotFound || w.Header().Get("Content-Type") != MediaTypeProblemJSON {
+		t.Errorf("error as CSV: status %d, Content-Type %q; want 404 problem+json", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	w = httptest.NewRecorder()
+	Render(w, r, http.StatusOK, Response{Success: true, Data: testBooks()})
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/csv" || !strings.HasPrefix(w.Body.String(), "id,title") {
+		t.Errorf("list as CSV: status %d, Content-Type %q, body %q", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+}
+
+func TestRegisterReplaces(t *testing.T) {
+	before := len(MediaTypes())
+	Register(" TEXT/CSV ", EncoderFunc(encodeCSV))
+	if len(MediaTypes()) != before {
+		t.Errorf("registering text/csv again added a media type: %q", MediaTypes())
+	}
+}
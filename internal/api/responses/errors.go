@@ -0,0 +1,67 @@
+package responses
+
+import (
+	"context"
+	"errors"
+	"libraryapi/internal/domain"
+	"libraryapi/internal/pkg/i18n"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+)
+
+type errorMapping struct {
+	status int
+	code   string
+	key    string // message key suffix, looked up as "<entity>.<key>" then "error.<key>"
+}
+
+var domainErrors = map[error]errorMapping{
+	domain.ErrNotFound:    {http.StatusNotFound, "NOT_FOUND", "not_found"},
+	domain.ErrConflict:    {http.StatusConflict, "CONFLICT", "conflict"},
+	domain.ErrValidation:  {http.StatusBadRequest, "VALIDATION_FAILED", "validation"},
+	domain.ErrUnavailable: {http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "unavailable"},
+}
+
+// StatusClientClosedRequest is recorded for requests whose client went away
+// before they were served. Nothing reads the response; the status only keeps
+// them apart from server errors in logs and metrics.
+const StatusClientClosedRequest = 499
+
+// FromError is the single place where domain errors become HTTP responses:
+// not found is 404, conflict 409, validation 400 and unavailable 503. A
+// missed context deadline counts as unavailable, a canceled context as
+// StatusClientClosedRequest without a body. Anything else is an internal
+// error; its text is never sent to the client.
+func FromError(w http.ResponseWriter, r *http.Request, err error) error {
+	var verrs validator.ValidationErrors
+	if errors.As(err, &verrs) {
+		return ValidationFailed(w, r, err)
+	}
+
+	if errors.Is(err, context.Canceled) {
+		w.WriteHeader(StatusClientClosedRequest)
+		return nil
+	}
+	kind := domain.Kind(err)
+	if kind == nil && errors.Is(err, context.DeadlineExceeded) {
+		kind = domain.ErrUnavailable
+	}
+	m, ok := domainErrors[kind]
+	if !ok {
+		return InternalError(w, r, i18n.Error("server.internal_error"))
+	}
+
+	lang := i18n.FromRequest(r)
+	detail, found := "", false
+	if entity := domain.EntityOf(err); entity != "" {
+		detail, found = i18n.Lookup(lang, entity+"."+m.key)
+	}
+	if !found {
+		detail = i18n.T(lang, "error."+m.key)
+	}
+	if m.status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", "5")
+	}
+	return WriteProblem(w, r, NewProblem(r, m.status, m.code, detail))
+}
@@ -0,0 +1,91 @@
+package responses
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"libraryapi/internal/api/dto"
+	"libraryapi/internal/domain"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFromError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		lang       string
+		wantStatus int
+		wantCode   string
+		wantDetail string
+	}{
+		{"entity not found", domain.NotFound("book", "get book"), "en",
+			http.StatusNotFound, "NOT_FOUND", "book not found"},
+		{"localized entity message", domain.NotFound("book", "get book"), "ru",
+			http.StatusNotFound, "NOT_FOUND", "книга не найдена"},
+		{"conflict", domain.NewError(domain.ErrConflict, "book", "create book", errors.New("duplicate key")), "en",
+			http.StatusConflict, "CONFLICT", "a book with this ID already exists"},
+		{"entity without a message falls back to the kind", domain.NewError(domain.ErrValidation, "shelf", "", nil), "en",
+			http.StatusBadRequest, "VALIDATION_FAILED", "invalid data"},
+		{"wrapped sentinel", fmt.Errorf("list books: %w", domain.ErrUnavailable), "en",
+			http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "service temporarily unavailable, please retry later"},
+		{"missed deadline", fmt.Errorf("list books: %w", context.DeadlineExceeded), "en",
+			http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "service temporarily unavailable, please retry later"},
+		{"unclassified", errors.New("pq: relation \"books\" does not exist"), "en",
+			http.StatusInternalServerError, "INTERNAL_ERROR", "internal server error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/books/1", nil)
+			r.Header.Set("Accept-Language", tt.lang)
+			w := httptest.NewRecorder()
+			if err := FromError(w, r, tt.err); err != nil {
+				t.Fatal(err)
+			}
+
+			var p Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+				t.Fatal(err)
+			}
+			if w.Code != tt.wantStatus || p.Code != tt.wantCode || p.Detail != tt.wantDetail {
+				t.Errorf("got %d %s %q, want %d %s %q", w.Code, p.Code, p.Detail, tt.wantStatus, tt.wantCode, tt.wantDetail)
+			}
+			retry := w.Header().Get("Retry-After")
+			if wantRetry := tt.wantStatus == http.StatusServiceUnavailable; (retry != "") != wantRetry {
+				t.Errorf("Retry-After %q", retry)
+			}
+		})
+	}
+}
+
+func TestFromErrorValidator(t *testing.T) {
+	req := dto.CreateBookRequest{Author: "Herbert", Year: 1965}
+	err := fmt.Errorf("create book: %w", req.Validate())
+	r := httptest.NewRequest(http.MethodPost, "/api/books", nil)
+	w := httptest.NewRecorder()
+	FromError(w, r, err)
+
+	var p Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusBadRequest || p.Code != "VALIDATION_FAILED" || len(p.Errors) != 1 || p.Errors[0].Field != "title" {
+		t.Errorf("got %d %+v, want 400 with a title field error", w.Code, p)
+	}
+}
+
+// A canceled request has no one to answer: it gets no body and is not
+// reported as a server error.
+func TestFromErrorCanceled(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/books", nil)
+	w := httptest.NewRecorder()
+	err := domain.NewError(domain.ErrUnavailable, "book", "list books", context.Canceled)
+	if err := FromError(w, r, fmt.Errorf("list books: %w", err)); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != StatusClientClosedRequest || w.Body.Len() != 0 {
+		t.Errorf("got %d %q, want %d without a body", w.Code, w.Body.String(), StatusClientClosedRequest)
+	}
+}
@@ -0,0 +1,103 @@
+package responses
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const MediaTypeJSON = "application/json"
+
+type mediaRange struct {
+	typ     string
+	subtype string
+	q       float64
+	order   int
+}
+
+func (m mediaRange) specificity() int {
+	switch {
+	case m.typ == "*":
+		return 0
+	case m.subtype == "*":
+		return 1
+	default:
+		return 2
+	}
+}
+
+func (m mediaRange) matches(mediaType string) bool {
+	typ, subtype, _ := strings.Cut(mediaType, "/")
+	return (m.typ == "*" || m.typ == typ) && (m.subtype == "*" || m.subtype == subtype)
+}
+
+// parseAccept splits an Accept header into media ranges ordered by
+// preference: quality first, then specificity, then position in the header.
+func parseAccept(header string) []mediaRange {
+	var ranges []mediaRange
+	for i, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		typ, subtype, ok := strings.Cut(strings.ToLower(strings.TrimSpace(params[0])), "/")
+		if !ok || typ == "" || subtype == "" {
+			continue
+		}
+		r := mediaRange{typ: typ, subtype: subtype, q: 1, order: i}
+		for _, p := range params[1:] {
+			k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+			if strings.EqualFold(k, "q") {
+				if q, err := strconv.ParseFloat(v, 64); err == nil {
+					r.q = q
+				}
+			}
+		}
+		ranges = append(ranges, r)
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].q != ranges[j].q {
+			return ranges[i].q > ranges[j].q
+		}
+		if ranges[i].specificity() != ranges[j].specificity() {
+			return ranges[i].specificity() > ranges[j].specificity()
+		}
+		return ranges[i].order < ranges[j].order
+	})
+	return ranges
+}
+
+// Negotiate picks the registered media type that best satisfies the request's
+// Accept header. A missing header selects JSON. It returns false when none of
+// the registered encoders is acceptable to the client.
+func Negotiate(r *http.Request) (string, bool) {
+	header := ""
+	if r != nil {
+		header = strings.TrimSpace(r.Header.Get("Accept"))
+	}
+	if header == "" {
+		return MediaTypeJSON, true
+	}
+
+	available := MediaTypes()
+	ranges := parseAccept(header)
+
+	// Media types explicitly refused with q=0 must not be picked by a wildcard.
+	refused := make(map[string]bool)
+	for _, m := range ranges {
+		if m.q <= 0 && m.specificity() == 2 {
+			refused[m.typ+"/"+m.subtype] = true
+		}
+	}
+
+	for _, m := range ranges {
+		if m.q <= 0 {
+			continue
+		}
+		for _, mediaType := range available {
+			if m.matches(mediaType) && !refused[mediaType] {
+				return mediaType, true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,77 @@
+package responses
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string // "" when nothing is acceptable
+	}{
+		{"", MediaTypeJSON},
+		{"application/json", MediaTypeJSON},
+		{"APPLICATION/XML", "application/xml"},
+		{"text/csv", "text/csv"},
+		{"application/msgpack", "application/msgpack"},
+		{"*/*", MediaTypeJSON},
+		{"text/*", "text/xml"},
+		{"application/xml;q=0.5, text/csv", "text/csv"},
+		{"text/csv;q=0.2, application/xml;q=0.8", "application/xml"},
+		// Equal quality: the more specific range wins, then header order.
+		{"*/*, text/csv", "text/csv"},
+		{"text/csv, application/xml", "text/csv"},
+		{"application/xml, text/csv", "application/xml"},
+		// q=0 refuses a type even when a wildcard would match it.
+		{"application/json;q=0, */*", "application/xml"},
+		{"application/json;q=0, application/*;q=0.5", "application/xml"},
+		{"text/html, application/xhtml+xml;q=0.9, */*;q=0.8", MediaTypeJSON},
+		// Malformed ranges are skipped, a malformed q keeps the default 1.
+		{"json, text/csv;q=abc", "text/csv"},
+		{"image/png", ""},
+		{"text/html, image/*", ""},
+		{"*/*;q=0", ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/api/books", nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+		got, ok := Negotiate(r)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("Negotiate(%q) = %q, %t; want %q", tt.accept, got, ok, tt.want)
+		}
+	}
+}
+
+func TestRenderNotAcceptable(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/books", nil)
+	r.Header.Set("Accept", "image/png")
+	w := httptest.NewRecorder()
+	if err := Render(w, r, http.StatusOK, Response{Success: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Code != http.StatusNotAcceptable {
+		t.Fatalf("status %d, want 406", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != MediaTypeProblemJSON {
+		t.Errorf("Content-Type %q, want %s", ct, MediaTypeProblemJSON)
+	}
+	var p Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	for _, mediaType := range MediaTypes() {
+		if !strings.Contains(p.Detail, mediaType) {
+			t.Errorf("detail %q does not list %s", p.Detail, mediaType)
+		}
+	}
+	if vary := w.Header().Values("Vary"); len(vary) == 0 || vary[0] != "Accept" {
+		t.Errorf("Vary %q, want Accept first", vary)
+	}
+}
@@ -0,0 +1,114 @@
+package responses
+
+import (
+	"encoding/xml"
+	"errors"
+	"libraryapi/internal/api/dto"
+	"libraryapi/internal/pkg/i18n"
+	"libraryapi/internal/pkg/requestid"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	MediaTypeProblemJSON = "application/problem+json"
+	MediaTypeProblemXML  = "application/problem+xml"
+
+	problemTypePrefix = "urn:library-api:problem:"
+)
+
+// Problem is an RFC 7807 problem details document.
+type Problem struct {
+	XMLName   xml.Name     `json:"-" msgpack:"-" xml:"urn:ietf:rfc:7807 problem"`
+	Type      string       `json:"type" xml:"type"`
+	Title     string       `json:"title" xml:"title"`
+	Status    int          `json:"status" xml:"status"`
+	Detail    string       `json:"detail,omitempty" xml:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty" xml:"instance,omitempty"`
+	Code      string       `json:"code,omitempty" xml:"code,omitempty"`
+	RequestID string       `json:"request_id,omitempty" xml:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty" xml:"errors>error,omitempty"`
+}
+
+// FieldError describes a single invalid field of a request body.
+type FieldError struct {
+	Field   string `json:"field" xml:"field"`
+	Rule    string `json:"rule" xml:"rule"`
+	Param   string `json:"param,omitempty" xml:"param,omitempty"`
+	Message string `json:"message" xml:"message"`
+}
+
+// NewProblem builds a problem document for the request. The type URI is
+// derived from code, e.g. NOT_FOUND becomes urn:library-api:problem:not-found.
+// The title is localized from the request's Accept-Language; detail is
+// expected to be localized by the caller.
+func NewProblem(r *http.Request, statusCode int, code string, detail string) Problem {
+	title, ok := i18n.Lookup(i18n.FromRequest(r), "status."+strconv.Itoa(statusCode))
+	if !ok {
+		title = http.StatusText(statusCode)
+	}
+	p := Problem{
+		Type:   "about:blank",
+		Title:  title,
+		Status: statusCode,
+		Detail: detail,
+		Code:   code,
+	}
+	if code != "" {
+		p.Type = problemTypePrefix + strings.ReplaceAll(strings.ToLower(code), "_", "-")
+	}
+	if r != nil {
+		p.Instance = r.URL.Path
+		p.RequestID = requestid.FromContext(r.Context())
+	}
+	return p
+}
+
+// WriteProblem renders p with a problem+json (or problem+xml) content type.
+func WriteProblem(w http.ResponseWriter, r *http.Request, p Problem) error {
+	return render(w, r, p.Status, p, problemContentType)
+}
+
+func problemContentType(mediaType string) string {
+	switch mediaType {
+	case MediaTypeJSON:
+		return MediaTypeProblemJSON
+	case "application/xml", "text/xml":
+		return MediaTypeProblemXML
+	default:
+		return mediaType
+	}
+}
+
+// ValidationFailed reports the fields rejected by the validator. Errors that
+// did not come from the validator are reported as a plain bad request.
+func ValidationFailed(w http.ResponseWriter, r *http.Request, err error) error {
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return BadRequest(w, r, err)
+	}
+
+	lang := i18n.FromRequest(r)
+	p := NewProblem(r, http.StatusBadRequest, "VALIDATION_FAILED", i18n.T(lang, "request.validation_failed"))
+	for _, fe := range verrs {
+		p.Errors = append(p.Errors, FieldError{
+			Field:   fieldPath(fe),
+			Rule:    fe.Tag(),
+			Param:   fe.Param(),
+			Message: dto.FieldMessage(fe, lang),
+		})
+	}
+	return WriteProblem(w, r, p)
+}
+
+// fieldPath drops the top-level struct name from the namespace, leaving the
+// JSON path of the field (the validator reports JSON names, see dto).
+func fieldPath(fe validator.FieldError) string {
+	if _, path, ok := strings.Cut(fe.Namespace(), "."); ok {
+		return path
+	}
+	return fe.Field()
+}
@@ -0,0 +1,126 @@
+package responses
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"libraryapi/internal/api/dto"
+	"libraryapi/internal/pkg/requestid"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteProblem(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/books/42", nil)
+	r = r.WithContext(requestid.NewContext(r.Context(), "req-1"))
+	r.Header.Set("Accept-Language", "ru")
+	w := httptest.NewRecorder()
+	if err := NotFound(w, r, errors.New("book 42 not found")); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Code != http.StatusNotFound || w.Header().Get("Content-Type") != MediaTypeProblemJSON {
+		t.Fatalf("status %d, Content-Type %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if w.Header().Get("Content-Language") != "ru" {
+		t.Errorf("Content-Language %q, want ru", w.Header().Get("Content-Language"))
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"type":       "urn:library-api:problem:not-found",
+		"title":      "Не найдено",
+		"status":     float64(404),
+		"detail":     "book 42 not found",
+		"instance":   "/api/books/42",
+		"code":       "NOT_FOUND",
+		"request_id": "req-1",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+	if _, ok := got["errors"]; ok {
+		t.Error("errors present without field errors")
+	}
+}
+
+func TestWriteProblemXML(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/books/42", nil)
+	r.Header.Set("Accept", "application/xml")
+	w := httptest.NewRecorder()
+	WriteProblem(w, r, NewProblem(r, http.StatusConflict, "CONFLICT", "taken"))
+
+	if ct := w.Header().Get("Content-Type"); ct != MediaTypeProblemXML {
+		t.Errorf("Content-Type %q, want %s", ct, MediaTypeProblemXML)
+	}
+	var got struct {
+		XMLName xml.Name
+		Status  int    `xml:"status"`
+		Title   string `xml:"title"`
+	}
+	if err := xml.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.XMLName.Space != "urn:ietf:rfc:7807" || got.XMLName.Local != "problem" || got.Status != 409 || got.Title != "Conflict" {
+		t.Errorf("decoded %+v from %s", got, w.Body.String())
+	}
+}
+
+func TestNewProblem(t *testing.T) {
+	tests := []struct {
+		status    int
+		code      string
+		wantType  string
+		wantTitle string
+	}{
+		{http.StatusBadRequest, "VALIDATION_FAILED", "urn:library-api:problem:validation-failed", "Bad Request"},
+		{http.StatusTooManyRequests, "RATE_LIMITED", "urn:library-api:problem:rate-limited", "Too Many Requests"},
+		{http.StatusTeapot, "", "about:blank", "I'm a teapot"}, // no catalog title
+	}
+	for _, tt := range tests {
+		p := NewProblem(nil, tt.status, tt.code, "")
+		if p.Type != tt.wantType || p.Title != tt.wantTitle || p.Status != tt.status || p.Instance != "" {
+			t.Errorf("NewProblem(%d, %q) = %+v", tt.status, tt.code, p)
+		}
+	}
+}
+
+func TestValidationFailed(t *testing.T) {
+	req := dto.CreateBookRequest{Title: "Dune", Year: 3000}
+	err := req.Validate()
+
+	r := httptest.NewRequest(http.MethodPost, "/api/books", nil)
+	w := httptest.NewRecorder()
+	ValidationFailed(w, r, err)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400", w.Code)
+	}
+	var p Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Code != "VALIDATION_FAILED" || len(p.Errors) != 2 {
+		t.Fatalf("problem %+v", p)
+	}
+	author, year := p.Errors[0], p.Errors[1]
+	if author.Field != "author" || author.Rule != "required" || author.Message == "" {
+		t.Errorf("author error %+v", author)
+	}
+	if year.Field != "year" || year.Rule != "max" || year.Param != "2026" {
+		t.Errorf("year error %+v", year)
+	}
+
+	// Errors not from the validator are a plain bad request.
+	w = httptest.NewRecorder()
+	ValidationFailed(w, r, errors.New("invalid JSON"))
+	var plain Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &plain); err != nil || plain.Code != "BAD_REQUEST" || plain.Errors != nil {
+		t.Errorf("problem %+v, %v; want BAD_REQUEST without field errors", plain, err)
+	}
+}
@@ -1,72 +1,150 @@
 package responses
 
 import (
-	"encoding/json"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"libraryapi/internal/pkg/i18n"
 	"net/http"
+	"strings"
 )
 
 type Response struct {
-	Success bool        `json:"success"`
-	Message string      `json:"message,omitempty"`
-	Data    interface{} `json:"data,omitempty"`
-	Error   string      `json:"error,omitempty"`
+	XMLName xml.Name    `json:"-" msgpack:"-" xml:"response"`
+	Success bool        `json:"success" xml:"success"`
+	Message string      `json:"message,omitempty" xml:"message,omitempty"`
+	Data    interface{} `json:"data,omitempty" xml:"data,omitempty"`
+	Error   string      `json:"error,omitempty" xml:"error,omitempty"`
 }
 
-type ErrorResponse struct {
-	Success bool   `json:"success"`
-	Error   string `json:"error"`
-	Code    string `json:"code,omitempty"`
+// Render encodes data in the media type negotiated from the request's Accept
+// header. Clients that accept none of the registered types get 406. Error
+// envelopes that the negotiated format cannot represent fall back to JSON so
+// the client still learns what went wrong.
+func Render(w http.ResponseWriter, r *http.Request, statusCode int, data interface{}) error {
+	return render(w, r, statusCode, data, nil)
 }
 
-func JSON(w http.ResponseWriter, statusCode int, data interface{}) error {
-	w.Header().Set("Content-Type", "application/json")
+// render is Render with an optional hook that adjusts the Content-Type for
+// the negotiated media type, used for problem documents.
+func render(w http.ResponseWriter, r *http.Request, statusCode int, data interface{}, contentType func(string) string) error {
+	w.Header().Add("Vary", "Accept")
+	w.Header().Add("Vary", "Accept-Language")
+
+	mediaType, ok := Negotiate(r)
+	if !ok {
+		return notAcceptable(w, r)
+	}
+
+	body, err := encode(mediaType, data)
+	if errors.Is(err, ErrNotEncodable) {
+		if statusCode < http.StatusBadRequest {
+			return notAcceptable(w, r)
+		}
+		mediaType = MediaTypeJSON
+		body, err = encode(mediaType, data)
+	}
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return err
+	}
+
+	if contentType != nil {
+		mediaType = contentType(mediaType)
+	}
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("Content-Language", i18n.FromRequest(r))
 	w.WriteHeader(statusCode)
-	return json.NewEncoder(w).Encode(data)
+	_, err = w.Write(body)
+	return err
+}
+
+func encode(mediaType string, data interface{}) ([]byte, error) {
+	enc, ok := lookupEncoder(mediaType)
+	if !ok {
+		return nil, fmt.Errorf("no encoder registered for %s", mediaType)
+	}
+	var buf bytes.Buffer
+	if err := enc.Encode(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
 }
 
-func Success(w http.ResponseWriter, data interface{}, message string) error {
+func notAcceptable(w http.ResponseWriter, r *http.Request) error {
+	p := NewProblem(r, http.StatusNotAcceptable, "NOT_ACCEPTABLE",
+		i18n.T(i18n.FromRequest(r), "request.not_acceptable", strings.Join(MediaTypes(), ", ")))
+	body, err := encode(MediaTypeJSON, p)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", MediaTypeProblemJSON)
+	w.WriteHeader(http.StatusNotAcceptable)
+	_, err = w.Write(body)
+	return err
+}
+
+// Success wraps data in the standard envelope. message is a catalog key and
+// is translated to the request's language.
+func Success(w http.ResponseWriter, r *http.Request, data interface{}, message string) error {
+	if message != "" {
+		message = i18n.T(i18n.FromRequest(r), message)
+	}
 	response := Response{
 		Success: true,
 		Data:    data,
 		Message: message,
 	}
-	return JSON(w, http.StatusOK, response)
+	return Render(w, r, http.StatusOK, response)
+}
+
+// Error reports err as a problem document. Errors built with i18n.Error are
+// translated to the request's language; other errors are sent verbatim.
+func Error(w http.ResponseWriter, r *http.Request, statusCode int, err error, code string) error {
+	return WriteProblem(w, r, NewProblem(r, statusCode, code, localize(r, err)))
 }
 
-func Error(w http.ResponseWriter, statusCode int, err error, code string) error {
-	response := ErrorResponse{
-		Success: false,
-		Error:   err.Error(),
-		Code:    code,
+func localize(r *http.Request, err error) string {
+	var msg *i18n.Message
+	if errors.As(err, &msg) {
+		return msg.Localize(i18n.FromRequest(r))
 	}
-	return JSON(w, statusCode, response)
+	return err.Error()
+}
+
+func BadRequest(w http.ResponseWriter, r *http.Request, err error) error {
+	return Error(w, r, http.StatusBadRequest, err, "BAD_REQUEST")
+}
+
+func NotFound(w http.ResponseWriter, r *http.Request, err error) error {
+	return Error(w, r, http.StatusNotFound, err, "NOT_FOUND")
 }
 
-func BadRequest(w http.ResponseWriter, err error) error {
-	return Error(w, http.StatusBadRequest, err, "BAD_REQUEST")
+func InternalError(w http.ResponseWriter, r *http.Request, err error) error {
+	return Error(w, r, http.StatusInternalServerError, err, "INTERNAL_ERROR")
 }
 
-func NotFound(w http.ResponseWriter, err error) error {
-	return Error(w, http.StatusNotFound, err, "NOT_FOUND")
+func Unauthorized(w http.ResponseWriter, r *http.Request, err error) error {
+	return Error(w, r, http.StatusUnauthorized, err, "UNAUTHORIZED")
 }
 
-func InternalError(w http.ResponseWriter, err error) error {
-	return Error(w, http.StatusInternalServerError, err, "INTERNAL_ERROR")
+func Forbidden(w http.ResponseWriter, r *http.Request, err error) error {
+	return Error(w, r, http.StatusForbidden, err, "FORBIDDEN")
 }
 
-func Unauthorized(w http.ResponseWriter, err error) error {
-	return Error(w, http.StatusUnauthorized, err, "UNAUTHORIZED")
+func TooManyRequests(w http.ResponseWriter, r *http.Request, err error) error {
+	return Error(w, r, http.StatusTooManyRequests, err, "RATE_LIMITED")
 }
 
-func MethodNotAllowed(w http.ResponseWriter) error {
-	err := &apiError{message: "Method not allowed"}
-	return Error(w, http.StatusMethodNotAllowed, err, "METHOD_NOT_ALLOWED")
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) error {
+	return Error(w, r, http.StatusMethodNotAllowed, i18n.Error("request.method_not_allowed"), "METHOD_NOT_ALLOWED")
 }
 
-type apiError struct {
-	message string
+func NotImplemented(w http.ResponseWriter, r *http.Request, err error) error {
+	return Error(w, r, http.StatusNotImplemented, err, "NOT_IMPLEMENTED")
 }
 
-func (e *apiError) Error() string {
-	return e.message
+func Locked(w http.ResponseWriter, r *http.Request, err error) error {
+	return Error(w, r, http.StatusLocked, err, "ACCOUNT_LOCKED")
 }
@@ -3,26 +3,128 @@ package router
 import (
 	"libraryapi/internal/api/handlers"
 	"libraryapi/internal/api/middleware"
+	"libraryapi/internal/pkg/auth"
 	"net/http"
 )
 
-func SetupRouter(bookHandler *handlers.BookHandler) http.Handler {
+// Options adds optional middleware to the router.
+type Options struct {
+	// Auth identifies the caller of /api routes; nil leaves them open.
+	Auth middleware.Middleware
+	// RateLimit returns the rate limiting middleware of a named route; nil
+	// leaves routes unlimited.
+	RateLimit func(route string) middleware.Middleware
+	// CredentialLimit runs in front of Auth and limits the clients whose
+	// credentials Auth rejects; nil leaves guessing unlimited.
+	CredentialLimit middleware.Middleware
+	// Cache returns the response caching middleware of a named route; nil
+	// disables caching.
+	Cache func(route string) middleware.Middleware
+	// Policy checks the permission of each /api route; nil skips the check.
+	Policy *auth.Policy
+	// APIKeys serves /api/keys; nil when the storage backend has no API keys.
+	APIKeys *handlers.APIKeyHandler
+	// Accounts serves /api/auth and /api/users; nil when accounts are
+	// disabled.
+	Accounts *handlers.AuthHandler
+	// Health lists the dependency checks /health reports.
+	Health map[string]handlers.HealthCheck
+	// Metrics is served at MetricsPath; nil serves no metrics.
+	Metrics     http.Handler
+	MetricsPath string
+	// Observers are told about every request once it was served.
+	Observers []middleware.RequestObserver
+	// Tracing runs outermost on every request, so its span covers the
+	// other middleware and the access log has its trace ID; nil disables.
+	Tracing middleware.Middleware
+	// Middleware runs on every request inside RequestID, Logger and
+	// Recovery, in order.
+	Middleware []middleware.Middleware
+}
+
+func SetupRouter(bookHandler *handlers.BookHandler, opts Options) http.Handler {
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("Library API v1.0"))
 	})
 
-	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte("OK"))
-	})
+	mux.Handle("/health", handlers.Health(opts.Health))
+	if opts.Metrics != nil {
+		mux.Handle(opts.MetricsPath, opts.Metrics)
+	}
+
+	// limit applies the quota of route to h.
+	limit := func(route string, h http.HandlerFunc) http.Handler {
+		if opts.RateLimit == nil {
+			return h
+		}
+		return opts.RateLimit(route)(h)
+	}
+
+	// api guards a route with authentication, its rate limit and, per
+	// request, the permission perm picks. Clients whose credentials keep
+	// being rejected are stopped before authentication.
+	api := func(route string, h http.Handler, perm func(*http.Request) auth.Permission) http.Handler {
+		var chain []middleware.Middleware
+		if opts.Auth != nil {
+			if opts.CredentialLimit != nil {
+				chain = append(chain, opts.CredentialLimit)
+			}
+			chain = append(chain, opts.Auth)
+		}
+		if opts.RateLimit != nil {
+			chain = append(chain, opts.RateLimit(route))
+		}
+		if opts.Policy != nil {
+			chain = append(chain, middleware.Authorize(opts.Policy, perm))
+		}
+		return middleware.Apply(h, chain...)
+	}
+	// cached runs h behind the response cache of route, inside api so only
+	// permitted requests reach the cache. Without a cache the surrogate keys
+	// h tags its responses with are dropped here instead.
+	cached := func(route string, h http.HandlerFunc) http.Handler {
+		if opts.Cache == nil {
+			return middleware.StripSurrogateKeys(h)
+		}
+		return opts.Cache(route)(h)
+	}
+	books := middleware.ByMethod(auth.PermBooksRead, auth.PermBooksWrite)
+	mux.Handle("/api/books", api("books", cached("books", bookHandler.BooksHandler), books))
+	mux.Handle("/api/books/", api("books", cached("book", bookHandler.BookByIDHandler), books))
+
+	if opts.APIKeys != nil {
+		manageKeys := func(*http.Request) auth.Permission { return auth.PermAPIKeysManage }
+		mux.Handle("/api/keys", api("keys", http.HandlerFunc(opts.APIKeys.APIKeysHandler), manageKeys))
+		mux.Handle("/api/keys/", api("keys", http.HandlerFunc(opts.APIKeys.APIKeyByIDHandler), manageKeys))
+	}
+
+	if opts.Accounts != nil {
+		h := opts.Accounts
+		// Callers of these have no token yet, or only a refresh token.
+		mux.Handle("/api/auth/register", limit("auth", h.RegisterHandler))
+		mux.Handle("/api/auth/login", limit("auth", h.LoginHandler))
+		mux.Handle("/api/auth/refresh", limit("auth", h.RefreshHandler))
+		mux.Handle("/api/auth/logout", limit("auth", h.LogoutHandler))
+		mux.Handle("/api/auth/password/forgot", limit("auth", h.ForgotPasswordHandler))
+		mux.Handle("/api/auth/password/reset", limit("auth", h.ResetPasswordHandler))
 
-	mux.HandleFunc("/api/books", bookHandler.BooksHandler)
-	mux.HandleFunc("/api/books/", bookHandler.BookByIDHandler)
+		manageAccount := func(*http.Request) auth.Permission { return auth.PermAccountManage }
+		manageUsers := func(*http.Request) auth.Permission { return auth.PermUsersManage }
+		mux.Handle("/api/auth/me", api("auth", http.HandlerFunc(h.Me), manageAccount))
+		mux.Handle("/api/users", api("users", http.HandlerFunc(h.UsersHandler), manageUsers))
+		mux.Handle("/api/users/", api("users", http.HandlerFunc(h.UserByIDHandler), manageUsers))
+	}
 
-	// Apply middleware chain: Recovery -> Logger
-	return middleware.Chain(
-		middleware.Recovery,
-		middleware.Logger,
-	)(mux)
+	// Apply middleware chain: Tracing -> RequestID -> Logger -> Recovery -> opts.Middleware
+	// Recovery runs inside Logger so requests that panic are logged and
+	// observed with the 500 it sends.
+	var chain []middleware.Middleware
+	if opts.Tracing != nil {
+		chain = append(chain, opts.Tracing)
+	}
+	chain = append(chain, middleware.RequestID, middleware.Logger(opts.Observers...), middleware.Recovery)
+	chain = append(chain, opts.Middleware...)
+	return middleware.Chain(chain...)(middleware.RecordRoute(mux))
 }
@@ -0,0 +1,239 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	memstorage "libraryapi/internal/Storage"
+	"libraryapi/internal/api/dto"
+	"libraryapi/internal/api/handlers"
+	"libraryapi/internal/api/middleware"
+	"libraryapi/internal/domain/models"
+	"libraryapi/internal/domain/repositories"
+	"libraryapi/internal/pkg/auth"
+	"libraryapi/internal/pkg/cache"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+type envelope struct {
+	Data json.RawMessage `json:"data"`
+}
+
+type page struct {
+	Data []struct {
+		ID    string `json:"id"`
+		Title string `json:"title"`
+	} `json:"data"`
+	Meta struct {
+		TotalItems int `json:"total_items"`
+	} `json:"meta"`
+}
+
+// do sends a request and decodes the data of a successful response into out.
+func do(t *testing.T, h http.Handler, method, target, body string, out interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if out != nil && w.Code == http.StatusOK {
+		var env envelope
+		if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil {
+			t.Fatalf("%s %s: %v", method, target, err)
+		}
+		if err := json.Unmarshal(env.Data, out); err != nil {
+			t.Fatalf("%s %s: %v", method, target, err)
+		}
+	}
+	return w
+}
+
+// TestBooksReadAfterWrite checks that every write is visible to the next
+// read although list pages and books are cached for minutes.
+func TestBooksReadAfterWrite(t *testing.T) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	t.Cleanup(func() { zerolog.SetGlobalLevel(zerolog.InfoLevel) })
+
+	rc := middleware.NewResponseCache(cache.NewMemoryCache(1<<20),
+		middleware.ResponseCacheOptions{Routes: map[string]middleware.CachePolicy{"book": {TTL: time.Hour}, "books": {TTL: time.Hour}}})
+	h := SetupRouter(handlers.NewBookHandler(memstorage.NewMemory()), Options{Cache: rc.Route})
+
+	var first struct{ ID string }
+	do(t, h, http.MethodPost, "/api/books", `{"title":"Dune","author":"Frank Herbert","year":1965}`, &first)
+
+	// Fill the cache: two list pages, each requested twice, and the book.
+	for _, target := range []string{"/api/books?page=1&limit=1", "/api/books?page=1&limit=10", "/api/books/" + first.ID} {
+		do(t, h, http.MethodGet, target, "", nil)
+		if w := do(t, h, http.MethodGet, target, "", nil); w.Header().Get("X-Cache") != "HIT" {
+			t.Fatalf("GET %s was not cached", target)
+		}
+	}
+
+	do(t, h, http.MethodPost, "/api/books", `{"title":"Emma","author":"Jane Austen","year":1815}`, nil)
+	for _, target := range []string{"/api/books?page=1&limit=1", "/api/books?page=1&limit=10"} {
+		var p page
+		do(t, h, http.MethodGet, target, "", &p)
+		if p.Meta.TotalItems != 2 {
+			t.Errorf("GET %s after create: total_items %d, want 2", target, p.Meta.TotalItems)
+		}
+	}
+
+	do(t, h, http.MethodPatch, "/api/books/"+first.ID, `{"title":"Dune Messiah"}`, nil)
+	var book struct{ Title string }
+	do(t, h, http.MethodGet, "/api/books/"+first.ID, "", &book)
+	if book.Title != "Dune Messiah" {
+		t.Errorf("GET book after update: title %q", book.Title)
+	}
+	var p page
+	do(t, h, http.MethodGet, "/api/books?page=1&limit=10", "", &p)
+	for _, b := range p.Data {
+		if b.ID == first.ID && b.Title != "Dune Messiah" {
+			t.Errorf("list after update shows title %q", b.Title)
+		}
+	}
+
+	do(t, h, http.MethodDelete, "/api/books/"+first.ID, "", nil)
+	if w := do(t, h, http.MethodGet, "/api/books/"+first.ID, "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("GET book after delete: status %d, want 404", w.Code)
+	}
+	p = page{}
+	do(t, h, http.MethodGet, "/api/books?page=1&limit=10", "", &p)
+	if p.Meta.TotalItems != 1 {
+		t.Errorf("list after delete: total_items %d, want 1", p.Meta.TotalItems)
+	}
+}
+
+// Handlers tag responses with surrogate keys for the cache; they must not
+// reach clients whether or not a cache is configured.
+func TestSurrogateKeysNotSent(t *testing.T) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	t.Cleanup(func() { zerolog.SetGlobalLevel(zerolog.InfoLevel) })
+
+	rc := middleware.NewResponseCache(cache.NewMemoryCache(1<<20),
+		middleware.ResponseCacheOptions{Routes: map[string]middleware.CachePolicy{"book": {TTL: time.Hour}, "books": {TTL: time.Hour}}})
+	for name, opts := range map[string]Options{"without cache": {}, "with cache": {Cache: rc.Route}} {
+		h := SetupRouter(handlers.NewBookHandler(memstorage.NewMemory()), opts)
+		var book struct{ ID string }
+		requests := []*httptest.ResponseRecorder{
+			do(t, h, http.MethodPost, "/api/books", `{"title":"Dune","author":"Frank Herbert","year":1965}`, &book),
+		}
+		requests = append(requests,
+			do(t, h, http.MethodGet, "/api/books", "", nil),
+			do(t, h, http.MethodGet, "/api/books/"+book.ID, "", nil),
+			do(t, h, http.MethodHead, "/api/books/"+book.ID, "", nil),
+			do(t, h, http.MethodDelete, "/api/books/"+book.ID, "", nil),
+		)
+		for i, w := range requests {
+			if got := w.Header().Get(middleware.SurrogateKeyHeader); got != "" {
+				t.Errorf("%s: response %d (status %d) has Surrogate-Key %q", name, i, w.Code, got)
+			}
+		}
+	}
+}
+
+type panickingRepo struct {
+	repositories.BookRepository
+}
+
+func (panickingRepo) Getall(context.Context, dto.Pagination) ([]models.Book, int, error) {
+	panic("boom")
+}
+
+// A request that panics is answered with a 500 that the access log and the
+// observers see like any other response.
+func TestPanicIsLoggedAndObserved(t *testing.T) {
+	var buf bytes.Buffer
+	saved := log.Logger
+	log.Logger = zerolog.New(&buf)
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	t.Cleanup(func() { log.Logger = saved })
+
+	var observed []string
+	observe := func(r *http.Request, route string, status, n int, d time.Duration) {
+		observed = append(observed, route+" "+http.StatusText(status))
+	}
+	h := SetupRouter(handlers.NewBookHandler(panickingRepo{memstorage.NewMemory()}),
+		Options{Observers: []middleware.RequestObserver{observe}})
+
+	w := do(t, h, http.MethodGet, "/api/books", "", nil)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status %d, want 500", w.Code)
+	}
+	if len(observed) != 1 || observed[0] != "/api/books Internal Server Error" {
+		t.Errorf("observed %q, want one 500 of /api/books", observed)
+	}
+
+	var access struct {
+		Message   string `json:"message"`
+		Status    int    `json:"status"`
+		Route     string `json:"route"`
+		RequestID string `json:"request_id"`
+	}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if strings.Contains(line, `"HTTP request"`) {
+			if err := json.Unmarshal([]byte(line), &access); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if access.Status != http.StatusInternalServerError || access.Route != "/api/books" || access.RequestID == "" {
+		t.Errorf("access log %+v, want the 500 of /api/books with its request ID\n%s", access, buf.String())
+	}
+}
+
+// Rejected credentials count against the auth write quota of the client's
+// IP, so guessing tokens ends in 429 before the authenticator runs.
+func TestRejectedCredentialsAreRateLimited(t *testing.T) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	t.Cleanup(func() { zerolog.SetGlobalLevel(zerolog.InfoLevel) })
+
+	verifier, err := auth.NewVerifier(auth.VerifierOptions{Secret: []byte(strings.Repeat("k", 32))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter := middleware.NewRateLimiter(middleware.RateLimitOptions{
+		Default: middleware.Quota{Reads: 100, Writes: 100},
+		Routes:  map[string]middleware.Quota{"auth": {Reads: 100, Writes: 3}},
+	}, nil, "")
+	h := SetupRouter(handlers.NewBookHandler(memstorage.NewMemory()), Options{
+		Auth:            middleware.NewAuthenticator(verifier, nil, true).Handler,
+		RateLimit:       limiter.Route,
+		CredentialLimit: limiter.Failures("auth"),
+	})
+
+	guess := func(remoteAddr, header, value string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/books", nil)
+		r.RemoteAddr = remoteAddr
+		if header != "" {
+			r.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	for i := 0; i < 3; i++ {
+		if w := guess("192.0.2.1:1234", "Authorization", "Bearer not-a-token"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("guess %d: status %d, want 401", i+1, w.Code)
+		}
+	}
+	w := guess("192.0.2.1:1234", "Authorization", "Bearer not-a-token")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("guess after the quota: status %d, Retry-After %q; want 429 with Retry-After", w.Code, w.Header().Get("Retry-After"))
+	}
+	// The limit covers every request of that IP, whatever it sends next.
+	if w := guess("192.0.2.1:1234", "", ""); w.Code != http.StatusTooManyRequests {
+		t.Errorf("anonymous read from the same IP: status %d, want 429", w.Code)
+	}
+	// Successful requests never used the quota of other clients.
+	for i := 0; i < 5; i++ {
+		if w := guess("192.0.2.2:1234", "", ""); w.Code == http.StatusTooManyRequests || w.Code == http.StatusUnauthorized {
+			t.Fatalf("read %d from another IP: status %d", i+1, w.Code)
+		}
+	}
+}
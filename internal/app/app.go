@@ -0,0 +1,155 @@
+// Package app builds the storage and cache backends from the configuration.
+// cmd/server and cmd/libctl both go through it, so they always talk to the
+// same database and Redis.
+package app
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	memstorage "libraryapi/internal/Storage"
+	pgstorage "libraryapi/internal/Storage/postgres"
+	sqlitestorage "libraryapi/internal/Storage/sqlite"
+	"libraryapi/internal/config"
+	"libraryapi/internal/domain/repositories"
+	"libraryapi/internal/pkg/auth"
+	"libraryapi/internal/pkg/cache"
+	"libraryapi/internal/pkg/migrate"
+	"libraryapi/migrations"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+// closer is implemented by backends that hold a database handle.
+type closer interface {
+	Close() error
+}
+
+// OpenStorage opens the book repository selected by storage.backend. With
+// postgres.migrate_on_start pending Postgres migrations are applied first.
+func OpenStorage(ctx context.Context, cfg *config.Config) (repositories.BookRepository, error) {
+	timeout := cfg.Storage.QueryTimeout.Std()
+
+	switch backend := cfg.Storage.Backend; backend {
+	case config.BackendPostgres:
+		if cfg.Postgres.MigrateOnStart {
+			if err := MigrateUp(ctx, cfg); err != nil {
+				return nil, err
+			}
+		}
+		log.Info().Str("host", cfg.Postgres.Host).Msg("Connecting to PostgreSQL")
+		return pgstorage.NewPostgres(cfg.PostgresDSN(), pgstorage.Options{
+			QueryTimeout:    timeout,
+			MaxOpenConns:    cfg.Postgres.MaxOpenConns,
+			MaxIdleConns:    cfg.Postgres.MaxIdleConns,
+			ConnMaxLifetime: cfg.Postgres.ConnMaxLifetime.Std(),
+		})
+	case config.BackendSQLite:
+		log.Info().Str("path", cfg.SQLite.Path).Msg("Opening SQLite database")
+		return sqlitestorage.NewSQLite(cfg.SQLite.Path, timeout)
+	case config.BackendMemory:
+		log.Warn().Msg("Using in-memory storage, data will be lost on restart")
+		return memstorage.NewMemory(), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", backend)
+	}
+}
+
+// LoadPolicy builds the authorization policy from the roles stored by repo,
+// or from the built-in role table when the backend does not store roles.
+// With publicReads anonymous callers may read the catalog.
+func LoadPolicy(ctx context.Context, repo repositories.BookRepository, publicReads bool) (*auth.Policy, error) {
+	roles := auth.DefaultRoles()
+	if rr, ok := repo.(repositories.RoleRepository); ok {
+		stored, err := rr.RolePermissions(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("load roles: %w", err)
+		}
+		roles = make(map[string][]auth.Permission, len(stored))
+		for role, perms := range stored {
+			for _, perm := range perms {
+				roles[role] = append(roles[role], auth.Permission(perm))
+			}
+		}
+	}
+
+	policy := auth.NewPolicy(roles)
+	if publicReads {
+		policy.SetAnonymous(auth.PermBooksRead)
+	}
+	return policy, nil
+}
+
+// CloseStorage releases the database handle of repo, if it has one.
+func CloseStorage(repo repositories.BookRepository) error {
+	if c, ok := repo.(closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// OpenMigrator opens a Postgres connection for schema migrations. The caller
+// closes the returned *sql.DB.
+func OpenMigrator(cfg *config.Config) (*migrate.Migrator, *sql.DB, error) {
+	db, err := sql.Open("postgres", cfg.PostgresDSN())
+	if err != nil {
+		return nil, nil, err
+	}
+	migrator, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	return migrator, db, nil
+}
+
+// MigrateUp applies every pending Postgres migration.
+func MigrateUp(ctx context.Context, cfg *config.Config) error {
+	migrator, db, err := OpenMigrator(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		return fmt.Errorf("apply migrations: %w", err)
+	}
+	log.Info().Ints("applied", applied).Int("version", migrator.Latest()).Msg("Database schema is up to date")
+	return nil
+}
+
+// NewRedisClient connects to the configured Redis server for uses other
+// than the cache, such as shared rate limits.
+func NewRedisClient(cfg *config.Config) *redis.Client {
+	return redis.NewClient(&redis.Options{
+		Addr:     cfg.RedisAddr(),
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
+	})
+}
+
+// NewCache connects to the configured Redis server. Unless disabled, an
+// in-process tier is kept in front of it.
+func NewCache(cfg *config.Config) cache.Cache {
+	// The names were checked by config.Validate.
+	codec, _ := cache.CodecByName(cfg.Cache.Codec)
+	compression, _ := cache.CompressionByName(cfg.Cache.Compression)
+	redisCache := cache.NewRedisCache(cache.RedisOptions{
+		Host:     cfg.Redis.Host,
+		Port:     strconv.Itoa(cfg.Redis.Port),
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
+		Prefix:   cfg.Redis.KeyPrefix,
+		Timeout:  cfg.Redis.Timeout.Std(),
+
+		Serializer: cache.NewSerializer(codec, compression, cfg.Cache.CompressMinBytes),
+	})
+	if cfg.Cache.LocalSizeMB == 0 {
+		return redisCache
+	}
+	local := cache.NewMemoryCache(int64(cfg.Cache.LocalSizeMB) << 20)
+	return cache.NewTieredCache(local, redisCache, cfg.Cache.LocalTTL.Std())
+}
@@ -0,0 +1,600 @@
+// Package config defines the typed server configuration and loads it from
+// defaults, a YAML or TOML file, environment variables and command-line
+// flags, each layer overriding the previous one.
+package config
+
+import (
+	"fmt"
+	"libraryapi/internal/pkg/cache"
+	"libraryapi/internal/pkg/i18n"
+	"libraryapi/internal/pkg/mail"
+	"libraryapi/internal/pkg/tracing"
+	netmail "net/mail"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	BackendPostgres = "postgres"
+	BackendSQLite   = "sqlite"
+	BackendMemory   = "memory"
+)
+
+// Config is the complete server configuration. Every leaf field has a file
+// key (yaml/toml tag), an environment variable (env tag) and a flag named
+// after its dotted file path, e.g. -postgres.max_open_conns. Fields tagged
+// reload:"live" are applied by Reload without a restart.
+type Config struct {
+	Server    ServerConfig    `yaml:"server" toml:"server"`
+	Log       LogConfig       `yaml:"log" toml:"log"`
+	Storage   StorageConfig   `yaml:"storage" toml:"storage"`
+	Postgres  PostgresConfig  `yaml:"postgres" toml:"postgres"`
+	SQLite    SQLiteConfig    `yaml:"sqlite" toml:"sqlite"`
+	Redis     RedisConfig     `yaml:"redis" toml:"redis"`
+	Cache     CacheConfig     `yaml:"cache" toml:"cache"`
+	RateLimit RateLimitConfig `yaml:"rate_limit" toml:"rate_limit"`
+	CORS      CORSConfig      `yaml:"cors" toml:"cors"`
+	Auth      AuthConfig      `yaml:"auth" toml:"auth"`
+	Mail      MailConfig      `yaml:"mail" toml:"mail"`
+	I18n      I18nConfig      `yaml:"i18n" toml:"i18n"`
+	Metrics   MetricsConfig   `yaml:"metrics" toml:"metrics"`
+	Tracing   TracingConfig   `yaml:"tracing" toml:"tracing"`
+
+	src *source
+}
+
+type ServerConfig struct {
+	Port            int      `yaml:"port" toml:"port" env:"PORT" usage:"HTTP listen port"`
+	ShutdownTimeout Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" usage:"grace period for in-flight requests on shutdown"`
+}
+
+type LogConfig struct {
+	Level  string `yaml:"level" toml:"level" env:"LOG_LEVEL" reload:"live" usage:"debug, info, warn, error or fatal"`
+	Pretty bool   `yaml:"pretty" toml:"pretty" env:"LOG_PRETTY" usage:"human-readable console output instead of JSON"`
+}
+
+type StorageConfig struct {
+	Backend      string   `yaml:"backend" toml:"backend" env:"STORAGE_BACKEND" usage:"postgres, sqlite or memory"`
+	QueryTimeout Duration `yaml:"query_timeout" toml:"query_timeout" env:"DB_QUERY_TIMEOUT" usage:"timeout of a single database query"`
+}
+
+type PostgresConfig struct {
+	Host            string   `yaml:"host" toml:"host" env:"DB_HOST"`
+	Port            int      `yaml:"port" toml:"port" env:"DB_PORT"`
+	User            string   `yaml:"user" toml:"user" env:"DB_USER"`
+	Password        string   `yaml:"password" toml:"password" env:"DB_PASSWORD" secret:"true"`
+	Name            string   `yaml:"name" toml:"name" env:"DB_NAME"`
+	SSLMode         string   `yaml:"sslmode" toml:"sslmode" env:"DB_SSLMODE"`
+	MaxOpenConns    int      `yaml:"max_open_conns" toml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int      `yaml:"max_idle_conns" toml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+	MigrateOnStart  bool     `yaml:"migrate_on_start" toml:"migrate_on_start" env:"MIGRATE_ON_START" usage:"apply pending migrations when the server starts"`
+}
+
+type SQLiteConfig struct {
+	Path string `yaml:"path" toml:"path" env:"SQLITE_PATH" usage:"database file of the sqlite backend"`
+}
+
+type RedisConfig struct {
+	Host     string `yaml:"host" toml:"host" env:"REDIS_HOST"`
+	Port     int    `yaml:"port" toml:"port" env:"REDIS_PORT"`
+	Password string `yaml:"password" toml:"password" env:"REDIS_PASSWORD" secret:"true"`
+	DB       int    `yaml:"db" toml:"db" env:"REDIS_DB"`
+	// KeyPrefix is prepended to every key the server keeps in Redis, cache
+	// entries and rate limit buckets alike, so deployments sharing a
+	// database stay apart and cache flushes leave other users alone.
+	KeyPrefix string   `yaml:"key_prefix" toml:"key_prefix" env:"REDIS_KEY_PREFIX" usage:"prefix of every Redis key, cache entries and rate limit buckets; unique per deployment sharing a database, cache flushes delete only these keys"`
+	Timeout   Duration `yaml:"timeout" toml:"timeout" env:"REDIS_TIMEOUT" usage:"longest a cache operation may take before it fails"`
+}
+
+type CacheConfig struct {
+	// Without the cache every request reads from storage; Redis is then
+	// used only for rate limits.
+	Enabled bool     `yaml:"enabled" toml:"enabled" env:"CACHE_ENABLED" usage:"cache responses in Redis"`
+	BookTTL Duration `yaml:"book_ttl" toml:"book_ttl" env:"CACHE_BOOK_TTL" reload:"live" usage:"how long a single book stays cached"`
+	ListTTL Duration `yaml:"list_ttl" toml:"list_ttl" env:"CACHE_LIST_TTL" reload:"live" usage:"how long a page of the book list stays cached"`
+
+	// An expired entry is still served for the stale TTL while one request
+	// refreshes it in the background; 0 disables.
+	BookStaleTTL Duration `yaml:"book_stale_ttl" toml:"book_stale_ttl" env:"CACHE_BOOK_STALE_TTL" reload:"live" usage:"how long an expired book is served while it is refreshed"`
+	ListStaleTTL Duration `yaml:"list_stale_ttl" toml:"list_stale_ttl" env:"CACHE_LIST_STALE_TTL" reload:"live" usage:"how long an expired page of the book list is served while it is refreshed"`
+	// Early refresh recomputes an entry shortly before it expires, with a
+	// probability growing as expiry nears; higher values refresh earlier,
+	// 0 disables.
+	BookEarlyRefresh float64  `yaml:"book_early_refresh" toml:"book_early_refresh" env:"CACHE_BOOK_EARLY_REFRESH" reload:"live" usage:"how eagerly a book is refreshed before it expires, 0 = never"`
+	ListEarlyRefresh float64  `yaml:"list_early_refresh" toml:"list_early_refresh" env:"CACHE_LIST_EARLY_REFRESH" reload:"live" usage:"how eagerly a page of the book list is refreshed before it expires, 0 = never"`
+	LockWait         Duration `yaml:"lock_wait" toml:"lock_wait" env:"CACHE_LOCK_WAIT" reload:"live" usage:"how long a miss waits for another instance filling the same entry"`
+
+	// A local tier keeps hot entries in process memory in front of Redis;
+	// instances tell each other about changes through Redis pub/sub.
+	LocalSizeMB int      `yaml:"local_size_mb" toml:"local_size_mb" env:"CACHE_LOCAL_SIZE_MB" usage:"memory for the in-process cache tier in MiB, 0 disables it"`
+	LocalTTL    Duration `yaml:"local_ttl" toml:"local_ttl" env:"CACHE_LOCAL_TTL" usage:"how long an entry is kept in process memory at most"`
+
+	// After BreakerFailures operations in a row cannot reach Redis the
+	// cache is skipped, and retried every BreakerCooldown.
+	BreakerFailures int      `yaml:"breaker_failures" toml:"breaker_failures" env:"CACHE_BREAKER_FAILURES" usage:"consecutive Redis failures before the cache is skipped"`
+	BreakerCooldown Duration `yaml:"breaker_cooldown" toml:"breaker_cooldown" env:"CACHE_BREAKER_COOLDOWN" usage:"how long the cache is skipped before Redis is tried again"`
+
+	// Values are written with Codec and, from CompressMinBytes on,
+	// compressed. Every value records how it was written, so these can be
+	// changed without flushing the cache.
+	Codec            string `yaml:"codec" toml:"codec" env:"CACHE_CODEC" usage:"json, msgpack or gob"`
+	Compression      string `yaml:"compression" toml:"compression" env:"CACHE_COMPRESSION" usage:"none, zstd or snappy"`
+	CompressMinBytes int    `yaml:"compress_min_bytes" toml:"compress_min_bytes" env:"CACHE_COMPRESS_MIN_BYTES" usage:"smallest encoded value that is compressed"`
+}
+
+// RateLimitConfig sets per-client request quotas; 0 disables a quota. A
+// client is an API key, a user or, for anonymous requests, an IP address.
+type RateLimitConfig struct {
+	ReadsPerMinute  int      `yaml:"reads_per_minute" toml:"reads_per_minute" env:"RATE_LIMIT_READS" reload:"live" usage:"GET/HEAD requests per client per minute"`
+	WritesPerMinute int      `yaml:"writes_per_minute" toml:"writes_per_minute" env:"RATE_LIMIT_WRITES" reload:"live" usage:"mutating requests per client per minute"`
+	Routes          []string `yaml:"routes" toml:"routes" env:"RATE_LIMIT_ROUTES" reload:"live" usage:"per-route quotas as route=reads/writes, e.g. auth=30/10; routes: books, keys, users, auth; auth writes also cap rejected credentials"`
+	TrustedProxies  []string `yaml:"trusted_proxies" toml:"trusted_proxies" env:"RATE_LIMIT_TRUSTED_PROXIES" reload:"live" usage:"comma-separated proxy IPs or CIDRs whose X-Forwarded-For is believed"`
+}
+
+// RouteQuota is one parsed entry of RateLimitConfig.Routes.
+type RouteQuota struct {
+	Route  string
+	Reads  int
+	Writes int
+}
+
+// RouteQuotas parses Routes.
+func (c RateLimitConfig) RouteQuotas() ([]RouteQuota, error) {
+	quotas := make([]RouteQuota, 0, len(c.Routes))
+	for _, entry := range c.Routes {
+		route, limits, ok := strings.Cut(entry, "=")
+		reads, writes, ok2 := strings.Cut(limits, "/")
+		if !ok || !ok2 || strings.TrimSpace(route) == "" {
+			return nil, fmt.Errorf("%q is not route=reads/writes", entry)
+		}
+		q := RouteQuota{Route: strings.TrimSpace(route)}
+		var err error
+		if q.Reads, err = strconv.Atoi(strings.TrimSpace(reads)); err != nil || q.Reads < 0 {
+			return nil, fmt.Errorf("%q: reads must be a non-negative integer", entry)
+		}
+		if q.Writes, err = strconv.Atoi(strings.TrimSpace(writes)); err != nil || q.Writes < 0 {
+			return nil, fmt.Errorf("%q: writes must be a non-negative integer", entry)
+		}
+		quotas = append(quotas, q)
+	}
+	return quotas, nil
+}
+
+// Proxies parses TrustedProxies; a bare address is a single-host prefix.
+func (c RateLimitConfig) Proxies() ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(c.TrustedProxies))
+	for _, s := range c.TrustedProxies {
+		if addr, err := netip.ParseAddr(s); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an IP address or CIDR", s)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+type CORSConfig struct {
+	AllowedOrigins []string `yaml:"allowed_origins" toml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS" reload:"live" usage:"comma-separated origins allowed to call the API, * for any"`
+}
+
+// AuthConfig selects how bearer tokens are verified: HS256 with JWTSecret,
+// RS256/ES256 with keys from JWKSFile or JWKSURL, or both.
+type AuthConfig struct {
+	JWTSecret   string   `yaml:"jwt_secret" toml:"jwt_secret" env:"JWT_SECRET" secret:"true" usage:"HS256 signing secret, at least 32 bytes"`
+	JWKSFile    string   `yaml:"jwks_file" toml:"jwks_file" env:"JWT_JWKS_FILE" usage:"JWKS file with RS256/ES256 verification keys"`
+	JWKSURL     string   `yaml:"jwks_url" toml:"jwks_url" env:"JWT_JWKS_URL" usage:"JWKS endpoint with RS256/ES256 verification keys"`
+	Issuer      string   `yaml:"issuer" toml:"issuer" env:"JWT_ISSUER" usage:"required iss claim"`
+	Audience    string   `yaml:"audience" toml:"audience" env:"JWT_AUDIENCE" usage:"required aud claim"`
+	Leeway      Duration `yaml:"leeway" toml:"leeway" env:"JWT_LEEWAY" usage:"clock skew tolerated for exp and nbf"`
+	PublicReads bool     `yaml:"public_reads" toml:"public_reads" env:"AUTH_PUBLIC_READS" usage:"allow reading the catalog without a token"`
+
+	// Accounts. Access tokens are signed with JWTSecret; without it the
+	// /api/auth endpoints are disabled.
+	AccessTokenTTL  Duration `yaml:"access_token_ttl" toml:"access_token_ttl" env:"AUTH_ACCESS_TOKEN_TTL" usage:"lifetime of access tokens issued at login"`
+	RefreshTokenTTL Duration `yaml:"refresh_token_ttl" toml:"refresh_token_ttl" env:"AUTH_REFRESH_TOKEN_TTL" usage:"lifetime of a login session without activity"`
+	MaxFailedLogins int      `yaml:"max_failed_logins" toml:"max_failed_logins" env:"AUTH_MAX_FAILED_LOGINS" usage:"failed logins in a row that lock an account"`
+	LockoutDuration Duration `yaml:"lockout_duration" toml:"lockout_duration" env:"AUTH_LOCKOUT_DURATION" usage:"how long a locked account stays locked"`
+	ResetTokenTTL   Duration `yaml:"reset_token_ttl" toml:"reset_token_ttl" env:"AUTH_RESET_TOKEN_TTL" usage:"lifetime of password reset tokens"`
+	ResetURL        string   `yaml:"reset_url" toml:"reset_url" env:"AUTH_RESET_URL" usage:"page linked in password reset mail; the token is appended as ?token="`
+}
+
+// MailConfig selects how password reset mail is delivered. With the none
+// driver password reset is disabled; the log driver writes reset tokens to
+// the log and is only fit for development.
+type MailConfig struct {
+	Driver       string `yaml:"driver" toml:"driver" env:"MAIL_DRIVER" usage:"none, log or smtp"`
+	From         string `yaml:"from" toml:"from" env:"MAIL_FROM" usage:"sender address of outgoing mail"`
+	SMTPHost     string `yaml:"smtp_host" toml:"smtp_host" env:"SMTP_HOST" usage:"SMTP relay host"`
+	SMTPPort     int    `yaml:"smtp_port" toml:"smtp_port" env:"SMTP_PORT" usage:"SMTP relay port"`
+	SMTPUsername string `yaml:"smtp_username" toml:"smtp_username" env:"SMTP_USERNAME" usage:"SMTP user; empty skips authentication"`
+	SMTPPassword string `yaml:"smtp_password" toml:"smtp_password" env:"SMTP_PASSWORD" secret:"true" usage:"SMTP password"`
+	SMTPInsecure bool   `yaml:"smtp_insecure" toml:"smtp_insecure" env:"SMTP_INSECURE" usage:"send without STARTTLS if the relay does not offer it"`
+}
+
+type I18nConfig struct {
+	DefaultLanguage string `yaml:"default_language" toml:"default_language" env:"DEFAULT_LANGUAGE" usage:"response language when Accept-Language matches none (en, ru)"`
+}
+
+type MetricsConfig struct {
+	// Metrics are served without authentication; keep the path away from
+	// the public, e.g. by not routing it through the load balancer.
+	Enabled bool   `yaml:"enabled" toml:"enabled" env:"METRICS_ENABLED" usage:"serve Prometheus metrics"`
+	Path    string `yaml:"path" toml:"path" env:"METRICS_PATH" usage:"URL path of the Prometheus metrics"`
+	// The total number of books is counted in storage every interval.
+	BooksInterval Duration `yaml:"books_interval" toml:"books_interval" env:"METRICS_BOOKS_INTERVAL" usage:"how often the book count is refreshed"`
+}
+
+type TracingConfig struct {
+	// Spans are exported over OTLP/HTTP to a collector such as the
+	// OpenTelemetry Collector or Jaeger, or printed to stdout to debug.
+	Exporter    string  `yaml:"exporter" toml:"exporter" env:"TRACING_EXPORTER" usage:"none, otlp or stdout"`
+	Endpoint    string  `yaml:"endpoint" toml:"endpoint" env:"TRACING_ENDPOINT" usage:"host:port of the OTLP/HTTP collector"`
+	Insecure    bool    `yaml:"insecure" toml:"insecure" env:"TRACING_INSECURE" usage:"export to the collector over plain HTTP"`
+	SampleRatio float64 `yaml:"sample_ratio" toml:"sample_ratio" env:"TRACING_SAMPLE_RATIO" usage:"share of new traces recorded, 0 to 1"`
+	ServiceName string  `yaml:"service_name" toml:"service_name" env:"TRACING_SERVICE_NAME" usage:"service name spans are reported under"`
+}
+
+// Default returns the built-in configuration, matching the values the server
+// used before it had a config file.
+func Default() Config {
+	return Config{
+		Server: ServerConfig{Port: 8080, ShutdownTimeout: Duration(10 * time.Second)},
+		Log:    LogConfig{Level: "debug"},
+		Storage: StorageConfig{
+			Backend:      BackendPostgres,
+			QueryTimeout: Duration(5 * time.Second),
+		},
+		Postgres: PostgresConfig{
+			Host:            "localhost",
+			Port:            5432,
+			User:            "postgres",
+			Password:        "postgres",
+			Name:            "library",
+			SSLMode:         "disable",
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: Duration(5 * time.Minute),
+		},
+		SQLite: SQLiteConfig{Path: "library.db"},
+		Redis:  RedisConfig{Host: "localhost", Port: 6379, KeyPrefix: "libraryapi:", Timeout: Duration(100 * time.Millisecond)},
+		Cache: CacheConfig{
+			Enabled: true,
+			BookTTL: Duration(10 * time.Minute),
+			ListTTL: Duration(5 * time.Minute),
+
+			BookStaleTTL:     Duration(time.Minute),
+			ListStaleTTL:     Duration(30 * time.Second),
+			BookEarlyRefresh: 1,
+			ListEarlyRefresh: 1,
+			LockWait:         Duration(2 * time.Second),
+
+			LocalSizeMB: 64,
+			LocalTTL:    Duration(time.Minute),
+
+			BreakerFailures: 5,
+			BreakerCooldown: Duration(10 * time.Second),
+
+			Codec:            "json",
+			Compression:      "none",
+			CompressMinBytes: 1024,
+		},
+		RateLimit: RateLimitConfig{
+			ReadsPerMinute:  600,
+			WritesPerMinute: 60,
+			Routes:          []string{"auth=60/10"},
+		},
+		Auth: AuthConfig{
+			Leeway:          Duration(30 * time.Second),
+			PublicReads:     true,
+			AccessTokenTTL:  Duration(15 * time.Minute),
+			RefreshTokenTTL: Duration(30 * 24 * time.Hour),
+			MaxFailedLogins: 5,
+			LockoutDuration: Duration(15 * time.Minute),
+			ResetTokenTTL:   Duration(time.Hour),
+		},
+		Mail: MailConfig{Driver: mail.DriverNone, SMTPPort: 587},
+		I18n: I18nConfig{DefaultLanguage: i18n.English},
+		Metrics: MetricsConfig{
+			Enabled:       true,
+			Path:          "/metrics",
+			BooksInterval: Duration(time.Minute),
+		},
+		Tracing: TracingConfig{
+			Exporter:    tracing.ExporterNone,
+			Endpoint:    "localhost:4318",
+			Insecure:    true,
+			SampleRatio: 1,
+			ServiceName: "libraryapi",
+		},
+	}
+}
+
+// PostgresDSN returns the lib/pq connection string. It contains the password;
+// never log it, log Redacted() instead.
+func (c *Config) PostgresDSN() string {
+	q := func(s string) string {
+		return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+	}
+	p := c.Postgres
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		q(p.Host), p.Port, q(p.User), q(p.Password), q(p.Name), q(p.SSLMode))
+}
+
+// RedisAddr returns host:port of the Redis server.
+func (c *Config) RedisAddr() string {
+	return fmt.Sprintf("%s:%d", c.Redis.Host, c.Redis.Port)
+}
+
+// Validate reports every invalid setting at once, naming each by its file key.
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(key, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		fail("server.port", "must be between 1 and 65535, got %d", c.Server.Port)
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		fail("server.shutdown_timeout", "must be positive")
+	}
+
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error", "fatal":
+	default:
+		fail("log.level", "must be one of debug, info, warn, error, fatal; got %q", c.Log.Level)
+	}
+
+	switch c.Storage.Backend {
+	case BackendPostgres:
+		if c.Postgres.Host == "" {
+			fail("postgres.host", "is required for the postgres backend")
+		}
+		if c.Postgres.Port < 1 || c.Postgres.Port > 65535 {
+			fail("postgres.port", "must be between 1 and 65535, got %d", c.Postgres.Port)
+		}
+		if c.Postgres.Name == "" {
+			fail("postgres.name", "is required for the postgres backend")
+		}
+	case BackendSQLite:
+		if c.SQLite.Path == "" {
+			fail("sqlite.path", "is required for the sqlite backend")
+		}
+	case BackendMemory:
+	default:
+		fail("storage.backend", "must be one of postgres, sqlite, memory; got %q", c.Storage.Backend)
+	}
+	if c.Storage.QueryTimeout < 0 {
+		fail("storage.query_timeout", "must not be negative")
+	}
+	if c.Postgres.MaxOpenConns < 1 {
+		fail("postgres.max_open_conns", "must be at least 1, got %d", c.Postgres.MaxOpenConns)
+	}
+	if c.Postgres.MaxIdleConns < 0 || c.Postgres.MaxIdleConns > c.Postgres.MaxOpenConns {
+		fail("postgres.max_idle_conns", "must be between 0 and max_open_conns (%d), got %d",
+			c.Postgres.MaxOpenConns, c.Postgres.MaxIdleConns)
+	}
+	if c.Postgres.ConnMaxLifetime < 0 {
+		fail("postgres.conn_max_lifetime", "must not be negative")
+	}
+
+	if c.Redis.Host == "" {
+		fail("redis.host", "is required")
+	}
+	if c.Redis.Port < 1 || c.Redis.Port > 65535 {
+		fail("redis.port", "must be between 1 and 65535, got %d", c.Redis.Port)
+	}
+	if c.Redis.DB < 0 {
+		fail("redis.db", "must not be negative")
+	}
+	if c.Redis.KeyPrefix == "" {
+		fail("redis.key_prefix", "is required")
+	}
+	if c.Redis.Timeout < 0 {
+		fail("redis.timeout", "must not be negative")
+	}
+
+	if c.Cache.BookTTL <= 0 {
+		fail("cache.book_ttl", "must be positive")
+	}
+	if c.Cache.ListTTL <= 0 {
+		fail("cache.list_ttl", "must be positive")
+	}
+	if c.Cache.BookStaleTTL < 0 {
+		fail("cache.book_stale_ttl", "must not be negative")
+	}
+	if c.Cache.ListStaleTTL < 0 {
+		fail("cache.list_stale_ttl", "must not be negative")
+	}
+	if c.Cache.BookEarlyRefresh < 0 {
+		fail("cache.book_early_refresh", "must not be negative")
+	}
+	if c.Cache.ListEarlyRefresh < 0 {
+		fail("cache.list_early_refresh", "must not be negative")
+	}
+	if c.Cache.LockWait < 0 {
+		fail("cache.lock_wait", "must not be negative")
+	}
+	if c.Cache.LocalSizeMB < 0 {
+		fail("cache.local_size_mb", "must not be negative")
+	}
+	if c.Cache.LocalSizeMB > 0 && c.Cache.LocalTTL <= 0 {
+		fail("cache.local_ttl", "must be positive")
+	}
+	if c.Cache.BreakerFailures < 1 {
+		fail("cache.breaker_failures", "must be at least 1")
+	}
+	if c.Cache.BreakerCooldown <= 0 {
+		fail("cache.breaker_cooldown", "must be positive")
+	}
+	if _, err := cache.CodecByName(c.Cache.Codec); err != nil {
+		fail("cache.codec", "must be json, msgpack or gob, got %q", c.Cache.Codec)
+	}
+	if _, err := cache.CompressionByName(c.Cache.Compression); err != nil {
+		fail("cache.compression", "must be none, zstd or snappy, got %q", c.Cache.Compression)
+	}
+	if c.Cache.CompressMinBytes < 0 {
+		fail("cache.compress_min_bytes", "must not be negative")
+	}
+
+	if c.RateLimit.ReadsPerMinute < 0 {
+		fail("rate_limit.reads_per_minute", "must not be negative")
+	}
+	if c.RateLimit.WritesPerMinute < 0 {
+		fail("rate_limit.writes_per_minute", "must not be negative")
+	}
+	if _, err := c.RateLimit.RouteQuotas(); err != nil {
+		fail("rate_limit.routes", "%v", err)
+	}
+	if _, err := c.RateLimit.Proxies(); err != nil {
+		fail("rate_limit.trusted_proxies", "%v", err)
+	}
+	for _, origin := range c.CORS.AllowedOrigins {
+		if origin != "*" && !strings.HasPrefix(origin, "http://") && !strings.HasPrefix(origin, "https://") {
+			fail("cors.allowed_origins", "%q must be * or start with http:// or https://", origin)
+		}
+	}
+
+	switch {
+	case c.Auth.JWTSecret == "":
+	case len(c.Auth.JWTSecret) < 32:
+		fail("auth.jwt_secret", "must be at least 32 bytes")
+	case isPlaceholder(c.Auth.JWTSecret):
+		fail("auth.jwt_secret", "is a sample value anyone can sign tokens with; generate one, e.g. with openssl rand -base64 48")
+	}
+	if c.Auth.JWKSFile != "" && c.Auth.JWKSURL != "" {
+		fail("auth.jwks_url", "cannot be combined with auth.jwks_file")
+	}
+	if c.Auth.JWKSURL != "" && !strings.HasPrefix(c.Auth.JWKSURL, "https://") && !strings.HasPrefix(c.Auth.JWKSURL, "http://") {
+		fail("auth.jwks_url", "must be an http:// or https:// URL")
+	}
+	if c.Auth.Leeway < 0 {
+		fail("auth.leeway", "must not be negative")
+	}
+	if c.Auth.AccessTokenTTL <= 0 {
+		fail("auth.access_token_ttl", "must be positive")
+	}
+	if c.Auth.RefreshTokenTTL <= 0 {
+		fail("auth.refresh_token_ttl", "must be positive")
+	}
+	if c.Auth.LockoutDuration <= 0 {
+		fail("auth.lockout_duration", "must be positive")
+	}
+	if c.Auth.ResetTokenTTL <= 0 {
+		fail("auth.reset_token_ttl", "must be positive")
+	}
+	if c.Auth.MaxFailedLogins < 1 {
+		fail("auth.max_failed_logins", "must be at least 1")
+	}
+	if c.Auth.ResetURL != "" && !strings.HasPrefix(c.Auth.ResetURL, "https://") && !strings.HasPrefix(c.Auth.ResetURL, "http://") {
+		fail("auth.reset_url", "must be an http:// or https:// URL")
+	}
+
+	if !i18n.Supported(c.I18n.DefaultLanguage) {
+		fail("i18n.default_language", "must be one of %s; got %q", strings.Join(i18n.Languages(), ", "), c.I18n.DefaultLanguage)
+	}
+
+	switch c.Mail.Driver {
+	case mail.DriverNone, mail.DriverLog:
+	case mail.DriverSMTP:
+		if c.Mail.SMTPHost == "" {
+			fail("mail.smtp_host", "is required for the smtp driver")
+		}
+		if c.Mail.SMTPPort < 1 || c.Mail.SMTPPort > 65535 {
+			fail("mail.smtp_port", "must be between 1 and 65535, got %d", c.Mail.SMTPPort)
+		}
+		if _, err := netmail.ParseAddress(c.Mail.From); err != nil {
+			fail("mail.from", "must be a mail address for the smtp driver: %v", err)
+		}
+	default:
+		fail("mail.driver", "must be none, log or smtp, got %q", c.Mail.Driver)
+	}
+
+	if c.Metrics.Enabled {
+		switch p := c.Metrics.Path; {
+		case !strings.HasPrefix(p, "/"), p == "/", p == "/health", strings.HasPrefix(p, "/api/"):
+			fail("metrics.path", "must be a path other than /, /health and /api/..., got %q", p)
+		}
+		if c.Metrics.BooksInterval <= 0 {
+			fail("metrics.books_interval", "must be positive")
+		}
+	}
+
+	switch c.Tracing.Exporter {
+	case tracing.ExporterNone, tracing.ExporterStdout:
+	case tracing.ExporterOTLP:
+		if c.Tracing.Endpoint == "" {
+			fail("tracing.endpoint", "is required for the otlp exporter")
+		}
+	default:
+		fail("tracing.exporter", "must be none, otlp or stdout, got %q", c.Tracing.Exporter)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		fail("tracing.sample_ratio", "must be between 0 and 1")
+	}
+	if c.Tracing.ServiceName == "" {
+		fail("tracing.service_name", "must not be empty")
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return &ValidationError{Errors: errs}
+}
+
+// placeholders are parts of sample secrets from docs and old .env files. A
+// secret containing one was copied rather than generated and is public.
+var placeholders = []string{"change-me", "changeme", "change_me", "your-super-secret", "secret-key"}
+
+func isPlaceholder(secret string) bool {
+	secret = strings.ToLower(secret)
+	for _, p := range placeholders {
+		if strings.Contains(secret, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidationError lists every invalid setting found by Validate.
+type ValidationError struct {
+	Errors []error
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		lines[i] = "  " + err.Error()
+	}
+	return "invalid configuration:\n" + strings.Join(lines, "\n")
+}
+
+func (e *ValidationError) Unwrap() []error {
+	return e.Errors
+}
+
+// Duration is a time.Duration written as "5s" or "10m" in files, env vars and
+// flags.
+type Duration time.Duration
+
+func (d Duration) Std() time.Duration { return time.Duration(d) }
+
+func (d Duration) String() string { return time.Duration(d).String() }
+
+func (d Duration) MarshalText() ([]byte, error) { return []byte(d.String()), nil }
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		key    string // file key named by the error
+	}{
+		{"port range", func(c *Config) { c.Server.Port = 70000 }, "server.port"},
+		{"log level", func(c *Config) { c.Log.Level = "verbose" }, "log.level"},
+		{"storage backend", func(c *Config) { c.Storage.Backend = "mongo" }, "storage.backend"},
+		{"postgres host", func(c *Config) { c.Postgres.Host = "" }, "postgres.host"},
+		{"sqlite path", func(c *Config) { c.Storage.Backend = BackendSQLite; c.SQLite.Path = "" }, "sqlite.path"},
+		{"idle above open conns", func(c *Config) { c.Postgres.MaxIdleConns = 50 }, "postgres.max_idle_conns"},
+		{"cache ttl", func(c *Config) { c.Cache.BookTTL = 0 }, "cache.book_ttl"},
+		{"cache codec", func(c *Config) { c.Cache.Codec = "xml" }, "cache.codec"},
+		{"rate limit routes", func(c *Config) { c.RateLimit.Routes = []string{"auth=lots"} }, "rate_limit.routes"},
+		{"trusted proxy", func(c *Config) { c.RateLimit.TrustedProxies = []string{"proxy.local"} }, "rate_limit.trusted_proxies"},
+		{"cors origin", func(c *Config) { c.CORS.AllowedOrigins = []string{"example.com"} }, "cors.allowed_origins"},
+		{"short jwt secret", func(c *Config) { c.Auth.JWTSecret = "short" }, "auth.jwt_secret"},
+		{"sample jwt secret", func(c *Config) { c.Auth.JWTSecret = "change-me-to-a-random-secret-of-at-least-32-bytes" }, "auth.jwt_secret"},
+		{"old sample jwt secret", func(c *Config) { c.Auth.JWTSecret = "Your-Super-Secret-Key-Change-Me-Please-0123" }, "auth.jwt_secret"},
+		{"jwks file and url", func(c *Config) { c.Auth.JWKSFile, c.Auth.JWKSURL = "keys.json", "https://a.example/jwks" }, "auth.jwks_url"},
+		{"max failed logins", func(c *Config) { c.Auth.MaxFailedLogins = 0 }, "auth.max_failed_logins"},
+		{"language", func(c *Config) { c.I18n.DefaultLanguage = "de" }, "i18n.default_language"},
+		{"mail driver", func(c *Config) { c.Mail.Driver = "sendmail" }, "mail.driver"},
+		{"smtp without host", func(c *Config) { c.Mail.Driver, c.Mail.From = "smtp", "a@example.com" }, "mail.smtp_host"},
+		{"smtp sender", func(c *Config) { c.Mail.Driver, c.Mail.SMTPHost, c.Mail.From = "smtp", "mx", "nobody" }, "mail.from"},
+		{"metrics path", func(c *Config) { c.Metrics.Path = "/api/metrics" }, "metrics.path"},
+		{"trace exporter", func(c *Config) { c.Tracing.Exporter = "zipkin" }, "tracing.exporter"},
+		{"sample ratio", func(c *Config) { c.Tracing.SampleRatio = 1.5 }, "tracing.sample_ratio"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			tt.change(&cfg)
+			err := cfg.Validate()
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("Validate = %v, want a ValidationError", err)
+			}
+			if len(verr.Errors) != 1 || !strings.HasPrefix(verr.Errors[0].Error(), tt.key+": ") {
+				t.Errorf("Validate = %v, want one error for %s", err, tt.key)
+			}
+		})
+	}
+}
+
+func TestValidateReportsAllErrors(t *testing.T) {
+	cfg := Default()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("defaults are invalid: %v", err)
+	}
+	cfg.Server.Port = 0
+	cfg.Log.Level = "loud"
+	cfg.Tracing.ServiceName = ""
+	var verr *ValidationError
+	if err := cfg.Validate(); !errors.As(err, &verr) || len(verr.Errors) != 3 {
+		t.Errorf("Validate = %v, want all three errors", err)
+	}
+}
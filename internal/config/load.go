@@ -0,0 +1,309 @@
+package config
+
+import (
+	"bytes"
+	"encoding"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnv names the config file when -config is not given.
+const FileEnv = "CONFIG_FILE"
+
+// field is one leaf setting of Config.
+type field struct {
+	key    string // dotted file key, also the flag name
+	env    string
+	usage  string
+	secret bool
+	live   bool
+	value  reflect.Value
+}
+
+// fields lists the leaves of c in declaration order.
+func fields(c *Config) []field {
+	var out []field
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if !sf.IsExported() {
+				continue
+			}
+			key := prefix + sf.Tag.Get("yaml")
+			if sf.Type.Kind() == reflect.Struct && !isText(sf.Type) {
+				walk(v.Field(i), key+".")
+				continue
+			}
+			out = append(out, field{
+				key:    key,
+				env:    sf.Tag.Get("env"),
+				usage:  sf.Tag.Get("usage"),
+				secret: sf.Tag.Get("secret") == "true",
+				live:   sf.Tag.Get("reload") == "live",
+				value:  v.Field(i),
+			})
+		}
+	}
+	walk(reflect.ValueOf(c).Elem(), "")
+	return out
+}
+
+func isText(t reflect.Type) bool {
+	return reflect.PointerTo(t).Implements(reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem())
+}
+
+// set parses s into a leaf value. Lists are comma-separated.
+func set(v reflect.Value, s string) error {
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return errors.New("not an integer")
+		}
+		v.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return errors.New("not a boolean")
+		}
+		v.SetBool(b)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return errors.New("not a number")
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// flagValue is a flag bound to a scratch copy of one leaf. Set only checks the
+// syntax; the raw value is applied after the file and env layers.
+type flagValue struct {
+	value reflect.Value
+	raw   string
+}
+
+func (f *flagValue) String() string {
+	if !f.value.IsValid() {
+		return ""
+	}
+	if items, ok := f.value.Interface().([]string); ok {
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(f.value.Interface())
+}
+
+func (f *flagValue) Set(s string) error {
+	if err := set(f.value, s); err != nil {
+		return err
+	}
+	f.raw = s
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool {
+	return f.value.IsValid() && f.value.Kind() == reflect.Bool
+}
+
+// source remembers where a Config came from so Reload can repeat it.
+type source struct {
+	defaults Config
+	path     string
+	flags    map[string]string // raw values of the flags given on the command line
+}
+
+// Load builds the configuration from defaults, the config file, environment
+// variables and the flags in args, each layer overriding the previous one.
+// It registers -config and one flag per setting on fs, parses args and
+// validates the result. The file is named by -config or CONFIG_FILE; YAML or
+// TOML is chosen by its extension.
+func Load(defaults Config, fs *flag.FlagSet, args []string) (*Config, error) {
+	path := fs.String("config", os.Getenv(FileEnv), "YAML or TOML config file (env "+FileEnv+")")
+
+	scratch := defaults
+	values := make(map[string]*flagValue)
+	for _, f := range fields(&scratch) {
+		fv := &flagValue{value: f.value}
+		values[f.key] = fv
+		usage := f.usage
+		if f.env != "" {
+			usage = strings.TrimSpace(usage + " (env " + f.env + ")")
+		}
+		fs.Var(fv, f.key, usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	src := &source{defaults: defaults, path: *path, flags: make(map[string]string)}
+	fs.Visit(func(f *flag.Flag) {
+		if fv, ok := values[f.Name]; ok {
+			src.flags[f.Name] = fv.raw
+		}
+	})
+	return src.build()
+}
+
+func (src *source) build() (*Config, error) {
+	cfg := src.defaults
+	if src.path != "" {
+		if err := loadFile(&cfg, src.path); err != nil {
+			return nil, err
+		}
+	}
+
+	var errs []error
+	for _, f := range fields(&cfg) {
+		if f.env == "" {
+			continue
+		}
+		if s, ok := os.LookupEnv(f.env); ok && s != "" {
+			if err := set(f.value, s); err != nil {
+				errs = append(errs, fmt.Errorf("%s (env %s): %v", f.key, f.env, err))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, &ValidationError{Errors: errs}
+	}
+
+	for _, f := range fields(&cfg) {
+		if raw, ok := src.flags[f.key]; ok {
+			// The syntax was already checked by flagValue.Set.
+			_ = set(f.value, raw)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	cfg.src = src
+	return &cfg, nil
+}
+
+// Changes lists the settings that differ after a Reload.
+type Changes struct {
+	Applied  []string // changed and applied live
+	Rejected []string // changed, but only take effect after a restart
+}
+
+// Reload repeats the layering that produced c, re-reading the config file and
+// the environment; flags keep the values given at startup. The returned
+// configuration takes the changed live settings and keeps the current value
+// of every other setting. A Config not built by Load reloads from its own
+// values, which changes nothing.
+func (c *Config) Reload() (*Config, Changes, error) {
+	src := c.src
+	if src == nil {
+		src = &source{defaults: *c}
+	}
+	next, err := src.build()
+	if err != nil {
+		return nil, Changes{}, err
+	}
+
+	merged := *c
+	var changes Changes
+	cur, nxt, dst := fields(c), fields(next), fields(&merged)
+	for i := range cur {
+		if equal(cur[i].value, nxt[i].value) {
+			continue
+		}
+		if !cur[i].live {
+			changes.Rejected = append(changes.Rejected, cur[i].key)
+			continue
+		}
+		dst[i].value.Set(nxt[i].value)
+		changes.Applied = append(changes.Applied, cur[i].key)
+	}
+	return &merged, changes, nil
+}
+
+func equal(a, b reflect.Value) bool {
+	if a.Kind() == reflect.Slice && a.Len() == 0 && b.Len() == 0 {
+		return true // nil and empty lists mean the same
+	}
+	return reflect.DeepEqual(a.Interface(), b.Interface())
+}
+
+// loadFile decodes path into cfg, rejecting keys Config does not have so a
+// typo does not silently fall back to the default.
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && err != io.EOF {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	case ".toml":
+		md, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			keys := make([]string, len(undecoded))
+			for i, k := range undecoded {
+				keys[i] = k.String()
+			}
+			return fmt.Errorf("%s: unknown keys %s", path, strings.Join(keys, ", "))
+		}
+	default:
+		return fmt.Errorf("%s: unsupported config format %q, use .yaml, .yml or .toml", path, ext)
+	}
+	return nil
+}
+
+// Redacted returns a copy of c with every secret replaced, safe to log or
+// print.
+func (c Config) Redacted() Config {
+	for _, f := range fields(&c) {
+		if f.secret && f.value.String() != "" {
+			f.value.SetString("********")
+		}
+	}
+	return c
+}
+
+// WriteYAML writes c as a config file that Load accepts back.
+func (c Config) WriteYAML(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c); err != nil {
+		return err
+	}
+	return enc.Close()
+}
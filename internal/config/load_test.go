@@ -0,0 +1,274 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// isolateEnv blanks every variable Load reads, so settings of the machine
+// running the tests do not leak in; empty variables count as unset.
+func isolateEnv(t *testing.T) {
+	t.Helper()
+	t.Setenv(FileEnv, "")
+	cfg := Default()
+	for _, f := range fields(&cfg) {
+		if f.env != "" {
+			t.Setenv(f.env, "")
+		}
+	}
+}
+
+// writeFile writes a config file named name into a temporary directory.
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func load(args ...string) (*Config, error) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return Load(Default(), fs, args)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	yamlFile := "server:\n  port: 9001\nlog:\n  level: warn\n"
+	tomlFile := "[server]\nport = 9001\n\n[log]\nlevel = \"warn\"\n"
+	tests := []struct {
+		name      string
+		file      string // file name, its extension picks the format
+		content   string
+		env       map[string]string
+		flags     []string
+		wantPort  int
+		wantLevel string
+	}{
+		{name: "defaults", wantPort: 8080, wantLevel: "debug"},
+		{name: "yaml file over defaults", file: "c.yaml", content: yamlFile, wantPort: 9001, wantLevel: "warn"},
+		{name: "toml file over defaults", file: "c.toml", content: tomlFile, wantPort: 9001, wantLevel: "warn"},
+		{name: "env over file", file: "c.yaml", content: yamlFile,
+			env: map[string]string{"PORT": "9002"}, wantPort: 9002, wantLevel: "warn"},
+		{name: "flag over env", file: "c.yml", content: yamlFile,
+			env: map[string]string{"PORT": "9002", "LOG_LEVEL": "info"}, flags: []string{"-server.port=9003"},
+			wantPort: 9003, wantLevel: "info"},
+		{name: "flag without file", flags: []string{"-log.level", "error"}, wantPort: 8080, wantLevel: "error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolateEnv(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			args := tt.flags
+			if tt.file != "" {
+				args = append([]string{"-config", writeFile(t, tt.file, tt.content)}, args...)
+			}
+			cfg, err := load(args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Server.Port != tt.wantPort || cfg.Log.Level != tt.wantLevel {
+				t.Errorf("port %d, level %q; want %d, %q", cfg.Server.Port, cfg.Log.Level, tt.wantPort, tt.wantLevel)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFileFromEnv(t *testing.T) {
+	isolateEnv(t)
+	t.Setenv(FileEnv, writeFile(t, "c.yaml", "server:\n  port: 9004\n"))
+	cfg, err := load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Port != 9004 {
+		t.Errorf("port %d, want 9004 from the file in %s", cfg.Server.Port, FileEnv)
+	}
+}
+
+func TestLoadParsesEnv(t *testing.T) {
+	isolateEnv(t)
+	t.Setenv("DB_QUERY_TIMEOUT", "750ms")
+	t.Setenv("AUTH_LOCKOUT_DURATION", "1h30m")
+	t.Setenv("CORS_ALLOWED_ORIGINS", " https://a.example , ,https://b.example")
+	t.Setenv("AUTH_PUBLIC_READS", "false")
+	t.Setenv("TRACING_SAMPLE_RATIO", "0.25")
+	t.Setenv("REDIS_DB", "3")
+
+	cfg, err := load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Storage.QueryTimeout.Std(); got != 750*time.Millisecond {
+		t.Errorf("storage.query_timeout %v", got)
+	}
+	if got := cfg.Auth.LockoutDuration.Std(); got != 90*time.Minute {
+		t.Errorf("auth.lockout_duration %v", got)
+	}
+	if want := []string{"https://a.example", "https://b.example"}; !slices.Equal(cfg.CORS.AllowedOrigins, want) {
+		t.Errorf("cors.allowed_origins %q, want %q", cfg.CORS.AllowedOrigins, want)
+	}
+	if cfg.Auth.PublicReads {
+		t.Error("auth.public_reads still true")
+	}
+	if cfg.Tracing.SampleRatio != 0.25 || cfg.Redis.DB != 3 {
+		t.Errorf("tracing.sample_ratio %v, redis.db %d", cfg.Tracing.SampleRatio, cfg.Redis.DB)
+	}
+}
+
+func TestLoadRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		file    string
+		content string
+		flags   []string
+		want    string // part of the error
+	}{
+		{name: "integer env", env: map[string]string{"PORT": "eighty"}, want: "server.port (env PORT): not an integer"},
+		{name: "duration env", env: map[string]string{"DB_QUERY_TIMEOUT": "5"}, want: "storage.query_timeout (env DB_QUERY_TIMEOUT)"},
+		{name: "boolean env", env: map[string]string{"CACHE_ENABLED": "maybe"}, want: "cache.enabled (env CACHE_ENABLED): not a boolean"},
+		{name: "duration flag", flags: []string{"-cache.book_ttl=soon"}, want: "cache.book_ttl"},
+		{name: "unknown yaml key", file: "c.yaml", content: "server:\n  prot: 80\n", want: "prot"},
+		{name: "unknown toml key", file: "c.toml", content: "[server]\nprot = 80\n", want: "unknown keys server.prot"},
+		{name: "unsupported format", file: "c.json", content: "{}", want: `unsupported config format ".json"`},
+		{name: "invalid value from file", file: "c.yaml", content: "log:\n  level: loud\n", want: "log.level"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolateEnv(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			args := tt.flags
+			if tt.file != "" {
+				args = append([]string{"-config", writeFile(t, tt.file, tt.content)}, args...)
+			}
+			_, err := load(args...)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load error = %v, want one mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteYAMLRoundTrip(t *testing.T) {
+	isolateEnv(t)
+	want := Default()
+	want.Server.Port = 9005
+	want.CORS.AllowedOrigins = []string{"https://a.example"}
+	want.Cache.BookTTL = Duration(42 * time.Second)
+
+	var buf bytes.Buffer
+	if err := want.WriteYAML(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got, err := load("-config", writeFile(t, "c.yaml", buf.String()))
+	if err != nil {
+		t.Fatalf("Load of WriteYAML output: %v\n%s", err, buf.String())
+	}
+	if got.Server.Port != 9005 || got.Cache.BookTTL != want.Cache.BookTTL || !slices.Equal(got.CORS.AllowedOrigins, want.CORS.AllowedOrigins) {
+		t.Errorf("round trip lost settings:\n%s", buf.String())
+	}
+}
+
+func TestRedactedMasksSecrets(t *testing.T) {
+	cfg := Default()
+	secrets := 0
+	for _, f := range fields(&cfg) {
+		if f.secret {
+			f.value.SetString("hunter2-" + f.key)
+			secrets++
+		}
+	}
+	if secrets < 4 {
+		t.Fatalf("found %d secret fields, want at least 4", secrets)
+	}
+
+	redacted := cfg.Redacted()
+	for _, f := range fields(&redacted) {
+		if f.secret && f.value.String() != "********" {
+			t.Errorf("%s = %q after Redacted", f.key, f.value.String())
+		}
+	}
+	var buf bytes.Buffer
+	if err := redacted.WriteYAML(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "hunter2") {
+		t.Errorf("redacted YAML holds a secret:\n%s", buf.String())
+	}
+	if cfg.Postgres.Password != "hunter2-postgres.password" {
+		t.Error("Redacted changed the original config")
+	}
+
+	// Empty secrets stay empty, so the output shows they are unset.
+	if got := Default().Redacted().Auth.JWTSecret; got != "" {
+		t.Errorf("empty jwt_secret redacted to %q", got)
+	}
+}
+
+func TestReload(t *testing.T) {
+	isolateEnv(t)
+	path := writeFile(t, "c.yaml", "server:\n  port: 9001\nlog:\n  level: info\ncache:\n  book_ttl: 1m\n")
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://a.example")
+	cfg, err := load("-config", path, "-rate_limit.reads_per_minute=100")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Live: log.level, cache.book_ttl and, through the env, cors.allowed_origins.
+	// Restart only: server.port and redis.host. The flag keeps its value.
+	err = os.WriteFile(path, []byte("server:\n  port: 9002\nlog:\n  level: warn\ncache:\n  book_ttl: 2m\n"+
+		"redis:\n  host: cache.internal\nrate_limit:\n  reads_per_minute: 5\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://b.example")
+
+	next, changes, err := cfg.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"log.level", "cache.book_ttl", "cors.allowed_origins"}; !slices.Equal(changes.Applied, want) {
+		t.Errorf("applied %q, want %q", changes.Applied, want)
+	}
+	if want := []string{"server.port", "redis.host"}; !slices.Equal(changes.Rejected, want) {
+		t.Errorf("rejected %q, want %q", changes.Rejected, want)
+	}
+	if next.Log.Level != "warn" || next.Cache.BookTTL.Std() != 2*time.Minute || !slices.Equal(next.CORS.AllowedOrigins, []string{"https://b.example"}) {
+		t.Errorf("live settings not applied: level %q, book_ttl %v, origins %q", next.Log.Level, next.Cache.BookTTL, next.CORS.AllowedOrigins)
+	}
+	if next.Server.Port != 9001 || next.Redis.Host != "localhost" {
+		t.Errorf("restart-only settings changed: port %d, redis host %q", next.Server.Port, next.Redis.Host)
+	}
+	if next.RateLimit.ReadsPerMinute != 100 {
+		t.Errorf("rate_limit.reads_per_minute %d, want 100 from the flag", next.RateLimit.ReadsPerMinute)
+	}
+	if cfg.Log.Level != "info" {
+		t.Error("Reload changed the current config")
+	}
+
+	// The reloaded config reloads again from the same sources.
+	if _, changes, err := next.Reload(); err != nil || len(changes.Applied) != 0 {
+		t.Errorf("second Reload = %+v, %v; want no live changes", changes, err)
+	}
+
+	// An invalid file keeps the current configuration.
+	if err := os.WriteFile(path, []byte("log:\n  level: loud\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := next.Reload(); err == nil || !strings.Contains(err.Error(), "log.level") {
+		t.Errorf("Reload of an invalid file error = %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+)
+
+// Error kinds shared by every layer. Storage backends wrap their driver
+// errors into one of these so callers can react without string matching.
+var (
+	ErrNotFound    = errors.New("not found")
+	ErrConflict    = errors.New("conflict")
+	ErrValidation  = errors.New("validation failed")
+	ErrUnavailable = errors.New("service unavailable")
+)
+
+// Error ties an error kind to the entity and operation it happened in. It
+// unwraps to both the kind and the underlying cause, so errors.Is works with
+// the sentinels above and errors.As still reaches driver errors.
+type Error struct {
+	Kind   error
+	Entity string
+	Op     string
+	Err    error
+}
+
+// NewError builds a domain error. entity, op and err may be empty.
+func NewError(kind error, entity, op string, err error) *Error {
+	return &Error{Kind: kind, Entity: entity, Op: op, Err: err}
+}
+
+// NotFound reports a missing entity.
+func NotFound(entity, op string) *Error {
+	return NewError(ErrNotFound, entity, op, nil)
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	if e.Op != "" {
+		b.WriteString(e.Op)
+		b.WriteString(": ")
+	}
+	if e.Entity != "" {
+		b.WriteString(e.Entity)
+		b.WriteString(" ")
+	}
+	b.WriteString(e.Kind.Error())
+	if e.Err != nil {
+		b.WriteString(": ")
+		b.WriteString(e.Err.Error())
+	}
+	return b.String()
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// Kind returns the sentinel kind of err, or nil for unclassified errors.
+func Kind(err error) error {
+	for _, kind := range []error{ErrNotFound, ErrConflict, ErrValidation, ErrUnavailable} {
+		if errors.Is(err, kind) {
+			return kind
+		}
+	}
+	return nil
+}
+
+// EntityOf returns the entity named by the first domain error in err's chain.
+func EntityOf(err error) string {
+	var de *Error
+	if errors.As(err, &de) {
+		return de.Entity
+	}
+	return ""
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// APIKey is a credential for machine clients. Only a hash of the key is
+// stored; Prefix, the first characters of the key, lets people recognize it.
+type APIKey struct {
+	XMLName    xml.Name   `json:"-" msgpack:"-" csv:"-" xml:"api_key"`
+	ID         string     `json:"id" xml:"id"`
+	Name       string     `json:"name" xml:"name"`
+	Prefix     string     `json:"prefix" xml:"prefix"`
+	Scopes     []string   `json:"scopes" xml:"scopes>scope"`
+	CreatedBy  string     `json:"created_by" xml:"created_by"`
+	CreatedAt  time.Time  `json:"created_at" xml:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty" xml:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" xml:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" xml:"revoked_at,omitempty"`
+}
+
+// Active reports whether the key may be used at now.
+func (k APIKey) Active(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
@@ -1,12 +1,16 @@
 package models
 
-import "time"
+import (
+	"encoding/xml"
+	"time"
+)
 
 type Book struct {
-	ID         string    `json:"id"`
-	Title      string    `json:"title"`
-	Author     string    `json:"author"`
-	Year       int       `json:"year"`
-	Created_at time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at,omitempty"`
-}
\ No newline at end of file
+	XMLName    xml.Name  `json:"-" msgpack:"-" csv:"-" xml:"book"`
+	ID         string    `json:"id" xml:"id"`
+	Title      string    `json:"title" xml:"title"`
+	Author     string    `json:"author" xml:"author"`
+	Year       int       `json:"year" xml:"year"`
+	Created_at time.Time `json:"created_at" xml:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at,omitempty" xml:"updated_at,omitempty"`
+}
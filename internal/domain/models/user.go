@@ -0,0 +1,33 @@
+package models
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// User is a registered account. PasswordHash and the lockout counters never
+// leave the server.
+type User struct {
+	XMLName      xml.Name   `json:"-" msgpack:"-" csv:"-" xml:"user"`
+	ID           string     `json:"id" xml:"id"`
+	Email        string     `json:"email" xml:"email"`
+	Roles        []string   `json:"roles" xml:"roles>role"`
+	PasswordHash string     `json:"-" msgpack:"-" csv:"-" xml:"-"`
+	FailedLogins int        `json:"-" msgpack:"-" csv:"-" xml:"-"`
+	LockedUntil  *time.Time `json:"locked_until,omitempty" xml:"locked_until,omitempty"`
+	CreatedAt    time.Time  `json:"created_at" xml:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at,omitempty" xml:"updated_at,omitempty"`
+}
+
+// RefreshToken is a server-side login session. Every refresh replaces the
+// token with a new one of the same family; presenting a replaced token again
+// revokes the whole family.
+type RefreshToken struct {
+	ID         string
+	UserID     string
+	FamilyID   string
+	ExpiresAt  time.Time
+	RevokedAt  *time.Time
+	ReplacedBy string
+	CreatedAt  time.Time
+}
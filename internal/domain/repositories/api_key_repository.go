@@ -0,0 +1,20 @@
+package repositories
+
+import (
+	"context"
+	"libraryapi/internal/domain/models"
+	"time"
+)
+
+// APIKeyRepository stores API keys by the hash of their plaintext. It is
+// implemented by the backends that support API keys.
+type APIKeyRepository interface {
+	// CreateAPIKey stores key with the given hash, assigning ID and CreatedAt.
+	CreateAPIKey(ctx context.Context, key models.APIKey, hash string) (models.APIKey, error)
+	// ListAPIKeys returns every key, newest first, revoked ones included.
+	ListAPIKeys(ctx context.Context) ([]models.APIKey, error)
+	APIKeyByHash(ctx context.Context, hash string) (models.APIKey, error)
+	// RevokeAPIKey marks a key revoked; revoking it again is a no-op.
+	RevokeAPIKey(ctx context.Context, id string) error
+	TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error
+}
@@ -1,15 +1,31 @@
 package repositories
 
 import (
+	"context"
 	"libraryapi/internal/api/dto"
 	"libraryapi/internal/domain/models"
 )
 
+// BookRepository is implemented by every storage backend. All methods honor
+// ctx cancellation and deadlines and report failures as domain errors.
 type BookRepository interface {
-	Getall(pagi dto.Pagination) ([]models.Book, int, error)
-	Getbyid(id string) (models.Book, error)
-	Create(title string, author string, year int) models.Book
-	Update(id string, updated models.Book) (models.Book, error)
-	Delete(id string) error
-	Search(title, author string, year int) ([]models.Book, error)
+	Getall(ctx context.Context, pagi dto.Pagination) ([]models.Book, int, error)
+	Getbyid(ctx context.Context, id string) (models.Book, error)
+	Create(ctx context.Context, title string, author string, year int) (models.Book, error)
+	Update(ctx context.Context, id string, updated models.Book) (models.Book, error)
+	Delete(ctx context.Context, id string) error
+	Search(ctx context.Context, title, author string, year int) ([]models.Book, error)
+}
+
+// Reindexer is implemented by backends with a search index that can be
+// rebuilt from the books table.
+type Reindexer interface {
+	Reindex(ctx context.Context) error
+}
+
+// RoleRepository is implemented by backends that store roles and their
+// permissions. Backends without it use the built-in role table.
+type RoleRepository interface {
+	// RolePermissions returns the permission names of every role.
+	RolePermissions(ctx context.Context) (map[string][]string, error)
 }
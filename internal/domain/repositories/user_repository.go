@@ -0,0 +1,43 @@
+package repositories
+
+import (
+	"context"
+	"libraryapi/internal/domain/models"
+	"time"
+)
+
+// UserRepository stores accounts. Emails are unique, compared
+// case-insensitively; CreateUser reports a duplicate as domain.ErrConflict.
+type UserRepository interface {
+	CreateUser(ctx context.Context, user models.User) (models.User, error)
+	UserByID(ctx context.Context, id string) (models.User, error)
+	UserByEmail(ctx context.Context, email string) (models.User, error)
+	ListUsers(ctx context.Context) ([]models.User, error)
+	SetUserRoles(ctx context.Context, id string, roles []string) (models.User, error)
+	SetPassword(ctx context.Context, id string, hash string) error
+	// SetLoginState records failed logins and the lockout of an account.
+	SetLoginState(ctx context.Context, id string, failedLogins int, lockedUntil *time.Time) error
+	// RecordFailedLogin counts a failed login atomically, so concurrent
+	// guesses cannot overwrite each other's count. The max-th failure in a
+	// row locks the account until lockedUntil and restarts the count; locked
+	// reports whether this failure did.
+	RecordFailedLogin(ctx context.Context, id string, max int, lockedUntil time.Time) (locked bool, err error)
+}
+
+// TokenRepository stores refresh and password reset tokens by the hash of
+// their plaintext.
+type TokenRepository interface {
+	CreateRefreshToken(ctx context.Context, token models.RefreshToken, hash string) error
+	RefreshTokenByHash(ctx context.Context, hash string) (models.RefreshToken, error)
+	// RotateRefreshToken revokes the token id in favor of next. It fails with
+	// domain.ErrConflict when id was already revoked, so a token cannot be
+	// rotated twice by concurrent requests.
+	RotateRefreshToken(ctx context.Context, id string, next models.RefreshToken, nextHash string) error
+	RevokeRefreshFamily(ctx context.Context, familyID string) error
+	RevokeUserRefreshTokens(ctx context.Context, userID string) error
+
+	CreatePasswordReset(ctx context.Context, userID, hash string, expiresAt time.Time) error
+	// ConsumePasswordReset marks an unused, unexpired token used and returns
+	// its user; any other token is domain.ErrNotFound.
+	ConsumePasswordReset(ctx context.Context, hash string, now time.Time) (string, error)
+}
@@ -0,0 +1,300 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"libraryapi/internal/domain"
+	"libraryapi/internal/domain/models"
+	"libraryapi/internal/domain/repositories"
+	"libraryapi/internal/pkg/logger"
+	"libraryapi/internal/pkg/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidCredentials  = errors.New("invalid email or password")
+	ErrAccountLocked       = errors.New("account locked")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrInvalidResetToken   = errors.New("invalid password reset token")
+	ErrResetUnavailable    = errors.New("password reset is unavailable: no mailer configured")
+)
+
+// AccountOptions configures sessions and lockout.
+type AccountOptions struct {
+	RefreshTTL      time.Duration
+	MaxFailedLogins int
+	LockoutDuration time.Duration
+	ResetTTL        time.Duration
+	ResetURL        string // page the reset mail links to; empty sends the bare token
+}
+
+// Tokens is the result of a login or refresh.
+type Tokens struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time // of the access token
+}
+
+// Accounts registers users, logs them in and manages their sessions.
+// Refresh tokens rotate on every use; presenting a rotated token again is
+// taken as theft and ends the whole session.
+type Accounts struct {
+	users  repositories.UserRepository
+	tokens repositories.TokenRepository
+	signer *Signer
+	mailer mail.Mailer // nil disables password reset
+	opts   AccountOptions
+
+	// dummyHash is checked for unknown emails so they take as long to
+	// reject as wrong passwords.
+	dummyHash string
+}
+
+func NewAccounts(users repositories.UserRepository, tokens repositories.TokenRepository, signer *Signer, mailer mail.Mailer, opts AccountOptions) (*Accounts, error) {
+	dummy, err := HashPassword("not a password")
+	if err != nil {
+		return nil, err
+	}
+	return &Accounts{users: users, tokens: tokens, signer: signer, mailer: mailer, opts: opts, dummyHash: dummy}, nil
+}
+
+// NormalizeEmail is the form emails are stored and looked up in.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// opaqueToken returns a random token with the given prefix; only its
+// HashAPIKey hash is stored.
+func opaqueToken(prefix string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return prefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Register creates an account with the patron role. A taken email is
+// domain.ErrConflict.
+func (a *Accounts) Register(ctx context.Context, email, password string) (models.User, error) {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return models.User{}, err
+	}
+	return a.users.CreateUser(ctx, models.User{
+		Email:        NormalizeEmail(email),
+		PasswordHash: hash,
+		Roles:        []string{RolePatron},
+	})
+}
+
+// Login checks the password and starts a session. MaxFailedLogins wrong
+// passwords in a row lock the account for LockoutDuration; while locked,
+// even the right password is refused with ErrAccountLocked.
+func (a *Accounts) Login(ctx context.Context, email, password string) (Tokens, models.User, error) {
+	user, err := a.users.UserByEmail(ctx, NormalizeEmail(email))
+	if errors.Is(err, domain.ErrNotFound) {
+		CheckPassword(a.dummyHash, password)
+		return Tokens{}, models.User{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return Tokens{}, models.User{}, err
+	}
+
+	now := time.Now()
+	if user.LockedUntil != nil && now.Before(*user.LockedUntil) {
+		return Tokens{}, models.User{}, fmt.Errorf("%w until %s", ErrAccountLocked, user.LockedUntil.UTC().Format(time.RFC3339))
+	}
+
+	ok, err := CheckPassword(user.PasswordHash, password)
+	if err != nil {
+		return Tokens{}, models.User{}, fmt.Errorf("check password of %s: %w", user.ID, err)
+	}
+	if !ok {
+		// The count is kept in storage: parallel guesses all read the same
+		// user, so counting here would let them slip past the lockout.
+		until := now.Add(a.opts.LockoutDuration)
+		locked, err := a.users.RecordFailedLogin(ctx, user.ID, a.opts.MaxFailedLogins, until)
+		if err != nil {
+			return Tokens{}, models.User{}, err
+		}
+		if locked {
+			logger.Ctx(ctx).Warn().Str("user_id", user.ID).Time("locked_until", until).Msg("Account locked after repeated failed logins")
+			return Tokens{}, models.User{}, fmt.Errorf("%w until %s", ErrAccountLocked, until.UTC().Format(time.RFC3339))
+		}
+		return Tokens{}, models.User{}, ErrInvalidCredentials
+	}
+
+	if user.FailedLogins > 0 || user.LockedUntil != nil {
+		if err := a.users.SetLoginState(ctx, user.ID, 0, nil); err != nil {
+			return Tokens{}, models.User{}, err
+		}
+		user.FailedLogins, user.LockedUntil = 0, nil
+	}
+
+	tokens, err := a.startSession(ctx, user, uuid.New().String(), "")
+	if err != nil {
+		return Tokens{}, models.User{}, err
+	}
+	return tokens, user, nil
+}
+
+// startSession signs an access token and stores a refresh token in family.
+// When previous is set, it is rotated out in favor of the new token.
+func (a *Accounts) startSession(ctx context.Context, user models.User, family, previous string) (Tokens, error) {
+	access, expiresAt, err := a.signer.Sign(user.ID, user.Roles)
+	if err != nil {
+		return Tokens{}, err
+	}
+	refresh, err := opaqueToken("rt_")
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	token := models.RefreshToken{
+		ID:        uuid.New().String(),
+		UserID:    user.ID,
+		FamilyID:  family,
+		ExpiresAt: time.Now().Add(a.opts.RefreshTTL),
+	}
+	if previous == "" {
+		err = a.tokens.CreateRefreshToken(ctx, token, HashAPIKey(refresh))
+	} else {
+		err = a.tokens.RotateRefreshToken(ctx, previous, token, HashAPIKey(refresh))
+	}
+	if err != nil {
+		return Tokens{}, err
+	}
+	return Tokens{AccessToken: access, RefreshToken: refresh, ExpiresAt: expiresAt}, nil
+}
+
+// Refresh exchanges a refresh token for a new access and refresh token. The
+// access token carries the user's current roles.
+func (a *Accounts) Refresh(ctx context.Context, refreshToken string) (Tokens, error) {
+	token, err := a.tokens.RefreshTokenByHash(ctx, HashAPIKey(refreshToken))
+	if errors.Is(err, domain.ErrNotFound) {
+		return Tokens{}, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return Tokens{}, err
+	}
+	if token.RevokedAt != nil {
+		if token.ReplacedBy != "" {
+			a.revokeReused(ctx, token)
+		}
+		return Tokens{}, ErrInvalidRefreshToken
+	}
+	if !time.Now().Before(token.ExpiresAt) {
+		return Tokens{}, ErrInvalidRefreshToken
+	}
+
+	user, err := a.users.UserByID(ctx, token.UserID)
+	if errors.Is(err, domain.ErrNotFound) {
+		return Tokens{}, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	tokens, err := a.startSession(ctx, user, token.FamilyID, token.ID)
+	if errors.Is(err, domain.ErrConflict) {
+		// Another request rotated the token first.
+		a.revokeReused(ctx, token)
+		return Tokens{}, ErrInvalidRefreshToken
+	}
+	return tokens, err
+}
+
+// revokeReused ends the session of a refresh token that was used after it
+// had been rotated: either the client or an attacker holds a stolen copy.
+func (a *Accounts) revokeReused(ctx context.Context, token models.RefreshToken) {
+	logger.Ctx(ctx).Warn().Str("user_id", token.UserID).Str("family_id", token.FamilyID).Msg("Refresh token reused, revoking the session")
+	if err := a.tokens.RevokeRefreshFamily(ctx, token.FamilyID); err != nil {
+		logger.Ctx(ctx).Error().Err(err).Str("family_id", token.FamilyID).Msg("Failed to revoke session")
+	}
+}
+
+// Logout ends the session of refreshToken. Unknown tokens are ignored.
+func (a *Accounts) Logout(ctx context.Context, refreshToken string) error {
+	token, err := a.tokens.RefreshTokenByHash(ctx, HashAPIKey(refreshToken))
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return a.tokens.RevokeRefreshFamily(ctx, token.FamilyID)
+}
+
+// RequestPasswordReset mails a reset token to email. It succeeds whether or
+// not the account exists, so it cannot be used to probe for accounts.
+// Without a mailer it fails with ErrResetUnavailable for every email.
+func (a *Accounts) RequestPasswordReset(ctx context.Context, email string) error {
+	if a.mailer == nil {
+		return ErrResetUnavailable
+	}
+	user, err := a.users.UserByEmail(ctx, NormalizeEmail(email))
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := opaqueToken("pr_")
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(a.opts.ResetTTL)
+	if err := a.tokens.CreatePasswordReset(ctx, user.ID, HashAPIKey(token), expiresAt); err != nil {
+		return err
+	}
+
+	link := token
+	if a.opts.ResetURL != "" {
+		link = a.opts.ResetURL + "?token=" + url.QueryEscape(token)
+	}
+	err = a.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your Library password",
+		Body: fmt.Sprintf("Someone asked to reset the password of your Library account.\n\n"+
+			"Use this to choose a new password before %s:\n\n%s\n\n"+
+			"If it was not you, ignore this mail; your password stays the same.\n",
+			expiresAt.UTC().Format(time.RFC1123), link),
+	})
+	if err != nil {
+		// Reporting the failure would tell the caller the account exists.
+		logger.Ctx(ctx).Error().Err(err).Str("user_id", user.ID).Msg("Failed to send password reset mail")
+	}
+	return nil
+}
+
+// ResetPassword sets a new password with a token from RequestPasswordReset.
+// Tokens work once. The reset unlocks the account and ends all its sessions.
+func (a *Accounts) ResetPassword(ctx context.Context, token, password string) error {
+	userID, err := a.tokens.ConsumePasswordReset(ctx, HashAPIKey(token), time.Now())
+	if errors.Is(err, domain.ErrNotFound) {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return err
+	}
+
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	if err := a.users.SetPassword(ctx, userID, hash); err != nil {
+		return err
+	}
+	if err := a.users.SetLoginState(ctx, userID, 0, nil); err != nil {
+		return err
+	}
+	return a.tokens.RevokeUserRefreshTokens(ctx, userID)
+}
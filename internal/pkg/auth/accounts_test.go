@@ -0,0 +1,239 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	memstorage "libraryapi/internal/Storage"
+	"libraryapi/internal/domain"
+	"libraryapi/internal/domain/repositories"
+	"libraryapi/internal/pkg/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// outbox records sent mail.
+type outbox struct {
+	mu   sync.Mutex
+	sent []mail.Message
+}
+
+func (o *outbox) Send(ctx context.Context, msg mail.Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.sent = append(o.sent, msg)
+	return nil
+}
+
+func newTestAccounts(t *testing.T, mailer mail.Mailer) (*Accounts, *Verifier) {
+	t.Helper()
+	repo := memstorage.NewMemory()
+	signer, err := NewSigner(secret, "library", "", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts, err := NewAccounts(repo.(repositories.UserRepository), repo.(repositories.TokenRepository), signer, mailer, AccountOptions{
+		RefreshTTL:      time.Hour,
+		MaxFailedLogins: 3,
+		LockoutDuration: time.Minute,
+		ResetTTL:        time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := NewVerifier(VerifierOptions{Secret: secret, Issuer: "library"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return accounts, verifier
+}
+
+func TestPasswordHash(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$") {
+		t.Errorf("hash %q is not in PHC argon2id format", hash)
+	}
+	if ok, err := CheckPassword(hash, "correct horse"); !ok || err != nil {
+		t.Errorf("CheckPassword(right) = %v, %v", ok, err)
+	}
+	if ok, err := CheckPassword(hash, "wrong horse"); ok || err != nil {
+		t.Errorf("CheckPassword(wrong) = %v, %v", ok, err)
+	}
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := CheckPassword(string(bcryptHash), "password"); !ok || err != nil {
+		t.Errorf("CheckPassword(bcrypt) = %v, %v", ok, err)
+	}
+	if _, err := CheckPassword("plain", "plain"); err == nil {
+		t.Error("CheckPassword accepted a malformed hash")
+	}
+}
+
+func TestAccountsLogin(t *testing.T) {
+	ctx := context.Background()
+	accounts, verifier := newTestAccounts(t, &outbox{})
+
+	user, err := accounts.Register(ctx, " Reader@Example.com ", "long enough")
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if user.Email != "reader@example.com" || len(user.Roles) != 1 || user.Roles[0] != RolePatron {
+		t.Errorf("registered %+v, want a patron with a normalized email", user)
+	}
+	if _, err := accounts.Register(ctx, "READER@example.com", "long enough"); !errors.Is(err, domain.ErrConflict) {
+		t.Errorf("Register(taken email) error = %v, want ErrConflict", err)
+	}
+
+	tokens, _, err := accounts.Login(ctx, "reader@example.com", "long enough")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	p, err := verifier.Verify(ctx, tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("Verify(access token): %v", err)
+	}
+	if p.Subject != user.ID || !p.HasRole(RolePatron) {
+		t.Errorf("principal %+v, want subject %s with role patron", p, user.ID)
+	}
+
+	if _, _, err := accounts.Login(ctx, "nobody@example.com", "long enough"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Login(unknown email) error = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestAccountsLockout(t *testing.T) {
+	ctx := context.Background()
+	accounts, _ := newTestAccounts(t, &outbox{})
+	if _, err := accounts.Register(ctx, "reader@example.com", "long enough"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i < 3; i++ {
+		if _, _, err := accounts.Login(ctx, "reader@example.com", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("failed login %d error = %v, want ErrInvalidCredentials", i, err)
+		}
+	}
+	if _, _, err := accounts.Login(ctx, "reader@example.com", "wrong"); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("third failed login error = %v, want ErrAccountLocked", err)
+	}
+	if _, _, err := accounts.Login(ctx, "reader@example.com", "long enough"); !errors.Is(err, ErrAccountLocked) {
+		t.Errorf("login to locked account error = %v, want ErrAccountLocked", err)
+	}
+
+	// Parallel guesses all read the account before any failure is counted;
+	// they must still lock it.
+	if _, err := accounts.Register(ctx, "target@example.com", "long enough"); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() {
+			accounts.Login(ctx, "target@example.com", "wrong")
+		})
+	}
+	wg.Wait()
+	if _, _, err := accounts.Login(ctx, "target@example.com", "long enough"); !errors.Is(err, ErrAccountLocked) {
+		t.Errorf("login after 10 parallel failures error = %v, want ErrAccountLocked", err)
+	}
+}
+
+func TestAccountsRefreshRotation(t *testing.T) {
+	ctx := context.Background()
+	accounts, _ := newTestAccounts(t, &outbox{})
+	if _, err := accounts.Register(ctx, "reader@example.com", "long enough"); err != nil {
+		t.Fatal(err)
+	}
+	first, _, err := accounts.Login(ctx, "reader@example.com", "long enough")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := accounts.Refresh(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Fatal("Refresh did not rotate the refresh token")
+	}
+
+	// Reusing the rotated token ends the session, including the new token.
+	if _, err := accounts.Refresh(ctx, first.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Refresh(rotated token) error = %v, want ErrInvalidRefreshToken", err)
+	}
+	if _, err := accounts.Refresh(ctx, second.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Refresh after reuse error = %v, want ErrInvalidRefreshToken", err)
+	}
+
+	third, _, err := accounts.Login(ctx, "reader@example.com", "long enough")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := accounts.Logout(ctx, third.RefreshToken); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	if _, err := accounts.Refresh(ctx, third.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Refresh after logout error = %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestAccountsPasswordReset(t *testing.T) {
+	ctx := context.Background()
+	box := &outbox{}
+	accounts, _ := newTestAccounts(t, box)
+	if _, err := accounts.Register(ctx, "reader@example.com", "long enough"); err != nil {
+		t.Fatal(err)
+	}
+	session, _, err := accounts.Login(ctx, "reader@example.com", "long enough")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := accounts.RequestPasswordReset(ctx, "nobody@example.com"); err != nil {
+		t.Errorf("RequestPasswordReset(unknown email) = %v, want nil", err)
+	}
+	if err := accounts.RequestPasswordReset(ctx, "reader@example.com"); err != nil {
+		t.Fatalf("RequestPasswordReset: %v", err)
+	}
+	if len(box.sent) != 1 || box.sent[0].To != "reader@example.com" {
+		t.Fatalf("sent %+v, want one mail to the account", box.sent)
+	}
+	i := strings.Index(box.sent[0].Body, "pr_")
+	if i < 0 {
+		t.Fatalf("mail body has no token:\n%s", box.sent[0].Body)
+	}
+	token := strings.Fields(box.sent[0].Body[i:])[0]
+
+	if err := accounts.ResetPassword(ctx, token, "brand new password"); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+	if err := accounts.ResetPassword(ctx, token, "another password"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Errorf("reusing reset token error = %v, want ErrInvalidResetToken", err)
+	}
+	if _, _, err := accounts.Login(ctx, "reader@example.com", "brand new password"); err != nil {
+		t.Errorf("Login with new password: %v", err)
+	}
+	if _, err := accounts.Refresh(ctx, session.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Refresh of a session from before the reset error = %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestAccountsPasswordResetWithoutMailer(t *testing.T) {
+	ctx := context.Background()
+	accounts, _ := newTestAccounts(t, nil)
+	if _, err := accounts.Register(ctx, "reader@example.com", "long enough"); err != nil {
+		t.Fatal(err)
+	}
+	for _, email := range []string{"reader@example.com", "nobody@example.com"} {
+		if err := accounts.RequestPasswordReset(ctx, email); !errors.Is(err, ErrResetUnavailable) {
+			t.Errorf("RequestPasswordReset(%s) without a mailer = %v, want ErrResetUnavailable", email, err)
+		}
+	}
+}
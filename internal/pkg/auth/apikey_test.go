@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	memstorage "libraryapi/internal/Storage"
+	"libraryapi/internal/domain/repositories"
+	"testing"
+	"time"
+)
+
+func TestAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	repo := memstorage.NewMemory().(repositories.APIKeyRepository)
+	keys := NewAPIKeys(repo)
+
+	key, plaintext, err := keys.Issue(ctx, "sync", []string{string(PermBooksWrite)}, nil, "admin")
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if key.Prefix == "" || plaintext[:len(key.Prefix)] != key.Prefix {
+		t.Errorf("prefix %q does not start plaintext %q", key.Prefix, plaintext)
+	}
+
+	p, err := keys.Verify(ctx, plaintext)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	policy := NewPolicy(DefaultRoles())
+	if !policy.Allowed(p, PermBooksWrite) || policy.Allowed(p, PermBooksRead) {
+		t.Errorf("API key principal %+v should hold exactly its scopes", p)
+	}
+	stored, _ := repo.APIKeyByHash(ctx, HashAPIKey(plaintext))
+	if stored.LastUsedAt == nil {
+		t.Error("Verify did not record last use")
+	}
+
+	if _, err := keys.Verify(ctx, plaintext+"x"); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("Verify(wrong key) error = %v, want ErrInvalidAPIKey", err)
+	}
+	if err := repo.RevokeAPIKey(ctx, key.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.Verify(ctx, plaintext); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("Verify(revoked) error = %v, want ErrInvalidAPIKey", err)
+	}
+
+	past := time.Now().Add(-time.Minute)
+	_, expired, err := keys.Issue(ctx, "old", []string{string(PermBooksRead)}, &past, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.Verify(ctx, expired); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("Verify(expired) error = %v, want ErrInvalidAPIKey", err)
+	}
+
+	if _, _, err := keys.Issue(ctx, "bad", []string{"books:everything"}, nil, "admin"); !errors.Is(err, ErrUnknownScope) {
+		t.Errorf("Issue(unknown scope) error = %v, want ErrUnknownScope", err)
+	}
+}
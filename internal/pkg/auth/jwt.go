@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrNoVerificationKey = errors.New("no verification key configured")
+	ErrTokenExpired      = errors.New("token expired")
+	ErrInvalidToken      = errors.New("invalid token")
+)
+
+// VerifierOptions configures token verification. At least one of Secret
+// (HS256) and Keys (RS256, ES256) must be set.
+type VerifierOptions struct {
+	Secret   []byte
+	Keys     *KeySet
+	Issuer   string // required iss when set
+	Audience string // required aud when set
+	Leeway   time.Duration
+}
+
+// Verifier checks JWT bearer tokens and turns their claims into a Principal.
+type Verifier struct {
+	opts    VerifierOptions
+	methods []string
+}
+
+func NewVerifier(opts VerifierOptions) (*Verifier, error) {
+	var methods []string
+	if len(opts.Secret) > 0 {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	if opts.Keys != nil {
+		methods = append(methods, jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg())
+	}
+	if len(methods) == 0 {
+		return nil, ErrNoVerificationKey
+	}
+	return &Verifier{opts: opts, methods: methods}, nil
+}
+
+// claims are the registered claims plus the ones mapped onto Principal.
+type claims struct {
+	jwt.RegisteredClaims
+	Roles []string `json:"roles,omitempty"`
+	Scope string   `json:"scope,omitempty"`
+}
+
+// Verify validates the signature, exp (required), nbf, iss and aud of token.
+// Failures wrap ErrTokenExpired or ErrInvalidToken.
+func (v *Verifier) Verify(ctx context.Context, token string) (*Principal, error) {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(v.methods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(v.opts.Leeway),
+	}
+	if v.opts.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(v.opts.Issuer))
+	}
+	if v.opts.Audience != "" {
+		opts = append(opts, jwt.WithAudience(v.opts.Audience))
+	}
+
+	var c claims
+	_, err := jwt.ParseWithClaims(token, &c, func(t *jwt.Token) (interface{}, error) {
+		if t.Method.Alg() == jwt.SigningMethodHS256.Alg() {
+			return v.opts.Secret, nil
+		}
+		kid, _ := t.Header["kid"].(string)
+		return v.opts.Keys.Key(ctx, kid)
+	}, opts...)
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return nil, fmt.Errorf("%w: %v", ErrTokenExpired, err)
+	case err != nil:
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	case c.Subject == "":
+		return nil, fmt.Errorf("%w: missing sub claim", ErrInvalidToken)
+	}
+
+	return &Principal{
+		Subject: c.Subject,
+		Roles:   c.Roles,
+		Scopes:  strings.Fields(c.Scope),
+	}, nil
+}
@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var secret = []byte("0123456789abcdef0123456789abcdef")
+
+func sign(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, c jwt.MapClaims) string {
+	t.Helper()
+	tok := jwt.NewWithClaims(method, c)
+	if kid != "" {
+		tok.Header["kid"] = kid
+	}
+	s, err := tok.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func validClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"sub":   "user-1",
+		"iss":   "https://issuer.example",
+		"aud":   "library-api",
+		"exp":   now.Add(time.Hour).Unix(),
+		"nbf":   now.Add(-time.Minute).Unix(),
+		"roles": []string{"librarian"},
+		"scope": "books:read books:write",
+	}
+}
+
+func TestVerifyHS256(t *testing.T) {
+	v, err := NewVerifier(VerifierOptions{Secret: secret, Issuer: "https://issuer.example", Audience: "library-api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	p, err := v.Verify(ctx, sign(t, jwt.SigningMethodHS256, secret, "", validClaims()))
+	if err != nil {
+		t.Fatalf("Verify(valid): %v", err)
+	}
+	if p.Subject != "user-1" || !p.HasRole("librarian") || len(p.Scopes) != 2 {
+		t.Errorf("principal = %+v", p)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(jwt.MapClaims)
+		key    []byte
+		want   error
+	}{
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, secret, ErrTokenExpired},
+		{"no exp", func(c jwt.MapClaims) { delete(c, "exp") }, secret, ErrInvalidToken},
+		{"not yet valid", func(c jwt.MapClaims) { c["nbf"] = time.Now().Add(time.Hour).Unix() }, secret, ErrInvalidToken},
+		{"wrong issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example" }, secret, ErrInvalidToken},
+		{"wrong audience", func(c jwt.MapClaims) { c["aud"] = "other-api" }, secret, ErrInvalidToken},
+		{"no subject", func(c jwt.MapClaims) { delete(c, "sub") }, secret, ErrInvalidToken},
+		{"wrong secret", func(jwt.MapClaims) {}, []byte("another-secret-of-thirty-two-byte"), ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validClaims()
+			tt.mutate(c)
+			_, err := v.Verify(ctx, sign(t, jwt.SigningMethodHS256, tt.key, "", c))
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Verify error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("alg none", func(t *testing.T) {
+		tok := sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "", validClaims())
+		if _, err := v.Verify(ctx, tok); !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("Verify(alg none) error = %v, want ErrInvalidToken", err)
+		}
+	})
+}
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+func TestVerifyJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+	}})
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, jwks, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := NewVerifier(VerifierOptions{Keys: NewKeySetFile(path)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if _, err := v.Verify(ctx, sign(t, jwt.SigningMethodRS256, rsaKey, "rsa-1", validClaims())); err != nil {
+		t.Errorf("Verify(RS256): %v", err)
+	}
+	if _, err := v.Verify(ctx, sign(t, jwt.SigningMethodES256, ecKey, "ec-1", validClaims())); err != nil {
+		t.Errorf("Verify(ES256): %v", err)
+	}
+	if _, err := v.Verify(ctx, sign(t, jwt.SigningMethodES256, ecKey, "rsa-1", validClaims())); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Verify(ES256 with the RSA kid) error = %v, want ErrInvalidToken", err)
+	}
+	if _, err := v.Verify(ctx, sign(t, jwt.SigningMethodRS256, rsaKey, "unknown", validClaims())); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Verify(unknown kid) error = %v, want ErrInvalidToken", err)
+	}
+	// HS256 is not accepted when only a key set is configured, so a public key
+	// cannot be abused as an HMAC secret.
+	if _, err := v.Verify(ctx, sign(t, jwt.SigningMethodHS256, secret, "", validClaims())); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Verify(HS256 without secret) error = %v, want ErrInvalidToken", err)
+	}
+}
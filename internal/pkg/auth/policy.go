@@ -0,0 +1,119 @@
+package auth
+
+import "sync"
+
+// Permission names an action a role may perform.
+type Permission string
+
+const (
+	PermBooksRead      Permission = "books:read"
+	PermBooksWrite     Permission = "books:write"
+	PermAccountManage  Permission = "account:manage"
+	PermUsersManage    Permission = "users:manage"
+	PermSettingsManage Permission = "settings:manage"
+	PermAPIKeysManage  Permission = "apikeys:manage"
+)
+
+var permissions = []Permission{
+	PermBooksRead, PermBooksWrite, PermAccountManage,
+	PermUsersManage, PermSettingsManage, PermAPIKeysManage,
+}
+
+// KnownPermission reports whether perm is one the service checks.
+func KnownPermission(perm Permission) bool {
+	for _, p := range permissions {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	RolePatron    = "patron"
+	RoleLibrarian = "librarian"
+	RoleAdmin     = "admin"
+)
+
+// DefaultRoles is the built-in role table, the same as the one seeded into
+// Postgres. It is used by backends that do not store roles.
+func DefaultRoles() map[string][]Permission {
+	return map[string][]Permission{
+		RolePatron:    {PermBooksRead, PermAccountManage},
+		RoleLibrarian: {PermBooksRead, PermBooksWrite, PermAccountManage},
+		RoleAdmin:     {PermBooksRead, PermBooksWrite, PermAccountManage, PermUsersManage, PermSettingsManage, PermAPIKeysManage},
+	}
+}
+
+// Policy decides which permissions a principal holds through its roles.
+// Anonymous requests hold only the permissions granted with SetAnonymous.
+type Policy struct {
+	mu        sync.RWMutex
+	roles     map[string]map[Permission]bool
+	anonymous map[Permission]bool
+}
+
+func NewPolicy(roles map[string][]Permission) *Policy {
+	p := &Policy{}
+	p.SetRoles(roles)
+	return p
+}
+
+// SetRoles replaces the role table.
+func (p *Policy) SetRoles(roles map[string][]Permission) {
+	table := make(map[string]map[Permission]bool, len(roles))
+	for role, perms := range roles {
+		set := make(map[Permission]bool, len(perms))
+		for _, perm := range perms {
+			set[perm] = true
+		}
+		table[role] = set
+	}
+	p.mu.Lock()
+	p.roles = table
+	p.mu.Unlock()
+}
+
+// SetAnonymous replaces the permissions of callers without credentials.
+func (p *Policy) SetAnonymous(perms ...Permission) {
+	set := make(map[Permission]bool, len(perms))
+	for _, perm := range perms {
+		set[perm] = true
+	}
+	p.mu.Lock()
+	p.anonymous = set
+	p.mu.Unlock()
+}
+
+// Allowed reports whether principal, nil for an anonymous caller, holds perm.
+// Unknown roles grant nothing; API keys hold the permissions in their scopes.
+func (p *Policy) Allowed(principal *Principal, perm Permission) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if principal == nil {
+		return p.anonymous[perm]
+	}
+	if principal.APIKeyID != "" {
+		for _, scope := range principal.Scopes {
+			if Permission(scope) == perm {
+				return true
+			}
+		}
+		return false
+	}
+	for _, role := range principal.Roles {
+		if p.roles[role][perm] {
+			return true
+		}
+	}
+	return false
+}
+
+// KnownRole reports whether role is in the role table.
+func (p *Policy) KnownRole(role string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	_, ok := p.roles[role]
+	return ok
+}
@@ -0,0 +1,39 @@
+package auth
+
+import "testing"
+
+func TestPolicyDefaultRoles(t *testing.T) {
+	p := NewPolicy(DefaultRoles())
+	p.SetAnonymous(PermBooksRead)
+
+	patron := &Principal{Subject: "p", Roles: []string{RolePatron}}
+	librarian := &Principal{Subject: "l", Roles: []string{RoleLibrarian}}
+	admin := &Principal{Subject: "a", Roles: []string{RoleAdmin}}
+	stranger := &Principal{Subject: "s", Roles: []string{"unknown"}}
+
+	tests := []struct {
+		who  *Principal
+		perm Permission
+		want bool
+	}{
+		{nil, PermBooksRead, true},
+		{nil, PermBooksWrite, false},
+		{patron, PermBooksRead, true},
+		{patron, PermBooksWrite, false},
+		{patron, PermAccountManage, true},
+		{librarian, PermBooksWrite, true},
+		{librarian, PermUsersManage, false},
+		{admin, PermUsersManage, true},
+		{admin, PermSettingsManage, true},
+		{stranger, PermBooksRead, false},
+	}
+	for _, tt := range tests {
+		name := "anonymous"
+		if tt.who != nil {
+			name = tt.who.Subject
+		}
+		if got := p.Allowed(tt.who, tt.perm); got != tt.want {
+			t.Errorf("Allowed(%s, %s) = %v, want %v", name, tt.perm, got, tt.want)
+		}
+	}
+}
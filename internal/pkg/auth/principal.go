@@ -0,0 +1,42 @@
+// Package auth verifies bearer tokens and carries the authenticated caller
+// through the request context.
+package auth
+
+import (
+	"context"
+	"strings"
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	Subject string
+	Roles   []string
+	Scopes  []string
+	// APIKeyID is set when the caller authenticated with an API key. Such
+	// callers hold exactly the permissions listed in Scopes.
+	APIKeyID string
+}
+
+// HasRole reports whether p was granted role.
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if strings.EqualFold(r, role) {
+			return true
+		}
+	}
+	return false
+}
+
+type contextKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying p.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the principal of an authenticated request, or nil for
+// an anonymous one.
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(contextKey{}).(*Principal)
+	return p
+}
@@ -0,0 +1,171 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrUnavailable is returned by a BreakerCache whose circuit is open for
+// operations that cannot be skipped silently.
+var ErrUnavailable = errors.New("cache: unavailable")
+
+// BreakerCache guards a Cache with a circuit breaker. After Failures
+// consecutive operations fail because the cache cannot be reached, the
+// circuit opens and the cache is skipped, behaving like a NoopCache:
+// requests go to storage instead of waiting on timeouts. After Cooldown a
+// single operation probes the cache; if it succeeds the circuit closes,
+// otherwise it stays open for another Cooldown.
+//
+// Incr fails with ErrUnavailable while the circuit is open, since callers
+// rely on the increment, and TryLock succeeds without locking.
+type BreakerCache struct {
+	cache    Cache
+	failures int
+	cooldown time.Duration
+
+	mu       sync.Mutex
+	failed   int       // consecutive failures
+	openedAt time.Time // zero while closed
+	probing  bool
+	lastErr  error
+}
+
+type BreakerOptions struct {
+	Failures int           // consecutive failures that open the circuit
+	Cooldown time.Duration // before an open circuit is probed
+}
+
+func NewBreakerCache(c Cache, opts BreakerOptions) *BreakerCache {
+	return &BreakerCache{cache: c, failures: max(opts.Failures, 1), cooldown: opts.Cooldown}
+}
+
+// allow reports whether an operation may reach the cache.
+func (b *BreakerCache) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.openedAt.IsZero() {
+		return true
+	}
+	if b.probing || time.Since(b.openedAt) < b.cooldown {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// done records the outcome of an allowed operation.
+func (b *BreakerCache) done(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if errors.Is(err, context.Canceled) {
+		// The caller gave up, which says nothing about the cache.
+		b.probing = false
+		return
+	}
+	if !unreachable(err) {
+		if !b.openedAt.IsZero() {
+			log.Info().Dur("after", time.Since(b.openedAt)).Msg("Cache recovered, circuit closed")
+		}
+		b.failed, b.openedAt, b.probing, b.lastErr = 0, time.Time{}, false, nil
+		return
+	}
+	b.failed++
+	b.lastErr = err
+	if b.probing || (b.openedAt.IsZero() && b.failed >= b.failures) {
+		if !b.probing {
+			log.Warn().Err(err).Int("failures", b.failed).Msg("Cache unreachable, circuit opened; serving from storage")
+		}
+		b.openedAt, b.probing = time.Now(), false
+	}
+}
+
+// unreachable reports whether err means the cache could not be reached in
+// time, as opposed to a miss or a value that did not decode.
+func unreachable(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, redis.ErrPoolTimeout)
+}
+
+// Health returns nil while the circuit is closed.
+func (b *BreakerCache) Health() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.openedAt.IsZero() {
+		return nil
+	}
+	return fmt.Errorf("circuit open since %s: %w", b.openedAt.UTC().Format(time.RFC3339), b.lastErr)
+}
+
+func (b *BreakerCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	if !b.allow() {
+		return nil
+	}
+	err := b.cache.Set(ctx, key, value, ttl)
+	b.done(err)
+	return err
+}
+
+func (b *BreakerCache) Get(ctx context.Context, key string, value interface{}) error {
+	if !b.allow() {
+		return ErrMiss
+	}
+	err := b.cache.Get(ctx, key, value)
+	b.done(err)
+	return err
+}
+
+func (b *BreakerCache) Delete(ctx context.Context, key string) error {
+	if !b.allow() {
+		return nil
+	}
+	err := b.cache.Delete(ctx, key)
+	b.done(err)
+	return err
+}
+
+func (b *BreakerCache) Incr(ctx context.Context, key string) (int64, error) {
+	c, ok := b.cache.(Counter)
+	if !ok {
+		return 0, errors.New("cache: Incr is not supported")
+	}
+	if !b.allow() {
+		return 0, ErrUnavailable
+	}
+	n, err := c.Incr(ctx, key)
+	b.done(err)
+	return n, err
+}
+
+func (b *BreakerCache) TryLock(ctx context.Context, key string, ttl time.Duration) (func(), bool, error) {
+	l, ok := b.cache.(Locker)
+	if !ok || !b.allow() {
+		return func() {}, true, nil
+	}
+	unlock, locked, err := l.TryLock(ctx, key, ttl)
+	b.done(err)
+	return unlock, locked, err
+}
+
+func (b *BreakerCache) Clear(ctx context.Context) error {
+	if !b.allow() {
+		return ErrUnavailable
+	}
+	err := b.cache.Clear(ctx)
+	b.done(err)
+	return err
+}
+
+func (b *BreakerCache) Close() error {
+	return b.cache.Close()
+}
@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// flakyCache fails every operation with a network error while down.
+type flakyCache struct {
+	*MemoryCache
+	down  bool
+	calls int
+}
+
+var errRefused = &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+func (c *flakyCache) Get(ctx context.Context, key string, value interface{}) error {
+	c.calls++
+	if c.down {
+		return errRefused
+	}
+	return c.MemoryCache.Get(ctx, key, value)
+}
+
+func (c *flakyCache) Incr(ctx context.Context, key string) (int64, error) {
+	c.calls++
+	if c.down {
+		return 0, errRefused
+	}
+	return c.MemoryCache.Incr(ctx, key)
+}
+
+func TestBreakerCache(t *testing.T) {
+	inner := &flakyCache{MemoryCache: NewMemoryCache(1 << 20), down: true}
+	b := NewBreakerCache(inner, BreakerOptions{Failures: 3, Cooldown: 20 * time.Millisecond})
+	var v int
+
+	// Misses do not count as failures.
+	inner.down = false
+	for range 5 {
+		if err := b.Get(t.Context(), "missing", &v); !errors.Is(err, ErrMiss) {
+			t.Fatalf("Get(missing) error = %v", err)
+		}
+	}
+	if b.Health() != nil {
+		t.Fatal("misses opened the circuit")
+	}
+
+	inner.down = true
+	for range 3 {
+		if err := b.Get(t.Context(), "k", &v); !errors.Is(err, errRefused) {
+			t.Fatalf("Get while closed error = %v, want the cache's error", err)
+		}
+	}
+	if b.Health() == nil {
+		t.Fatal("circuit still closed after 3 failures")
+	}
+	calls := inner.calls
+	if err := b.Get(t.Context(), "k", &v); !errors.Is(err, ErrMiss) {
+		t.Errorf("Get while open error = %v, want ErrMiss", err)
+	}
+	if _, err := b.Incr(t.Context(), "gen"); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Incr while open error = %v, want ErrUnavailable", err)
+	}
+	if unlock, ok, err := b.TryLock(t.Context(), "lock", time.Second); !ok || err != nil {
+		t.Errorf("TryLock while open = %v, %v, want acquired", ok, err)
+	} else {
+		unlock()
+	}
+	if inner.calls != calls {
+		t.Errorf("open circuit reached the cache %d times", inner.calls-calls)
+	}
+
+	// A failed probe keeps the circuit open for another cooldown.
+	time.Sleep(25 * time.Millisecond)
+	b.Get(t.Context(), "k", &v)
+	if inner.calls != calls+1 || b.Health() == nil {
+		t.Fatalf("after a failed probe: %d calls, health %v", inner.calls-calls, b.Health())
+	}
+	b.Get(t.Context(), "k", &v)
+	if inner.calls != calls+1 {
+		t.Error("the cache was probed again before the cooldown")
+	}
+
+	// A successful probe closes it.
+	inner.down = false
+	time.Sleep(25 * time.Millisecond)
+	if _, err := b.Incr(t.Context(), "gen"); err != nil {
+		t.Fatalf("probe Incr error = %v", err)
+	}
+	if err := b.Health(); err != nil {
+		t.Errorf("circuit still open after a successful probe: %v", err)
+	}
+}
@@ -1,11 +1,30 @@
 package cache
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
+// Cache stores encoded values. Operations carry the context of the request
+// they serve, for its deadline and trace; Close does not.
 type Cache interface {
-	Set(key string, value interface{}, ttl time.Duration) error
-	Get(key string, value interface{}) error
-	Delete(key string) error
-	Clear() error
+	Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error
+	Get(ctx context.Context, key string, value interface{}) error
+	Delete(ctx context.Context, key string) error
+	Clear(ctx context.Context) error
 	Close() error
 }
+
+// Counter is implemented by caches that can increment a number atomically.
+// Incr starts a missing key at 0 and never expires it.
+type Counter interface {
+	Incr(ctx context.Context, key string) (int64, error)
+}
+
+// Locker is implemented by caches shared between processes that can hold
+// short exclusive locks. TryLock reports whether key was acquired; unlock
+// releases it only while the caller still holds it. A lock not released
+// expires after ttl.
+type Locker interface {
+	TryLock(ctx context.Context, key string, ttl time.Duration) (unlock func(), ok bool, err error)
+}
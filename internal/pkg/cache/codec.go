@@ -0,0 +1,235 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec turns values into bytes and back. Its ID is stored with every
+// value, so it must never change once values were written with it.
+type Codec interface {
+	ID() byte // 1-7
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// Compression shrinks encoded values. Like a Codec's, its ID is stored with
+// every value.
+type Compression interface {
+	ID() byte // 1-7
+	Name() string
+	Compress(data []byte) []byte
+	Decompress(data []byte) ([]byte, error)
+}
+
+var (
+	JSON    Codec = jsonCodec{}
+	MsgPack Codec = msgpackCodec{}
+	Gob     Codec = gobCodec{}
+
+	Zstd   Compression = zstdCompression{}
+	Snappy Compression = snappyCompression{}
+)
+
+var (
+	codecs       = map[byte]Codec{}
+	compressions = map[byte]Compression{}
+)
+
+func init() {
+	for _, c := range []Codec{JSON, MsgPack, Gob} {
+		codecs[c.ID()] = c
+	}
+	for _, c := range []Compression{Zstd, Snappy} {
+		compressions[c.ID()] = c
+	}
+}
+
+// CodecByName returns the codec called name: json, msgpack or gob.
+func CodecByName(name string) (Codec, error) {
+	for _, c := range codecs {
+		if c.Name() == name {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown cache codec %q", name)
+}
+
+// CompressionByName returns the compression called name: zstd or snappy.
+// "none" returns nil.
+func CompressionByName(name string) (Compression, error) {
+	if name == "none" {
+		return nil, nil
+	}
+	for _, c := range compressions {
+		if c.Name() == name {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown cache compression %q", name)
+}
+
+// Stored values start with a header byte 10cccmmm: the leading 10 is the
+// format version, ccc the codec ID and mmm the compression ID, 0 for none.
+// JSON never starts with a byte above 0x7f, so values written before the
+// header existed are still read as plain JSON.
+const (
+	headerVersion = 0x80
+	versionMask   = 0xc0
+)
+
+// Serializer encodes values with a Codec, compressing those of at least
+// MinSize bytes. It decodes whatever codec and compression a value was
+// written with, so instances configured differently, e.g. during a rolling
+// deploy that changes the codec, read each other's values.
+type Serializer struct {
+	codec       Codec
+	compression Compression
+	minSize     int
+}
+
+// NewSerializer returns a Serializer writing with codec and, for encoded
+// values of at least minSize bytes, compression; compression may be nil.
+func NewSerializer(codec Codec, compression Compression, minSize int) *Serializer {
+	return &Serializer{codec: codec, compression: compression, minSize: minSize}
+}
+
+// DefaultSerializer writes uncompressed JSON.
+var DefaultSerializer = NewSerializer(JSON, nil, 0)
+
+func (s *Serializer) Encode(v interface{}) ([]byte, error) {
+	data, err := s.codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var compression byte
+	if s.compression != nil && len(data) >= s.minSize {
+		// Keep the compressed form only when it is smaller.
+		if packed := s.compression.Compress(data); len(packed) < len(data) {
+			data, compression = packed, s.compression.ID()
+		}
+	}
+	out := make([]byte, 0, len(data)+1)
+	out = append(out, headerVersion|s.codec.ID()<<3|compression)
+	return append(out, data...), nil
+}
+
+func (s *Serializer) Decode(data []byte, v interface{}) error {
+	if len(data) == 0 || data[0]&0x80 == 0 {
+		return json.Unmarshal(data, v)
+	}
+	header := data[0]
+	if header&versionMask != headerVersion {
+		return fmt.Errorf("cache: unsupported value format %#x", header)
+	}
+	codec, ok := codecs[header>>3&7]
+	if !ok {
+		return fmt.Errorf("cache: unknown codec %d", header>>3&7)
+	}
+	data = data[1:]
+	if id := header & 7; id != 0 {
+		compression, ok := compressions[id]
+		if !ok {
+			return fmt.Errorf("cache: unknown compression %d", id)
+		}
+		var err error
+		if data, err = compression.Decompress(data); err != nil {
+			return fmt.Errorf("cache: decompress %s: %w", compression.Name(), err)
+		}
+	}
+	return codec.Unmarshal(data, v)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ID() byte                                   { return 1 }
+func (jsonCodec) Name() string                               { return "json" }
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+// msgpackCodec reads the json struct tags, like the API's msgpack responses.
+type msgpackCodec struct{}
+
+func (msgpackCodec) ID() byte     { return 2 }
+func (msgpackCodec) Name() string { return "msgpack" }
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	err := enc.Encode(v)
+	return buf.Bytes(), err
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+// gobCodec is the most compact for Go structs, but only decodes into
+// concrete types.
+type gobCodec struct{}
+
+func (gobCodec) ID() byte     { return 3 }
+func (gobCodec) Name() string { return "gob" }
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(v)
+	return buf.Bytes(), err
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// zstdCompression compresses best; its encoder and decoder are shared, as
+// they are costly to create and safe for concurrent EncodeAll/DecodeAll.
+type zstdCompression struct{}
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+)
+
+func zstdInit() {
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+}
+
+func (zstdCompression) ID() byte     { return 1 }
+func (zstdCompression) Name() string { return "zstd" }
+
+func (zstdCompression) Compress(data []byte) []byte {
+	zstdOnce.Do(zstdInit)
+	return zstdEncoder.EncodeAll(data, nil)
+}
+
+func (zstdCompression) Decompress(data []byte) ([]byte, error) {
+	zstdOnce.Do(zstdInit)
+	return zstdDecoder.DecodeAll(data, nil)
+}
+
+// snappyCompression is faster but compresses less.
+type snappyCompression struct{}
+
+func (snappyCompression) ID() byte     { return 2 }
+func (snappyCompression) Name() string { return "snappy" }
+
+func (snappyCompression) Compress(data []byte) []byte {
+	return s2.EncodeSnappy(nil, data)
+}
+
+func (snappyCompression) Decompress(data []byte) ([]byte, error) {
+	return s2.Decode(nil, data)
+}
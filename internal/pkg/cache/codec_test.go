@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"encoding/json"
+	"libraryapi/internal/domain/models"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func page(n int) []models.Book {
+	books := make([]models.Book, n)
+	for i := range books {
+		books[i] = models.Book{
+			ID:         strconv.Itoa(i),
+			Title:      "Book " + strconv.Itoa(i),
+			Author:     "Author",
+			Year:       1900 + i%100,
+			Created_at: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		}
+	}
+	return books
+}
+
+func TestSerializerRoundTrip(t *testing.T) {
+	want := page(50)
+	for _, codec := range []Codec{JSON, MsgPack, Gob} {
+		for _, compression := range []Compression{nil, Zstd, Snappy} {
+			s := NewSerializer(codec, compression, 64)
+			name := codec.Name()
+			if compression != nil {
+				name += "+" + compression.Name()
+			}
+			data, err := s.Encode(want)
+			if err != nil {
+				t.Fatalf("%s: Encode: %v", name, err)
+			}
+			if data[0]>>3&7 != codec.ID() || (compression != nil && data[0]&7 != compression.ID()) {
+				t.Errorf("%s: header %08b", name, data[0])
+			}
+			// Any serializer reads it, whatever it writes itself.
+			var got []models.Book
+			if err := DefaultSerializer.Decode(data, &got); err != nil {
+				t.Fatalf("%s: Decode: %v", name, err)
+			}
+			// msgpack decodes times in the local time zone.
+			for i := range got {
+				got[i].Created_at = got[i].Created_at.UTC()
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: round trip changed the value", name)
+			}
+		}
+	}
+}
+
+func TestSerializerCompressesAboveMinSize(t *testing.T) {
+	s := NewSerializer(JSON, Zstd, 1024)
+	small, _ := s.Encode("short")
+	if small[0]&7 != 0 {
+		t.Error("a value below the minimum size was compressed")
+	}
+	large, _ := s.Encode(page(50))
+	raw, _ := json.Marshal(page(50))
+	if large[0]&7 != Zstd.ID() || len(large) >= len(raw) {
+		t.Errorf("large value: header %08b, %d bytes from %d", large[0], len(large), len(raw))
+	}
+}
+
+func TestSerializerReadsLegacyJSON(t *testing.T) {
+	// Values written before the header byte, and counters from Incr.
+	var book models.Book
+	if err := DefaultSerializer.Decode([]byte(`{"id":"1","title":"Dune"}`), &book); err != nil || book.Title != "Dune" {
+		t.Errorf("Decode(legacy JSON) = %+v, %v", book, err)
+	}
+	var n int64
+	if err := NewSerializer(Gob, Snappy, 0).Decode([]byte("42"), &n); err != nil || n != 42 {
+		t.Errorf("Decode(counter) = %d, %v", n, err)
+	}
+
+	if err := DefaultSerializer.Decode([]byte{0xc0, '1'}, &n); err == nil {
+		t.Error("Decode accepted an unknown format version")
+	}
+}
+
+func TestCodecByName(t *testing.T) {
+	for _, name := range []string{"json", "msgpack", "gob"} {
+		if c, err := CodecByName(name); err != nil || c.Name() != name {
+			t.Errorf("CodecByName(%q) = %v, %v", name, c, err)
+		}
+	}
+	if c, err := CompressionByName("none"); c != nil || err != nil {
+		t.Errorf("CompressionByName(none) = %v, %v", c, err)
+	}
+	if _, err := CompressionByName("lz4"); err == nil {
+		t.Error("CompressionByName accepted lz4")
+	}
+}
@@ -0,0 +1,249 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"hash/maphash"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrMiss is returned by Get for a key that is not cached.
+var ErrMiss = errors.New("cache: miss")
+
+// entryOverhead approximates the memory an entry takes besides its key and
+// value.
+const entryOverhead = 64
+
+// MemoryCache is an in-process Cache bounded by the size of its keys and
+// values. Values are stored encoded, as in Redis, so Get never aliases what
+// was Set.
+//
+// When full it evicts the least recently used entry, but only to admit an
+// entry that is requested at least as often, as estimated by a TinyLFU
+// frequency sketch. A burst of keys read once, such as a crawler paging
+// through the catalog, thus cannot push out the entries most clients read.
+type MemoryCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	items    map[string]*list.Element
+	lru      *list.List // of *memoryEntry, most recently used first
+	sketch   *sketch
+	// Serializer encodes values; it is DefaultSerializer unless set
+	// before the cache is used.
+	Serializer *Serializer
+}
+
+type memoryEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time // zero for no expiry
+}
+
+func (e *memoryEntry) size() int64 {
+	return int64(len(e.key) + len(e.value) + entryOverhead)
+}
+
+func (e *memoryEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && now.After(e.expiresAt)
+}
+
+// NewMemoryCache returns a cache holding up to maxBytes of keys and values.
+func NewMemoryCache(maxBytes int64) *MemoryCache {
+	// About one sketch counter per 256 bytes of cache, so a cache of small
+	// entries does not saturate the sketch.
+	return &MemoryCache{
+		maxBytes: maxBytes,
+		items:    make(map[string]*list.Element),
+		lru:      list.New(),
+		sketch:   newSketch(int(min(max(maxBytes/256, 1024), 1<<24))),
+
+		Serializer: DefaultSerializer,
+	}
+}
+
+func (c *MemoryCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	data, err := c.Serializer.Encode(value)
+	if err != nil {
+		return err
+	}
+	c.setRaw(key, data, ttl)
+	return nil
+}
+
+// setRaw stores an encoded value. It reports whether the value was admitted.
+func (c *MemoryCache) setRaw(key string, data []byte, ttl time.Duration) bool {
+	e := &memoryEntry{key: key, value: data}
+	if ttl > 0 {
+		e.expiresAt = time.Now().Add(ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sketch.add(key)
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	if e.size() > c.maxBytes {
+		return false
+	}
+	now := time.Now()
+	for c.size+e.size() > c.maxBytes {
+		victim := c.lru.Back().Value.(*memoryEntry)
+		if !victim.expired(now) && c.sketch.estimate(key) < c.sketch.estimate(victim.key) {
+			return false
+		}
+		c.remove(c.lru.Back())
+	}
+	c.items[key] = c.lru.PushFront(e)
+	c.size += e.size()
+	return true
+}
+
+func (c *MemoryCache) Get(ctx context.Context, key string, value interface{}) error {
+	data, ok := c.getRaw(key)
+	if !ok {
+		return ErrMiss
+	}
+	return c.Serializer.Decode(data, value)
+}
+
+func (c *MemoryCache) getRaw(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sketch.add(key)
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*memoryEntry)
+	if e.expired(time.Now()) {
+		c.remove(el)
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return e.value, true
+}
+
+func (c *MemoryCache) Delete(ctx context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	return nil
+}
+
+// Incr increments the number stored under key. Like Redis it fails on a
+// value that is not an integer.
+func (c *MemoryCache) Incr(ctx context.Context, key string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var n int64
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*memoryEntry)
+		if !e.expired(time.Now()) {
+			var err error
+			if n, err = strconv.ParseInt(string(e.value), 10, 64); err != nil {
+				return 0, errors.New("cache: value is not an integer")
+			}
+		}
+		c.remove(el)
+	}
+	n++
+	e := &memoryEntry{key: key, value: strconv.AppendInt(nil, n, 10)}
+	c.items[key] = c.lru.PushFront(e)
+	c.size += e.size()
+	// Counters are small and must not be lost, so they bypass admission.
+	for c.size > c.maxBytes && c.lru.Len() > 1 {
+		c.remove(c.lru.Back())
+	}
+	return n, nil
+}
+
+func (c *MemoryCache) Clear(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items = make(map[string]*list.Element)
+	c.lru.Init()
+	c.size = 0
+	return nil
+}
+
+func (c *MemoryCache) Close() error {
+	return nil
+}
+
+// Len returns the number of entries, including expired ones not yet evicted.
+func (c *MemoryCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+func (c *MemoryCache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*memoryEntry)
+	delete(c.items, e.key)
+	c.size -= e.size()
+}
+
+// sketch is a count-min sketch of 4-bit counters estimating how often keys
+// were requested recently. All counters are halved every 10 × width
+// additions, so past popularity fades.
+type sketch struct {
+	seed    maphash.Seed
+	rows    [4][]uint8
+	mask    uint64
+	added   int
+	resetAt int
+}
+
+func newSketch(width int) *sketch {
+	w := 1
+	for w < width {
+		w <<= 1
+	}
+	s := &sketch{seed: maphash.MakeSeed(), mask: uint64(w - 1), resetAt: 10 * w}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, w)
+	}
+	return s
+}
+
+// indexes derives a counter per row from one 64-bit hash.
+func (s *sketch) indexes(key string) [4]uint64 {
+	h := maphash.String(s.seed, key)
+	lo, hi := h&0xffffffff, h>>32
+	var idx [4]uint64
+	for i := range idx {
+		idx[i] = (lo + uint64(i)*hi) & s.mask
+	}
+	return idx
+}
+
+func (s *sketch) add(key string) {
+	for i, j := range s.indexes(key) {
+		if s.rows[i][j] < 15 {
+			s.rows[i][j]++
+		}
+	}
+	if s.added++; s.added >= s.resetAt {
+		for i := range s.rows {
+			for j := range s.rows[i] {
+				s.rows[i][j] >>= 1
+			}
+		}
+		s.added /= 2
+	}
+}
+
+func (s *sketch) estimate(key string) uint8 {
+	n := uint8(15)
+	for i, j := range s.indexes(key) {
+		n = min(n, s.rows[i][j])
+	}
+	return n
+}
@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryCache(t *testing.T) {
+	c := NewMemoryCache(1 << 20)
+	if err := c.Set(t.Context(), "book:1", map[string]string{"title": "Dune"}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]string
+	if err := c.Get(t.Context(), "book:1", &got); err != nil || got["title"] != "Dune" {
+		t.Fatalf("Get = %v, %v", got, err)
+	}
+	if err := c.Get(t.Context(), "book:2", &got); !errors.Is(err, ErrMiss) {
+		t.Errorf("Get(missing) error = %v, want ErrMiss", err)
+	}
+
+	c.Set(t.Context(), "short", 1, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	var n int
+	if err := c.Get(t.Context(), "short", &n); !errors.Is(err, ErrMiss) {
+		t.Errorf("Get(expired) error = %v, want ErrMiss", err)
+	}
+
+	for want := int64(1); want <= 3; want++ {
+		if n, err := c.Incr(t.Context(), "gen"); err != nil || n != want {
+			t.Fatalf("Incr = %d, %v, want %d", n, err, want)
+		}
+	}
+	var gen int64
+	if err := c.Get(t.Context(), "gen", &gen); err != nil || gen != 3 {
+		t.Errorf("Get(counter) = %d, %v, want 3", gen, err)
+	}
+	if _, err := c.Incr(t.Context(), "book:1"); err == nil {
+		t.Error("Incr of a JSON object succeeded")
+	}
+
+	c.Clear(t.Context())
+	if c.Len() != 0 || c.size != 0 {
+		t.Errorf("after Clear: %d entries, %d bytes", c.Len(), c.size)
+	}
+}
+
+func TestMemoryCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	value := strings.Repeat("x", 100)
+	encoded, _ := DefaultSerializer.Encode(value)
+	entry := int64(len("key0") + len(encoded) + entryOverhead)
+	c := NewMemoryCache(3 * entry)
+	for i := range 3 {
+		c.Set(t.Context(), "key"+strconv.Itoa(i), value, 0)
+	}
+	var s string
+	c.Get(t.Context(), "key0", &s) // key1 is now the least recently used
+	c.Set(t.Context(), "key3", value, 0)
+
+	if err := c.Get(t.Context(), "key1", &s); err == nil {
+		t.Error("key1 was not evicted")
+	}
+	for _, key := range []string{"key0", "key2", "key3"} {
+		if err := c.Get(t.Context(), key, &s); err != nil {
+			t.Errorf("%s was evicted", key)
+		}
+	}
+	if c.size > c.maxBytes {
+		t.Errorf("size %d exceeds the bound %d", c.size, c.maxBytes)
+	}
+}
+
+func TestMemoryCacheAdmission(t *testing.T) {
+	value := strings.Repeat("x", 100)
+	encoded, _ := DefaultSerializer.Encode(value)
+	entry := int64(len("hot0") + len(encoded) + entryOverhead)
+	c := NewMemoryCache(4 * entry)
+	for i := range 4 {
+		key := "hot" + strconv.Itoa(i)
+		c.Set(t.Context(), key, value, 0)
+		for range 5 {
+			var s string
+			c.Get(t.Context(), key, &s)
+		}
+	}
+
+	// A scan of keys read once must not push out the popular ones.
+	for i := range 100 {
+		c.Set(t.Context(), "scan"+strconv.Itoa(i), value, 0)
+	}
+	for i := range 4 {
+		var s string
+		if err := c.Get(t.Context(), "hot"+strconv.Itoa(i), &s); err != nil {
+			t.Errorf("hot%d was evicted by a scan", i)
+		}
+	}
+
+	if c.Set(t.Context(), "huge", strings.Repeat("x", int(5*entry)), 0); c.Len() != 4 {
+		t.Errorf("a value larger than the cache changed it to %d entries", c.Len())
+	}
+}
+
+func TestSketch(t *testing.T) {
+	s := newSketch(1024)
+	for range 5 {
+		s.add("a")
+	}
+	s.add("b")
+	if s.estimate("a") < 5 || s.estimate("b") < 1 || s.estimate("a") <= s.estimate("b") {
+		t.Errorf("estimates a=%d b=%d", s.estimate("a"), s.estimate("b"))
+	}
+	// The next addition ages the counters.
+	s.added = s.resetAt - 1
+	s.add("b")
+	if s.estimate("a") != 2 {
+		t.Errorf("estimate of a = %d, want 2 after aging", s.estimate("a"))
+	}
+}
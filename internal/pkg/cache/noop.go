@@ -0,0 +1,18 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// NoopCache caches nothing: every Get misses and writes are dropped. It
+// lets the server run without Redis, reading everything from storage.
+type NoopCache struct{}
+
+func (NoopCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	return nil
+}
+func (NoopCache) Get(ctx context.Context, key string, value interface{}) error { return ErrMiss }
+func (NoopCache) Delete(ctx context.Context, key string) error                 { return nil }
+func (NoopCache) Clear(ctx context.Context) error                              { return nil }
+func (NoopCache) Close() error                                                 { return nil }
@@ -2,47 +2,219 @@ package cache
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("libraryapi/internal/pkg/cache")
+
+// RedisCache stores values in Redis, encoded by its Serializer. Every key is stored under
+// the cache's prefix, so several services can share a Redis database and
+// Clear removes only this service's keys.
 type RedisCache struct {
-	ctx    context.Context
-	client *redis.Client
+	client     *redis.Client
+	prefix     string
+	timeout    time.Duration
+	serializer *Serializer
+}
+
+type RedisOptions struct {
+	Host, Port string
+	Password   string
+	DB         int
+	Prefix     string
+	// Timeout bounds every operation, so a slow Redis fails fast instead
+	// of holding up requests; 0 means no limit.
+	Timeout time.Duration
+	// Serializer encodes values; nil means DefaultSerializer.
+	Serializer *Serializer
 }
 
-func NewRedisCache(host, port, password string, db int) Cache {
+func NewRedisCache(opts RedisOptions) *RedisCache {
+	if opts.Serializer == nil {
+		opts.Serializer = DefaultSerializer
+	}
 	return &RedisCache{
 		client: redis.NewClient(&redis.Options{
-			Addr:     fmt.Sprintf("%s:%s", host, port),
-			Password: password,
-			DB:       db,
+			Addr:     fmt.Sprintf("%s:%s", opts.Host, opts.Port),
+			Password: opts.Password,
+			DB:       opts.DB,
+			// Apply the deadlines of operation contexts to network I/O.
+			ContextTimeoutEnabled: true,
 		}),
-		ctx: context.Background(),
+		prefix:     opts.Prefix,
+		timeout:    opts.Timeout,
+		serializer: opts.Serializer,
+	}
+}
+
+// opCtx returns the context of one operation on behalf of ctx.
+func (c *RedisCache) opCtx(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, c.timeout)
+}
+
+// start begins the span of operation op on key, a child of the span in
+// ctx. The returned end finishes it, recording err unless it is a miss.
+func (c *RedisCache) start(ctx context.Context, op, key string) (context.Context, func(err error)) {
+	ctx, span := tracer.Start(ctx, "cache."+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemNameRedis, attribute.String("cache.key", key)))
+	return ctx, func(err error) {
+		if errors.Is(err, ErrMiss) {
+			span.SetAttributes(attribute.Bool("cache.hit", false))
+		} else if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
 	}
 }
-func (c *RedisCache) Set(key string, value interface{}, ttl time.Duration) error {
-	data, err := json.Marshal(value)
+
+func (c *RedisCache) key(key string) string {
+	return c.prefix + key
+}
+func (c *RedisCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	data, err := c.serializer.Encode(value)
 	if err != nil {
 		return err
 	}
-	return c.client.Set(c.ctx, key, data, ttl).Err()
+	return c.setRaw(ctx, key, data, ttl)
 }
-func (c *RedisCache) Get(key string, value interface{}) error {
-	data, err := c.client.Get(c.ctx, key).Bytes()
+
+// setRaw stores an encoded value.
+func (c *RedisCache) setRaw(ctx context.Context, key string, data []byte, ttl time.Duration) (err error) {
+	ctx, end := c.start(ctx, "set", key)
+	defer func() { end(err) }()
+	ctx, cancel := c.opCtx(ctx)
+	defer cancel()
+	return c.client.Set(ctx, c.key(key), data, ttl).Err()
+}
+func (c *RedisCache) Get(ctx context.Context, key string, value interface{}) (err error) {
+	ctx, end := c.start(ctx, "get", key)
+	defer func() { end(err) }()
+	ctx, cancel := c.opCtx(ctx)
+	defer cancel()
+	data, err := c.client.Get(ctx, c.key(key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return ErrMiss
+	}
 	if err != nil {
 		return err
 	}
-	return json.Unmarshal(data, value)
+	return c.serializer.Decode(data, value)
+}
+
+// getRaw returns the encoded value of key and how long it has left to
+// live; 0 means it does not expire.
+func (c *RedisCache) getRaw(ctx context.Context, key string) (_ []byte, _ time.Duration, err error) {
+	ctx, end := c.start(ctx, "get", key)
+	defer func() { end(err) }()
+	ctx, cancel := c.opCtx(ctx)
+	defer cancel()
+	var get *redis.StringCmd
+	var ttl *redis.DurationCmd
+	_, err = c.client.Pipelined(ctx, func(p redis.Pipeliner) error {
+		get = p.Get(ctx, c.key(key))
+		ttl = p.PTTL(ctx, c.key(key))
+		return nil
+	})
+	if errors.Is(err, redis.Nil) {
+		return nil, 0, ErrMiss
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	data, _ := get.Bytes()
+	left := ttl.Val()
+	if left < 0 {
+		left = 0
+	}
+	return data, left, nil
+}
+func (c *RedisCache) Delete(ctx context.Context, key string) (err error) {
+	ctx, end := c.start(ctx, "delete", key)
+	defer func() { end(err) }()
+	ctx, cancel := c.opCtx(ctx)
+	defer cancel()
+	return c.client.Del(ctx, c.key(key)).Err()
 }
-func (c *RedisCache) Delete(key string) error {
-	return c.client.Del(c.ctx, key).Err()
+func (c *RedisCache) Incr(ctx context.Context, key string) (_ int64, err error) {
+	ctx, end := c.start(ctx, "incr", key)
+	defer func() { end(err) }()
+	ctx, cancel := c.opCtx(ctx)
+	defer cancel()
+	return c.client.Incr(ctx, c.key(key)).Result()
+}
+
+// unlockScript deletes a lock only if it still holds the caller's token, so
+// a lock that expired and was taken by someone else is left alone.
+var unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// TryLock takes the lock on behalf of ctx; unlock runs even after ctx is
+// cancelled.
+func (c *RedisCache) TryLock(ctx context.Context, key string, ttl time.Duration) (_ func(), _ bool, err error) {
+	b := make([]byte, 16)
+	rand.Read(b)
+	token := hex.EncodeToString(b)
+	lockCtx, end := c.start(ctx, "lock", key)
+	defer func() { end(err) }()
+	lockCtx, cancel := c.opCtx(lockCtx)
+	defer cancel()
+	ok, err := c.client.SetNX(lockCtx, c.key(key), token, ttl).Result()
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	return func() {
+		ctx, end := c.start(context.WithoutCancel(ctx), "unlock", key)
+		ctx, cancel := c.opCtx(ctx)
+		defer cancel()
+		end(unlockScript.Run(ctx, c.client, []string{c.key(key)}, token).Err())
+	}, true, nil
 }
-func (c *RedisCache) Clear() error {
-	return c.client.FlushDB(c.ctx).Err()
+
+// Clear deletes every key under the prefix. It scans the database in
+// batches rather than blocking Redis, so keys written meanwhile may survive.
+// Each batch gets the operation timeout.
+func (c *RedisCache) Clear(ctx context.Context) (err error) {
+	if c.prefix == "" {
+		return errors.New("cache: refusing to clear a cache without a key prefix")
+	}
+	ctx, end := c.start(ctx, "clear", c.prefix+"*")
+	defer func() { end(err) }()
+	var cursor uint64
+	for {
+		ctx, cancel := c.opCtx(ctx)
+		keys, next, err := c.client.Scan(ctx, cursor, escapeGlob(c.prefix)+"*", 500).Result()
+		if err == nil && len(keys) > 0 {
+			err = c.client.Unlink(ctx, keys...).Err()
+		}
+		cancel()
+		if err != nil {
+			return err
+		}
+		if cursor = next; cursor == 0 {
+			return nil
+		}
+	}
 }
 func (c *RedisCache) Close() error {
 	if c.client != nil {
@@ -50,3 +222,15 @@ func (c *RedisCache) Close() error {
 	}
 	return nil
 }
+
+// escapeGlob quotes the characters SCAN MATCH treats as a pattern.
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
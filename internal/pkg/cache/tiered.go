@@ -0,0 +1,198 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+// TieredCache keeps a MemoryCache in front of a RedisCache, holding values
+// encoded by the RedisCache's Serializer in both. Reads are
+// served from memory when possible; writes go to Redis first and are then
+// broadcast over Redis pub/sub, so every other instance drops its local
+// copy of the key.
+//
+// Broadcasts are asynchronous: another instance may serve its old copy for
+// the moment a broadcast takes to arrive, and for up to localTTL if it is
+// lost. Local copies are dropped whenever the subscription is interrupted,
+// because broadcasts may have been missed meanwhile.
+type TieredCache struct {
+	local    *MemoryCache
+	remote   *RedisCache
+	localTTL time.Duration
+	channel  string
+	id       string // tells this instance's broadcasts apart
+
+	// invalidations counts the broadcasts received, so a value is not
+	// kept locally if a broadcast may have invalidated it while it was
+	// read from or written to Redis.
+	invalidations atomic.Int64
+	sub           *redis.PubSub
+	cancel        context.CancelFunc
+	done          chan struct{}
+}
+
+// NewTieredCache keeps values read from or written to remote in local for
+// at most localTTL. It subscribes to invalidations until Close.
+func NewTieredCache(local *MemoryCache, remote *RedisCache, localTTL time.Duration) *TieredCache {
+	b := make([]byte, 8)
+	rand.Read(b)
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &TieredCache{
+		local:    local,
+		remote:   remote,
+		localTTL: localTTL,
+		channel:  remote.key("invalidate"),
+		id:       hex.EncodeToString(b),
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	c.sub = remote.client.Subscribe(ctx, c.channel)
+	go c.subscribe(ctx)
+	return c
+}
+
+// clearAll is broadcast instead of a key by Clear.
+const clearAll = "*"
+
+func (c *TieredCache) subscribe(ctx context.Context) {
+	defer close(c.done)
+	down := false // log an outage once, not on every retry
+	for {
+		msg, err := c.sub.Receive(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		switch msg := msg.(type) {
+		case *redis.Message:
+			id, key, _ := strings.Cut(msg.Payload, " ")
+			if id == c.id {
+				continue
+			}
+			c.invalidations.Add(1)
+			if key == clearAll {
+				c.local.Clear(ctx)
+			} else {
+				c.local.Delete(ctx, key)
+			}
+		case *redis.Subscription:
+			// (Re)subscribed: anything broadcast before is lost.
+			c.invalidations.Add(1)
+			c.local.Clear(ctx)
+			if down {
+				log.Info().Str("channel", c.channel).Msg("Cache invalidation subscription restored")
+				down = false
+			}
+		}
+		if err != nil {
+			if !down {
+				log.Warn().Err(err).Str("channel", c.channel).Msg("Cache invalidation subscription interrupted, retrying")
+				down = true
+			}
+			c.invalidations.Add(1)
+			c.local.Clear(ctx)
+			select {
+			case <-time.After(time.Second):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// broadcast tells the other instances to drop key.
+func (c *TieredCache) broadcast(ctx context.Context, key string) {
+	ctx, end := c.remote.start(ctx, "publish", key)
+	ctx, cancel := c.remote.opCtx(ctx)
+	defer cancel()
+	err := c.remote.client.Publish(ctx, c.channel, c.id+" "+key).Err()
+	end(err)
+	if err != nil {
+		log.Warn().Err(err).Str("cache_key", key).Msg("Failed to broadcast cache invalidation")
+	}
+}
+
+func (c *TieredCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	data, err := c.remote.serializer.Encode(value)
+	if err != nil {
+		return err
+	}
+	seen := c.invalidations.Load()
+	if err := c.remote.setRaw(ctx, key, data, ttl); err != nil {
+		return err
+	}
+	if c.invalidations.Load() == seen {
+		c.local.setRaw(key, data, c.ttl(ttl))
+	} else {
+		c.local.Delete(ctx, key)
+	}
+	c.broadcast(ctx, key)
+	return nil
+}
+
+func (c *TieredCache) Get(ctx context.Context, key string, value interface{}) error {
+	if data, ok := c.local.getRaw(key); ok {
+		return c.remote.serializer.Decode(data, value)
+	}
+	seen := c.invalidations.Load()
+	data, ttl, err := c.remote.getRaw(ctx, key)
+	if err != nil {
+		return err
+	}
+	if c.invalidations.Load() == seen {
+		c.local.setRaw(key, data, c.ttl(ttl))
+	}
+	return c.remote.serializer.Decode(data, value)
+}
+
+// ttl is how long a value with ttl left in Redis may be kept locally.
+func (c *TieredCache) ttl(ttl time.Duration) time.Duration {
+	if ttl <= 0 || ttl > c.localTTL {
+		return c.localTTL
+	}
+	return ttl
+}
+
+func (c *TieredCache) Delete(ctx context.Context, key string) error {
+	c.local.Delete(ctx, key)
+	if err := c.remote.Delete(ctx, key); err != nil {
+		return err
+	}
+	c.broadcast(ctx, key)
+	return nil
+}
+
+func (c *TieredCache) Incr(ctx context.Context, key string) (int64, error) {
+	n, err := c.remote.Incr(ctx, key)
+	c.local.Delete(ctx, key)
+	if err == nil {
+		c.broadcast(ctx, key)
+	}
+	return n, err
+}
+
+func (c *TieredCache) TryLock(ctx context.Context, key string, ttl time.Duration) (func(), bool, error) {
+	return c.remote.TryLock(ctx, key, ttl)
+}
+
+func (c *TieredCache) Clear(ctx context.Context) error {
+	c.local.Clear(ctx)
+	if err := c.remote.Clear(ctx); err != nil {
+		return err
+	}
+	c.broadcast(ctx, clearAll)
+	return nil
+}
+
+func (c *TieredCache) Close() error {
+	c.cancel()
+	c.sub.Close() // interrupts Receive
+	<-c.done
+	return c.remote.Close()
+}
@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// testRedis connects to REDIS_HOST:REDIS_PORT (localhost:6379 by default)
+// and skips the test when Redis is not reachable.
+func testRedis(t *testing.T, prefix string) *RedisCache {
+	t.Helper()
+	host, port := os.Getenv("REDIS_HOST"), os.Getenv("REDIS_PORT")
+	if host == "" {
+		host = "localhost"
+	}
+	if port == "" {
+		port = "6379"
+	}
+	c := NewRedisCache(RedisOptions{Host: host, Port: port, Password: os.Getenv("REDIS_PASSWORD"), Prefix: prefix, Timeout: time.Second})
+	if err := c.Set(t.Context(), "ping", 1, time.Second); err != nil {
+		c.Close()
+		t.Skipf("redis not available: %v", err)
+	}
+	// Start clean; the cache may be closed by the time a cleanup runs.
+	c.Clear(t.Context())
+	return c
+}
+
+func TestRedisCacheClearKeepsOtherPrefixes(t *testing.T) {
+	ours, theirs := testRedis(t, "test:ours:"), testRedis(t, "test:theirs:")
+	defer ours.Close()
+	defer theirs.Close()
+	ours.Set(t.Context(), "book:1", "Dune", time.Minute)
+	theirs.Set(t.Context(), "book:1", "Emma", time.Minute)
+
+	if err := ours.Clear(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	var s string
+	if err := ours.Get(t.Context(), "book:1", &s); err == nil {
+		t.Error("Clear left a key under its prefix")
+	}
+	if err := theirs.Get(t.Context(), "book:1", &s); err != nil || s != "Emma" {
+		t.Errorf("Clear removed another prefix's key: %q, %v", s, err)
+	}
+}
+
+func TestTieredCacheInvalidation(t *testing.T) {
+	a := NewTieredCache(NewMemoryCache(1<<20), testRedis(t, "test:tiered:"), time.Minute)
+	defer a.Close()
+	b := NewTieredCache(NewMemoryCache(1<<20), testRedis(t, "test:tiered:"), time.Minute)
+	defer b.Close()
+	// Let both subscriptions start.
+	time.Sleep(100 * time.Millisecond)
+
+	a.Set(t.Context(), "book:1", "v1", time.Minute)
+	var s string
+	if err := b.Get(t.Context(), "book:1", &s); err != nil || s != "v1" {
+		t.Fatalf("b.Get = %q, %v", s, err)
+	}
+	// The invalidation a's Set published may reach b after that read and
+	// drop it again; the next read keeps it.
+	if !waitFor(func() bool { b.Get(t.Context(), "book:1", &s); _, ok := b.local.getRaw("book:1"); return ok }) {
+		t.Fatal("b did not keep the value it read locally")
+	}
+
+	a.Set(t.Context(), "book:1", "v2", time.Minute)
+	if !waitFor(func() bool { b.Get(t.Context(), "book:1", &s); return s == "v2" }) {
+		t.Errorf("b still reads %q after a changed the key", s)
+	}
+
+	a.Incr(t.Context(), "gen")
+	var gen int64
+	b.Get(t.Context(), "gen", &gen)
+	a.Incr(t.Context(), "gen")
+	if !waitFor(func() bool { b.Get(t.Context(), "gen", &gen); return gen == 2 }) {
+		t.Errorf("b still reads generation %d after a bumped it", gen)
+	}
+
+	a.Clear(t.Context())
+	if !waitFor(func() bool { return b.local.Len() == 0 }) {
+		t.Errorf("b kept %d local entries after a cleared the cache", b.local.Len())
+	}
+}
+
+func waitFor(cond func() bool) bool {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if cond() {
+			return true
+		}
+	}
+	return false
+}
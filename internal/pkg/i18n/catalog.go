@@ -0,0 +1,138 @@
+package i18n
+
+// catalogs holds every user-facing API message, keyed by language and then
+// by message key. Add a key to all languages at once.
+var catalogs = map[string]map[string]string{
+	English: {
+		"request.book_id_required":   "invalid URL: book ID required",
+		"request.book_id_empty":      "book ID cannot be empty",
+		"request.invalid_json":       "invalid JSON format",
+		"request.no_changes":         "no changes provided",
+		"request.validation_failed":  "request body failed validation",
+		"request.method_not_allowed": "method not allowed",
+		"request.not_acceptable":     "supported media types: %s",
+		"request.rate_limited":       "too many requests, retry later",
+		"request.not_cached":         "the response is not cached and only-if-cached was requested",
+		"pagination.invalid_page":    "page must be greater than 0",
+		"pagination.invalid_limit":   "limit must be between 1 and 15000",
+		"book.not_found":             "book not found",
+		"book.list_empty":            "no books found",
+		"book.created":               "Book created successfully",
+		"book.updated":               "Book updated successfully",
+		"book.deleted":               "Book deleted successfully",
+		"book.conflict":              "a book with this ID already exists",
+		"server.internal_error":      "internal server error",
+
+		"auth.token_required":  "a bearer token is required",
+		"auth.token_invalid":   "the bearer token is invalid",
+		"auth.token_expired":   "the bearer token has expired",
+		"auth.forbidden":       "you do not have permission to perform this action",
+		"auth.api_key_invalid": "the API key is invalid, revoked or expired",
+
+		"auth.invalid_credentials":   "invalid email or password",
+		"auth.account_locked":        "the account is locked after too many failed logins, try again later or reset the password",
+		"auth.refresh_token_invalid": "the refresh token is invalid, expired or already used",
+		"auth.logged_out":            "Logged out",
+		"auth.reset_requested":       "If the account exists, a password reset link has been sent to its email",
+		"auth.reset_token_invalid":   "the password reset token is invalid, expired or already used",
+		"auth.reset_unavailable":     "password reset by email is not available on this server",
+		"auth.password_reset":        "Password changed; log in with the new password",
+
+		"user.registered":   "Account created",
+		"user.updated":      "User updated successfully",
+		"user.not_found":    "user not found",
+		"user.conflict":     "an account with this email already exists",
+		"user.unknown_role": "unknown role %q",
+
+		"api_key.not_found":     "API key not found",
+		"api_key.created":       "API key created; store it now, it will not be shown again",
+		"api_key.revoked":       "API key revoked",
+		"api_key.unknown_scope": "unknown scope %q",
+		"api_key.expired":       "expires_at must be in the future",
+
+		"error.not_found":   "resource not found",
+		"error.conflict":    "resource conflicts with its current state",
+		"error.validation":  "invalid data",
+		"error.unavailable": "service temporarily unavailable, please retry later",
+
+		"status.400": "Bad Request",
+		"status.401": "Unauthorized",
+		"status.403": "Forbidden",
+		"status.404": "Not Found",
+		"status.405": "Method Not Allowed",
+		"status.406": "Not Acceptable",
+		"status.409": "Conflict",
+		"status.423": "Locked",
+		"status.429": "Too Many Requests",
+		"status.500": "Internal Server Error",
+		"status.501": "Not Implemented",
+		"status.503": "Service Unavailable",
+		"status.504": "Gateway Timeout",
+	},
+	Russian: {
+		"request.book_id_required":   "неверный URL: требуется ID книги",
+		"request.book_id_empty":      "ID книги не может быть пустым",
+		"request.invalid_json":       "некорректный формат JSON",
+		"request.no_changes":         "нет изменений",
+		"request.validation_failed":  "тело запроса не прошло проверку",
+		"request.method_not_allowed": "метод не поддерживается",
+		"request.not_acceptable":     "поддерживаемые типы данных: %s",
+		"request.rate_limited":       "слишком много запросов, повторите позже",
+		"request.not_cached":         "ответ не закэширован, а запрос указал only-if-cached",
+		"pagination.invalid_page":    "номер страницы должен быть больше 0",
+		"pagination.invalid_limit":   "limit должен быть от 1 до 15000",
+		"book.not_found":             "книга не найдена",
+		"book.list_empty":            "книги не найдены",
+		"book.created":               "Книга успешно создана",
+		"book.updated":               "Книга успешно обновлена",
+		"book.deleted":               "Книга успешно удалена",
+		"book.conflict":              "книга с таким ID уже существует",
+		"server.internal_error":      "внутренняя ошибка сервера",
+
+		"auth.token_required":  "требуется bearer-токен",
+		"auth.token_invalid":   "недействительный bearer-токен",
+		"auth.token_expired":   "срок действия bearer-токена истёк",
+		"auth.forbidden":       "недостаточно прав для этого действия",
+		"auth.api_key_invalid": "API-ключ недействителен, отозван или истёк",
+
+		"auth.invalid_credentials":   "неверный email или пароль",
+		"auth.account_locked":        "учётная запись заблокирована после слишком многих неудачных входов, повторите позже или сбросьте пароль",
+		"auth.refresh_token_invalid": "refresh-токен недействителен, истёк или уже использован",
+		"auth.logged_out":            "Выход выполнен",
+		"auth.reset_requested":       "Если учётная запись существует, ссылка для сброса пароля отправлена на её email",
+		"auth.reset_token_invalid":   "токен сброса пароля недействителен, истёк или уже использован",
+		"auth.reset_unavailable":     "сброс пароля по email на этом сервере недоступен",
+		"auth.password_reset":        "Пароль изменён; войдите с новым паролем",
+
+		"user.registered":   "Учётная запись создана",
+		"user.updated":      "Пользователь успешно обновлён",
+		"user.not_found":    "пользователь не найден",
+		"user.conflict":     "учётная запись с таким email уже существует",
+		"user.unknown_role": "неизвестная роль %q",
+
+		"api_key.not_found":     "API-ключ не найден",
+		"api_key.created":       "API-ключ создан; сохраните его сейчас, повторно он не будет показан",
+		"api_key.revoked":       "API-ключ отозван",
+		"api_key.unknown_scope": "неизвестная область доступа %q",
+		"api_key.expired":       "expires_at должен быть в будущем",
+
+		"error.not_found":   "ресурс не найден",
+		"error.conflict":    "конфликт с текущим состоянием ресурса",
+		"error.validation":  "некорректные данные",
+		"error.unavailable": "сервис временно недоступен, повторите попытку позже",
+
+		"status.400": "Некорректный запрос",
+		"status.401": "Требуется авторизация",
+		"status.403": "Доступ запрещён",
+		"status.404": "Не найдено",
+		"status.405": "Метод не разрешён",
+		"status.406": "Неприемлемый формат",
+		"status.409": "Конфликт",
+		"status.423": "Заблокировано",
+		"status.429": "Слишком много запросов",
+		"status.500": "Внутренняя ошибка сервера",
+		"status.501": "Не реализовано",
+		"status.503": "Сервис недоступен",
+		"status.504": "Шлюз не отвечает",
+	},
+}
@@ -0,0 +1,131 @@
+package i18n
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"golang.org/x/text/language"
+)
+
+const (
+	English = "en"
+	Russian = "ru"
+)
+
+var (
+	mu          sync.RWMutex
+	defaultLang = English
+	matcher     = newMatcher(English)
+)
+
+func newMatcher(def string) language.Matcher {
+	supported := []language.Tag{language.Make(def)}
+	for lang := range catalogs {
+		if lang != def {
+			supported = append(supported, language.Make(lang))
+		}
+	}
+	return language.NewMatcher(supported)
+}
+
+// Supported reports whether lang has a message catalog.
+func Supported(lang string) bool {
+	_, ok := catalogs[lang]
+	return ok
+}
+
+// Languages lists the supported languages in alphabetical order.
+func Languages() []string {
+	langs := make([]string, 0, len(catalogs))
+	for lang := range catalogs {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// SetDefault selects the language used when the client sends no
+// Accept-Language header or asks only for unsupported languages.
+func SetDefault(lang string) error {
+	if _, ok := catalogs[lang]; !ok {
+		return fmt.Errorf("unsupported language %q", lang)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	defaultLang = lang
+	matcher = newMatcher(lang)
+	return nil
+}
+
+// Default returns the fallback language.
+func Default() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return defaultLang
+}
+
+// Match picks the best supported language for an Accept-Language value.
+func Match(acceptLanguage string) string {
+	mu.RLock()
+	m := matcher
+	mu.RUnlock()
+
+	tag, _ := language.MatchStrings(m, acceptLanguage)
+	base, _ := tag.Base()
+	if _, ok := catalogs[base.String()]; !ok {
+		return Default()
+	}
+	return base.String()
+}
+
+// FromRequest picks the response language from the request's Accept-Language.
+func FromRequest(r *http.Request) string {
+	if r == nil {
+		return Default()
+	}
+	return Match(r.Header.Get("Accept-Language"))
+}
+
+// Lookup translates a message key, falling back to the default language. It
+// reports false when no catalog knows the key.
+func Lookup(lang, key string, args ...interface{}) (string, bool) {
+	format, ok := catalogs[lang][key]
+	if !ok {
+		if format, ok = catalogs[Default()][key]; !ok {
+			return key, false
+		}
+	}
+	if len(args) == 0 {
+		return format, true
+	}
+	return fmt.Sprintf(format, args...), true
+}
+
+// T is Lookup that returns the key itself for unknown messages.
+func T(lang, key string, args ...interface{}) string {
+	msg, _ := Lookup(lang, key, args...)
+	return msg
+}
+
+// Message is an error whose text is looked up in the catalogs when it reaches
+// the client. Error() renders it in English for logs.
+type Message struct {
+	Key  string
+	Args []interface{}
+}
+
+// Error builds a localizable error for the given message key.
+func Error(key string, args ...interface{}) *Message {
+	return &Message{Key: key, Args: args}
+}
+
+func (m *Message) Error() string {
+	return m.Localize(English)
+}
+
+// Localize renders the message in lang.
+func (m *Message) Localize(lang string) string {
+	return T(lang, m.Key, m.Args...)
+}
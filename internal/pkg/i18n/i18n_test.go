@@ -0,0 +1,102 @@
+package i18n
+
+import (
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		acceptLanguage string
+		want           string
+	}{
+		{"", English},
+		{"ru", Russian},
+		{"ru-RU", Russian},
+		{"RU-ru", Russian},
+		{"en-GB", English},
+		{"de", English},
+		{"de-DE, fr;q=0.8", English},
+		{"de, ru;q=0.5", Russian},
+		{"ru;q=0.3, en;q=0.7", English},
+		{"en;q=0.2, ru-RU;q=0.9", Russian},
+		{"*", English},
+		{"not a language", English},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.acceptLanguage); got != tt.want {
+			t.Errorf("Match(%q) = %q, want %q", tt.acceptLanguage, got, tt.want)
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Language", "ru-RU,ru;q=0.9")
+	if got := FromRequest(r); got != Russian {
+		t.Errorf("FromRequest = %q, want ru", got)
+	}
+	if got := FromRequest(nil); got != English {
+		t.Errorf("FromRequest(nil) = %q, want the default", got)
+	}
+}
+
+func TestSetDefault(t *testing.T) {
+	t.Cleanup(func() { SetDefault(English) })
+	if err := SetDefault("de"); err == nil {
+		t.Error("SetDefault(de) accepted an unsupported language")
+	}
+	if err := SetDefault(Russian); err != nil {
+		t.Fatal(err)
+	}
+	for _, acceptLanguage := range []string{"", "de", "fr-FR"} {
+		if got := Match(acceptLanguage); got != Russian {
+			t.Errorf("Match(%q) = %q with default ru", acceptLanguage, got)
+		}
+	}
+	if got := Match("en-US"); got != English {
+		t.Errorf("Match(en-US) = %q with default ru, want en", got)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	if got, ok := Lookup(Russian, "user.unknown_role", "owner"); !ok || got != `неизвестная роль "owner"` {
+		t.Errorf("Lookup = %q, %t", got, ok)
+	}
+	if got, ok := Lookup("de", "book.not_found"); !ok || got != "book not found" {
+		t.Errorf("Lookup in an unsupported language = %q, %t; want the default", got, ok)
+	}
+	if got, ok := Lookup(English, "no.such_key"); ok || got != "no.such_key" {
+		t.Errorf("Lookup of an unknown key = %q, %t", got, ok)
+	}
+	if got := Error("book.not_found").Error(); got != "book not found" {
+		t.Errorf("Message.Error = %q, want English", got)
+	}
+}
+
+var verb = regexp.MustCompile(`%[a-zA-Z%]`)
+
+// Every message exists in every catalog with the same format verbs, so no
+// client gets a key or a mangled argument in place of a translation.
+func TestCatalogsComplete(t *testing.T) {
+	if got := Languages(); !slices.Equal(got, []string{English, Russian}) {
+		t.Errorf("Languages = %q", got)
+	}
+	for lang, catalog := range catalogs {
+		for key, format := range catalogs[English] {
+			translated, ok := catalog[key]
+			if !ok {
+				t.Errorf("%s: missing %s", lang, key)
+				continue
+			}
+			if got, want := verb.FindAllString(translated, -1), verb.FindAllString(format, -1); !slices.Equal(got, want) {
+				t.Errorf("%s: %s has verbs %q, want %q", lang, key, got, want)
+			}
+		}
+		for key := range catalog {
+			if _, ok := catalogs[English][key]; !ok {
+				t.Errorf("%s: %s is not in the en catalog", lang, key)
+			}
+		}
+	}
+}
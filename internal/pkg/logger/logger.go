@@ -1,10 +1,12 @@
 package logger
 
 import (
+	"context"
 	"os"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var Logger zerolog.Logger
@@ -24,10 +26,54 @@ func Init(level string, pretty bool) {
 			Timestamp().
 			Logger()
 	}
+	Logger = Logger.Hook(traceHook{})
 
 	log.Logger = Logger
 }
 
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying l, the logger of one request.
+func NewContext(ctx context.Context, l *zerolog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// Ctx returns the logger of the request ctx belongs to, with the request's
+// fields attached, or the global logger outside requests.
+func Ctx(ctx context.Context) *zerolog.Logger {
+	if l, ok := ctx.Value(contextKey{}).(*zerolog.Logger); ok {
+		return l
+	}
+	return &log.Logger
+}
+
+// Update adds fields to the logger of the request ctx belongs to, e.g. the
+// user once authenticated. Outside requests it does nothing. It must not
+// run while the logger is in use by another goroutine.
+func Update(ctx context.Context, fields func(zerolog.Context) zerolog.Context) {
+	if l, ok := ctx.Value(contextKey{}).(*zerolog.Logger); ok {
+		l.UpdateContext(fields)
+	}
+}
+
+// traceHook adds the trace and span IDs of an event's context, so the log
+// lines of a request can be found from its trace and back. Request loggers
+// (see Ctx) carry the request's context; other events get one from
+// zerolog's Event.Ctx.
+type traceHook struct{}
+
+func (traceHook) Run(e *zerolog.Event, level zerolog.Level, msg string) {
+	sc := trace.SpanContextFromContext(e.GetCtx())
+	if sc.IsValid() {
+		e.Str("trace_id", sc.TraceID().String()).Str("span_id", sc.SpanID().String())
+	}
+}
+
+// SetLevel changes the level of the global logger at runtime.
+func SetLevel(level string) {
+	zerolog.SetGlobalLevel(parseLevel(level))
+}
+
 func parseLevel(level string) zerolog.Level {
 	switch level {
 	case "debug":
@@ -0,0 +1,39 @@
+// Package mail sends transactional mail, such as password reset links.
+package mail
+
+import (
+	"context"
+	"libraryapi/internal/pkg/logger"
+)
+
+// Drivers select how mail is delivered.
+const (
+	DriverNone = "none"
+	DriverLog  = "log"
+	DriverSMTP = "smtp"
+)
+
+// Message is a plain-text mail.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages. Implementations must be safe for concurrent use.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// LogMailer writes messages to the log instead of sending them. It is meant
+// for development: the log then holds secrets such as reset tokens.
+type LogMailer struct{}
+
+func (LogMailer) Send(ctx context.Context, msg Message) error {
+	logger.Ctx(ctx).Info().
+		Str("to", msg.To).
+		Str("subject", msg.Subject).
+		Str("body", msg.Body).
+		Msg("Mail not sent, logging it instead")
+	return nil
+}
@@ -0,0 +1,104 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type SMTPOptions struct {
+	Host string
+	Port int
+	// Username and Password authenticate with PLAIN auth, which the client
+	// only sends over TLS or to localhost. Empty Username skips auth.
+	Username string
+	Password string
+	From     string // address, optionally with a name: Library <no-reply@example.com>
+	// Insecure allows servers that do not offer STARTTLS.
+	Insecure bool
+}
+
+// SMTPMailer sends each message over a new connection to an SMTP relay,
+// upgraded with STARTTLS.
+type SMTPMailer struct {
+	opts SMTPOptions
+}
+
+func NewSMTPMailer(opts SMTPOptions) *SMTPMailer {
+	return &SMTPMailer{opts: opts}
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if strings.ContainsAny(msg.To, "\r\n") || strings.ContainsAny(msg.Subject, "\r\n") {
+		return errors.New("mail header contains a line break")
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(m.opts.Host, strconv.Itoa(m.opts.Port)))
+	if err != nil {
+		return fmt.Errorf("connect to smtp server: %w", err)
+	}
+	// Abort the exchange when ctx ends; net/smtp knows no contexts.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	c, err := smtp.NewClient(conn, m.opts.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp greeting: %w", err)
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: m.opts.Host}); err != nil {
+			return fmt.Errorf("smtp starttls: %w", err)
+		}
+	} else if !m.opts.Insecure {
+		return errors.New("smtp server does not support STARTTLS")
+	}
+	if m.opts.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", m.opts.Username, m.opts.Password, m.opts.Host)); err != nil {
+			return fmt.Errorf("smtp auth: %w", err)
+		}
+	}
+	from, err := netmail.ParseAddress(m.opts.From)
+	if err != nil {
+		return fmt.Errorf("sender address: %w", err)
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return fmt.Errorf("smtp MAIL FROM: %w", err)
+	}
+	if err := c.Rcpt(msg.To); err != nil {
+		return fmt.Errorf("smtp RCPT TO: %w", err)
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("smtp DATA: %w", err)
+	}
+	if err := write(w, from, msg); err != nil {
+		return fmt.Errorf("write mail: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp DATA: %w", err)
+	}
+	return c.Quit()
+}
+
+// write renders msg as a UTF-8 plain-text mail. The DATA writer turns bare
+// newlines into CRLF.
+func write(w io.Writer, from *netmail.Address, msg Message) error {
+	_, err := fmt.Fprintf(w, "From: %s\nTo: %s\nSubject: %s\nDate: %s\n"+
+		"MIME-Version: 1.0\nContent-Type: text/plain; charset=utf-8\nContent-Transfer-Encoding: 8bit\n\n%s",
+		from.String(), msg.To, mime.QEncoding.Encode("utf-8", msg.Subject),
+		time.Now().Format(time.RFC1123Z), msg.Body)
+	return err
+}
@@ -0,0 +1,89 @@
+package mail
+
+import (
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// fakeSMTP accepts one mail without TLS or auth and sends its DATA to got.
+func fakeSMTP(t *testing.T) (port int, got <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	data := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tp := textproto.NewConn(conn)
+		tp.PrintfLine("220 fake ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.Fields(line)[0]); cmd {
+			case "EHLO", "HELO", "MAIL", "RCPT":
+				tp.PrintfLine("250 OK")
+			case "DATA":
+				tp.PrintfLine("354 go ahead")
+				lines, _ := tp.ReadDotLines()
+				data <- strings.Join(lines, "\n")
+				tp.PrintfLine("250 queued")
+			case "QUIT":
+				tp.PrintfLine("221 bye")
+				return
+			default:
+				tp.PrintfLine("502 unknown command")
+			}
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port, data
+}
+
+func TestSMTPMailer(t *testing.T) {
+	port, got := fakeSMTP(t)
+	m := NewSMTPMailer(SMTPOptions{Host: "127.0.0.1", Port: port, From: "Library <no-reply@example.com>", Insecure: true})
+	err := m.Send(context.Background(), Message{To: "reader@example.com", Subject: "Сброс пароля", Body: "line one\nline two\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers, body, _ := strings.Cut(<-got, "\n\n")
+	for _, want := range []string{
+		`From: "Library" <no-reply@example.com>`,
+		"To: reader@example.com",
+		"Subject: =?utf-8?q?",
+		"Content-Type: text/plain; charset=utf-8",
+	} {
+		if !strings.Contains(headers, want) {
+			t.Errorf("headers lack %q:\n%s", want, headers)
+		}
+	}
+	if body != "line one\nline two" {
+		t.Errorf("body %q", body)
+	}
+}
+
+func TestSMTPMailerRequiresTLS(t *testing.T) {
+	port, _ := fakeSMTP(t)
+	m := NewSMTPMailer(SMTPOptions{Host: "127.0.0.1", Port: port, From: "no-reply@example.com"})
+	if err := m.Send(context.Background(), Message{To: "reader@example.com"}); err == nil {
+		t.Error("sent mail to a server without STARTTLS")
+	}
+}
+
+func TestSMTPMailerRejectsHeaderInjection(t *testing.T) {
+	m := NewSMTPMailer(SMTPOptions{Host: "127.0.0.1", Port: 1, From: "no-reply@example.com"})
+	err := m.Send(context.Background(), Message{To: "reader@example.com\r\nBcc: victim@example.com"})
+	if err == nil || !strings.Contains(err.Error(), "line break") {
+		t.Errorf("Send = %v, want a line break error", err)
+	}
+}
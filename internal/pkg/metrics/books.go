@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"context"
+	"libraryapi/internal/api/dto"
+	"libraryapi/internal/domain/repositories"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// BookWritten counts a book created, updated or deleted through the API;
+// op is "create", "update" or "delete".
+func (m *Metrics) BookWritten(op string) {
+	m.bookWrites.WithLabelValues(op).Inc()
+}
+
+// WatchBooks counts the books in repo now and then every interval until ctx
+// is done. Counting queries storage, so it is not done on every scrape.
+func (m *Metrics) WatchBooks(ctx context.Context, repo repositories.BookRepository, interval time.Duration) {
+	m.countBooks(ctx, repo, interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.countBooks(ctx, repo, interval)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (m *Metrics) countBooks(ctx context.Context, repo repositories.BookRepository, timeout time.Duration) {
+	qctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	// The total comes with any page; the smallest is cheapest.
+	_, total, err := repo.Getall(qctx, dto.Pagination{Page: 1, Limit: 1})
+	if err != nil {
+		if ctx.Err() == nil { // not shutting down
+			log.Warn().Err(err).Msg("Failed to count books for metrics")
+		}
+		return
+	}
+	m.books.Set(float64(total))
+}
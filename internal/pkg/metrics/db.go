@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// dbCollector reads the connection pool statistics of a database on every
+// scrape, so they are never older than the scrape itself.
+type dbCollector struct {
+	db StatsGetter
+
+	maxOpen, open, inUse, idle       *prometheus.Desc
+	waitCount, waitDuration          *prometheus.Desc
+	closedMaxIdle, closedMaxIdleTime *prometheus.Desc
+	closedMaxLifetime                *prometheus.Desc
+}
+
+func newDBCollector(name string, db StatsGetter) *dbCollector {
+	desc := func(metric, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db", metric), help, nil, prometheus.Labels{"db": name})
+	}
+	return &dbCollector{
+		db:                db,
+		maxOpen:           desc("max_open_connections", "Maximum number of open connections to the database."),
+		open:              desc("open_connections", "Established connections, in use and idle."),
+		inUse:             desc("in_use_connections", "Connections currently in use."),
+		idle:              desc("idle_connections", "Idle connections."),
+		waitCount:         desc("wait_count_total", "Connections waited for because the pool was exhausted."),
+		waitDuration:      desc("wait_duration_seconds_total", "Time spent waiting for a connection."),
+		closedMaxIdle:     desc("closed_max_idle_total", "Connections closed because of the idle connection limit."),
+		closedMaxIdleTime: desc("closed_max_idle_time_total", "Connections closed because they were idle too long."),
+		closedMaxLifetime: desc("closed_max_lifetime_total", "Connections closed because they reached their maximum lifetime."),
+	}
+}
+
+func (c *dbCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c *dbCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.db.Stats()
+	gauge := func(d *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, v)
+	}
+	counter := func(d *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, v)
+	}
+	gauge(c.maxOpen, float64(s.MaxOpenConnections))
+	gauge(c.open, float64(s.OpenConnections))
+	gauge(c.inUse, float64(s.InUse))
+	gauge(c.idle, float64(s.Idle))
+	counter(c.waitCount, float64(s.WaitCount))
+	counter(c.waitDuration, s.WaitDuration.Seconds())
+	counter(c.closedMaxIdle, float64(s.MaxIdleClosed))
+	counter(c.closedMaxIdleTime, float64(s.MaxIdleTimeClosed))
+	counter(c.closedMaxLifetime, float64(s.MaxLifetimeClosed))
+}
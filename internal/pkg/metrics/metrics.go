@@ -0,0 +1,120 @@
+// Package metrics collects the server's Prometheus metrics and serves them
+// in the text exposition format.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "library"
+
+// Metrics holds the collectors of one server. Each Metrics has its own
+// registry, so tests can create as many as they like.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	size     *prometheus.HistogramVec
+
+	cacheLookups *prometheus.CounterVec
+	cacheErrors  *prometheus.CounterVec
+
+	bookWrites *prometheus.CounterVec
+	books      prometheus.Gauge
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests served, by method, route pattern and status code.",
+		}, []string{"method", "route", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time to serve HTTP requests, by method and route pattern.",
+			Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"method", "route"}),
+		size: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_response_size_bytes",
+			Help:      "Size of HTTP response bodies, by method and route pattern.",
+			Buckets:   prometheus.ExponentialBuckets(128, 4, 8),
+		}, []string{"method", "route"}),
+		cacheLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "cache_lookups_total",
+			Help:      "Response cache lookups, by cache route and result: hit, stale, miss or bypass.",
+		}, []string{"route", "result"}),
+		cacheErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "cache_errors_total",
+			Help:      "Response cache operations that failed, by cache route and operation.",
+		}, []string{"route", "op"}),
+		bookWrites: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "book_writes_total",
+			Help:      "Books created, updated or deleted by this instance; rate() gives writes per interval.",
+		}, []string{"op"}),
+		books: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "books",
+			Help:      "Books in the catalog, as of the last refresh.",
+		}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests, m.duration, m.size,
+		m.cacheLookups, m.cacheErrors,
+		m.bookWrites, m.books,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest records a served request. Its signature matches
+// middleware.RequestObserver.
+func (m *Metrics) ObserveRequest(r *http.Request, route string, status, bytes int, d time.Duration) {
+	if route == "" {
+		route = "unmatched"
+	}
+	m.requests.WithLabelValues(r.Method, route, strconv.Itoa(status)).Inc()
+	m.duration.WithLabelValues(r.Method, route).Observe(d.Seconds())
+	m.size.WithLabelValues(r.Method, route).Observe(float64(bytes))
+}
+
+// CacheLookup records the result of a response cache lookup.
+func (m *Metrics) CacheLookup(route, result string) {
+	m.cacheLookups.WithLabelValues(route, result).Inc()
+}
+
+// CacheError records a failed response cache operation.
+func (m *Metrics) CacheError(route, op string) {
+	m.cacheErrors.WithLabelValues(route, op).Inc()
+}
+
+// RegisterDB exports the connection pool statistics of a database.
+func (m *Metrics) RegisterDB(name string, db StatsGetter) {
+	m.registry.MustRegister(newDBCollector(name, db))
+}
+
+// StatsGetter is implemented by *sql.DB and the storage backends built on
+// one.
+type StatsGetter interface {
+	Stats() sql.DBStats
+}
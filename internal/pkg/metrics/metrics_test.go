@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"libraryapi/internal/Storage"
+	"libraryapi/internal/api/middleware"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scrape returns the metrics m exposes.
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("scrape status = %d", rec.Code)
+	}
+	body, _ := io.ReadAll(rec.Body)
+	return string(body)
+}
+
+func assertMetric(t *testing.T, metrics, line string) {
+	t.Helper()
+	if !strings.Contains(metrics, line+"\n") {
+		t.Errorf("metrics lack %q", line)
+	}
+}
+
+func TestObserveRequestByRoute(t *testing.T) {
+	m := New()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/books/", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	// A middleware between Logger and the mux that copies the request, as
+	// CORS or authentication may.
+	copying := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), struct{}{}, 1)))
+		})
+	}
+	h := middleware.Chain(middleware.Logger(m.ObserveRequest), copying)(middleware.RecordRoute(mux))
+
+	for _, path := range []string{"/api/books/1", "/api/books/2", "/nowhere"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	got := scrape(t, m)
+	assertMetric(t, got, `library_http_requests_total{method="GET",route="/api/books/",status="404"} 2`)
+	assertMetric(t, got, `library_http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+	assertMetric(t, got, `library_http_request_duration_seconds_count{method="GET",route="/api/books/"} 2`)
+}
+
+func TestCacheAndBookMetrics(t *testing.T) {
+	m := New()
+	m.CacheLookup("book", "hit")
+	m.CacheLookup("book", "hit")
+	m.CacheLookup("books", "miss")
+	m.CacheError("book", "set")
+	m.BookWritten("create")
+
+	got := scrape(t, m)
+	assertMetric(t, got, `library_cache_lookups_total{result="hit",route="book"} 2`)
+	assertMetric(t, got, `library_cache_lookups_total{result="miss",route="books"} 1`)
+	assertMetric(t, got, `library_cache_errors_total{op="set",route="book"} 1`)
+	assertMetric(t, got, `library_book_writes_total{op="create"} 1`)
+}
+
+type fakeDB sql.DBStats
+
+func (db fakeDB) Stats() sql.DBStats { return sql.DBStats(db) }
+
+func TestDBStats(t *testing.T) {
+	m := New()
+	m.RegisterDB("postgres", fakeDB{MaxOpenConnections: 25, OpenConnections: 7, InUse: 4, Idle: 3, WaitCount: 2, WaitDuration: 1500 * time.Millisecond})
+
+	got := scrape(t, m)
+	assertMetric(t, got, `library_db_max_open_connections{db="postgres"} 25`)
+	assertMetric(t, got, `library_db_in_use_connections{db="postgres"} 4`)
+	assertMetric(t, got, `library_db_wait_count_total{db="postgres"} 2`)
+	assertMetric(t, got, `library_db_wait_duration_seconds_total{db="postgres"} 1.5`)
+}
+
+func TestWatchBooks(t *testing.T) {
+	repo := Storage.NewMemory()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, title := range []string{"Dune", "Solaris", "Roadside Picnic"} {
+		if _, err := repo.Create(ctx, title, "Author", 1970); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := New()
+	done := make(chan struct{})
+	go func() {
+		m.WatchBooks(ctx, repo, time.Hour)
+		close(done)
+	}()
+	deadline := time.Now().Add(time.Second)
+	for !strings.Contains(scrape(t, m), "library_books 3\n") {
+		if time.Now().After(deadline) {
+			t.Fatal("book count not exported")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+}
@@ -0,0 +1,364 @@
+// Package migrate applies versioned SQL migrations to PostgreSQL.
+//
+// Applied versions are recorded in schema_migrations together with a checksum
+// of the up script, so edits to already applied files are detected. A
+// session-level advisory lock keeps concurrent server instances or libctl
+// runs from migrating the same database at once.
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lockID is the pg_advisory_lock key reserved for migrations.
+const lockID int64 = 7_262_011_001
+
+var (
+	ErrChecksumMismatch = errors.New("applied migration was modified")
+	ErrIrreversible     = errors.New("migration has no down script")
+	ErrUnknownVersion   = errors.New("unknown migration version")
+)
+
+// Migration is one version with its up and (optional) down script.
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// State of a migration as reported by Status.
+const (
+	StatePending  = "pending"
+	StateApplied  = "applied"
+	StateModified = "modified" // applied, but the up script changed since
+	StateMissing  = "missing"  // applied, but no longer present in the files
+)
+
+// Status describes one migration version.
+type Status struct {
+	Version   int
+	Name      string
+	State     string
+	AppliedAt time.Time
+}
+
+// Load reads NNN_name.up.sql / NNN_name.down.sql pairs from the root of fsys.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		name := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		prefix, rest, ok := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: name must start with a positive version, e.g. 001_", name)
+		}
+		body, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: strings.TrimSuffix(rest, "."+direction+".sql")}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			if m.Up != "" {
+				return nil, fmt.Errorf("migration %d: duplicate up script %s", version, name)
+			}
+			m.Up = string(body)
+			sum := sha256.Sum256(body)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			if m.Down != "" {
+				return nil, fmt.Errorf("migration %d: duplicate down script %s", version, name)
+			}
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d: missing up script", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrator runs migrations against one database.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// New loads the migrations in fsys for db.
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Latest returns the highest known version, 0 when there are no migrations.
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+type appliedMigration struct {
+	checksum  string
+	appliedAt time.Time
+}
+
+// withLock runs fn on a dedicated connection holding the migration lock.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn, applied map[int]appliedMigration) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockID); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockID)
+
+	if _, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	applied, err := loadApplied(ctx, conn)
+	if err != nil {
+		return err
+	}
+	return fn(conn, applied)
+}
+
+func loadApplied(ctx context.Context, conn *sql.Conn) (map[int]appliedMigration, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]appliedMigration)
+	for rows.Next() {
+		var (
+			version int
+			a       appliedMigration
+		)
+		if err := rows.Scan(&version, &a.checksum, &a.appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = a
+	}
+	return applied, rows.Err()
+}
+
+// verify refuses to migrate a database whose applied scripts were edited.
+func (m *Migrator) verify(applied map[int]appliedMigration) error {
+	for _, mig := range m.migrations {
+		if a, ok := applied[mig.Version]; ok && a.checksum != mig.Checksum {
+			return fmt.Errorf("%w: %03d_%s", ErrChecksumMismatch, mig.Version, mig.Name)
+		}
+	}
+	return nil
+}
+
+func current(applied map[int]appliedMigration) int {
+	version := 0
+	for v := range applied {
+		if v > version {
+			version = v
+		}
+	}
+	return version
+}
+
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, mig Migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, mig.Up); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("migration %03d_%s up: %w", mig.Version, mig.Name, err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)",
+		mig.Version, mig.Name, mig.Checksum); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("migration %03d_%s: record version: %w", mig.Version, mig.Name, err)
+	}
+	return tx.Commit()
+}
+
+func (m *Migrator) revert(ctx context.Context, conn *sql.Conn, mig Migration) error {
+	if strings.TrimSpace(mig.Down) == "" {
+		return fmt.Errorf("%w: %03d_%s", ErrIrreversible, mig.Version, mig.Name)
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, mig.Down); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("migration %03d_%s down: %w", mig.Version, mig.Name, err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = $1", mig.Version); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("migration %03d_%s: forget version: %w", mig.Version, mig.Name, err)
+	}
+	return tx.Commit()
+}
+
+// Up applies every pending migration and returns the versions it applied.
+func (m *Migrator) Up(ctx context.Context) ([]int, error) {
+	return m.migrateTo(ctx, m.Latest())
+}
+
+// Down reverts the most recently applied steps migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]int, error) {
+	var reverted []int
+	err := m.withLock(ctx, func(conn *sql.Conn, applied map[int]appliedMigration) error {
+		if err := m.verify(applied); err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			if err := m.revert(ctx, conn, mig); err != nil {
+				return err
+			}
+			reverted = append(reverted, mig.Version)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Goto migrates up or down until version is the latest applied migration.
+// Version 0 reverts everything.
+func (m *Migrator) Goto(ctx context.Context, version int) ([]int, error) {
+	if version != 0 {
+		known := false
+		for _, mig := range m.migrations {
+			known = known || mig.Version == version
+		}
+		if !known {
+			return nil, fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+		}
+	}
+	return m.migrateTo(ctx, version)
+}
+
+func (m *Migrator) migrateTo(ctx context.Context, target int) ([]int, error) {
+	var changed []int
+	err := m.withLock(ctx, func(conn *sql.Conn, applied map[int]appliedMigration) error {
+		if err := m.verify(applied); err != nil {
+			return err
+		}
+		// Revert applied migrations above the target, newest first...
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; !ok || mig.Version <= target {
+				continue
+			}
+			if err := m.revert(ctx, conn, mig); err != nil {
+				return err
+			}
+			changed = append(changed, mig.Version)
+		}
+		// ...then apply pending ones up to it, oldest first.
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok || mig.Version > target {
+				continue
+			}
+			if err := m.apply(ctx, conn, mig); err != nil {
+				return err
+			}
+			changed = append(changed, mig.Version)
+		}
+		return nil
+	})
+	return changed, err
+}
+
+// Version returns the latest applied version, 0 for an empty database.
+func (m *Migrator) Version(ctx context.Context) (int, error) {
+	var version int
+	err := m.withLock(ctx, func(_ *sql.Conn, applied map[int]appliedMigration) error {
+		version = current(applied)
+		return nil
+	})
+	return version, err
+}
+
+// Status lists every known or applied migration in version order.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := m.withLock(ctx, func(_ *sql.Conn, applied map[int]appliedMigration) error {
+		known := make(map[int]bool)
+		for _, mig := range m.migrations {
+			known[mig.Version] = true
+			s := Status{Version: mig.Version, Name: mig.Name, State: StatePending}
+			if a, ok := applied[mig.Version]; ok {
+				s.State = StateApplied
+				s.AppliedAt = a.appliedAt
+				if a.checksum != mig.Checksum {
+					s.State = StateModified
+				}
+			}
+			statuses = append(statuses, s)
+		}
+		for version, a := range applied {
+			if !known[version] {
+				statuses = append(statuses, Status{Version: version, State: StateMissing, AppliedAt: a.appliedAt})
+			}
+		}
+		return nil
+	})
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, err
+}
@@ -0,0 +1,251 @@
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+func file(body string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(body)}
+}
+
+func TestLoad(t *testing.T) {
+	migrations, err := Load(fstest.MapFS{
+		"002_add_isbn.up.sql":             file("ALTER TABLE books ADD isbn TEXT;"),
+		"002_add_isbn.down.sql":           file("ALTER TABLE books DROP isbn;"),
+		"001_create_books_table.up.sql":   file("CREATE TABLE books (id TEXT);"),
+		"001_create_books_table.down.sql": file("DROP TABLE books;"),
+		"010_seed.up.sql":                 file("INSERT INTO books VALUES ('1');"),
+		"README.md":                       file("not a migration"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range migrations {
+		got = append(got, fmt.Sprintf("%d %s down=%t", m.Version, m.Name, m.Down != ""))
+	}
+	want := []string{"1 create_books_table down=true", "2 add_isbn down=true", "10 seed down=false"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Load = %q, want %q", got, want)
+	}
+	sum := sha256.Sum256([]byte("CREATE TABLE books (id TEXT);"))
+	if migrations[0].Checksum != hex.EncodeToString(sum[:]) {
+		t.Errorf("checksum %q, want the sha256 of the up script", migrations[0].Checksum)
+	}
+}
+
+func TestLoadRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+		want string
+	}{
+		{"no version", fstest.MapFS{"create_books.up.sql": file("")}, "must start with a positive version"},
+		{"zero version", fstest.MapFS{"000_init.up.sql": file("")}, "must start with a positive version"},
+		{"no separator", fstest.MapFS{"001.up.sql": file("")}, "must start with a positive version"},
+		{"duplicate up", fstest.MapFS{
+			"001_books.up.sql": file("CREATE TABLE books ();"),
+			"1_other.up.sql":   file("CREATE TABLE other ();"),
+		}, "migration 1: duplicate up script"},
+		{"duplicate down", fstest.MapFS{
+			"001_books.up.sql":   file("CREATE TABLE books ();"),
+			"001_books.down.sql": file("DROP TABLE books;"),
+			"01_books.down.sql":  file("DROP TABLE books;"),
+		}, "migration 1: duplicate down script"},
+		{"missing up", fstest.MapFS{
+			"001_books.up.sql":  file("CREATE TABLE books ();"),
+			"002_isbn.down.sql": file("ALTER TABLE books DROP isbn;"),
+		}, "migration 2: missing up script"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(tt.fsys)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	m, err := New(nil, fstest.MapFS{
+		"001_books.up.sql": file("CREATE TABLE books ();"),
+		"002_isbn.up.sql":  file("ALTER TABLE books ADD isbn TEXT;"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied := map[int]appliedMigration{1: {checksum: m.migrations[0].Checksum}}
+	if err := m.verify(applied); err != nil {
+		t.Errorf("verify of unchanged scripts = %v", err)
+	}
+	applied[2] = appliedMigration{checksum: "edited"}
+	if err := m.verify(applied); !errors.Is(err, ErrChecksumMismatch) || !strings.Contains(err.Error(), "002_isbn") {
+		t.Errorf("verify of an edited script = %v, want ErrChecksumMismatch naming 002_isbn", err)
+	}
+	// Versions applied from files that are gone are reported by Status,
+	// not refused.
+	delete(applied, 2)
+	applied[3] = appliedMigration{checksum: "gone"}
+	if err := m.verify(applied); err != nil {
+		t.Errorf("verify with an unknown applied version = %v", err)
+	}
+}
+
+func TestGotoUnknownVersion(t *testing.T) {
+	m, err := New(nil, fstest.MapFS{"001_books.up.sql": file("CREATE TABLE books ();")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Goto(context.Background(), 7); !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("Goto(7) = %v, want ErrUnknownVersion", err)
+	}
+	if m.Latest() != 1 {
+		t.Errorf("Latest = %d, want 1", m.Latest())
+	}
+}
+
+// testDB returns a connection to TEST_POSTGRES_DSN whose search_path is a
+// fresh schema, dropped after the test, so schema_migrations of the test
+// database is left alone.
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+	schema := fmt.Sprintf("migrate_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+	db, err := sql.Open("postgres", dsn+" search_path="+schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+var testMigrations = fstest.MapFS{
+	"001_a.up.sql":   file("CREATE TABLE a (id INT);"),
+	"001_a.down.sql": file("DROP TABLE a;"),
+	"002_b.up.sql":   file("CREATE TABLE b (id INT);"),
+	"002_b.down.sql": file("DROP TABLE b;"),
+	"003_c.up.sql":   file("CREATE TABLE c (id INT);"),
+	"003_c.down.sql": file("DROP TABLE c;"),
+}
+
+func states(t *testing.T, m *Migrator) []string {
+	t.Helper()
+	statuses, err := m.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []string
+	for _, s := range statuses {
+		out = append(out, fmt.Sprintf("%d %s", s.Version, s.State))
+	}
+	return out
+}
+
+func TestMigrator(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	m, err := New(db, testMigrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name string
+		run  func() ([]int, error)
+		want []int
+	}{
+		{"up", func() ([]int, error) { return m.Up(ctx) }, []int{1, 2, 3}},
+		{"up again", func() ([]int, error) { return m.Up(ctx) }, nil},
+		{"goto 1", func() ([]int, error) { return m.Goto(ctx, 1) }, []int{3, 2}},
+		{"goto 3", func() ([]int, error) { return m.Goto(ctx, 3) }, []int{2, 3}},
+		{"down 2", func() ([]int, error) { return m.Down(ctx, 2) }, []int{3, 2}},
+		{"goto 0", func() ([]int, error) { return m.Goto(ctx, 0) }, []int{1}},
+		{"goto 2", func() ([]int, error) { return m.Goto(ctx, 2) }, []int{1, 2}},
+	}
+	for _, step := range steps {
+		got, err := step.run()
+		if err != nil || !slices.Equal(got, step.want) {
+			t.Fatalf("%s = %v, %v; want %v", step.name, got, err, step.want)
+		}
+	}
+	if v, err := m.Version(ctx); err != nil || v != 2 {
+		t.Errorf("Version = %d, %v; want 2", v, err)
+	}
+	if got, want := states(t, m), []string{"1 applied", "2 applied", "3 pending"}; !slices.Equal(got, want) {
+		t.Errorf("Status = %q, want %q", got, want)
+	}
+	if _, err := db.Exec("SELECT * FROM b"); err != nil {
+		t.Errorf("table of migration 2 is missing: %v", err)
+	}
+
+	// An applied script edited afterwards blocks migrating and shows in
+	// Status; a removed one shows as missing.
+	edited := fstest.MapFS{
+		"001_a.up.sql": file("CREATE TABLE a (id BIGINT);"),
+		"003_c.up.sql": testMigrations["003_c.up.sql"],
+	}
+	m2, err := New(db, edited)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m2.Up(ctx); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Up with an edited script = %v, want ErrChecksumMismatch", err)
+	}
+	if got, want := states(t, m2), []string{"1 modified", "2 missing", "3 pending"}; !slices.Equal(got, want) {
+		t.Errorf("Status = %q, want %q", got, want)
+	}
+}
+
+func TestMigratorFailures(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	m, err := New(db, fstest.MapFS{
+		"001_a.up.sql":   file("CREATE TABLE a (id INT);"),
+		"002_bad.up.sql": file("CREATE TABLE b (id INT); SELECT no_such_column FROM a;"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A failing script is rolled back and not recorded.
+	if _, err := m.Up(ctx); err == nil || !strings.Contains(err.Error(), "002_bad up") {
+		t.Fatalf("Up = %v, want the error of 002_bad", err)
+	}
+	if v, _ := m.Version(ctx); v != 1 {
+		t.Errorf("Version = %d after a failed migration, want 1", v)
+	}
+	if _, err := db.Exec("SELECT * FROM b"); err == nil {
+		t.Error("table of the failed migration exists")
+	}
+	// Migrations without a down script cannot be reverted.
+	if _, err := m.Down(ctx, 1); !errors.Is(err, ErrIrreversible) {
+		t.Errorf("Down = %v, want ErrIrreversible", err)
+	}
+}
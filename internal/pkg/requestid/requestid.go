@@ -0,0 +1,52 @@
+// Package requestid carries the ID of the request being served, so log
+// lines and error responses can be matched to each other and to the
+// caller's own logs.
+package requestid
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// Header carries request IDs from clients and back in responses.
+const Header = "X-Request-ID"
+
+// maxLen bounds the IDs accepted from clients.
+const maxLen = 128
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying id.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID in ctx, or "" outside a request.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// New returns a random ID.
+func New() string {
+	return uuid.New().String()
+}
+
+// Valid reports whether a client-supplied id may be used: it must be
+// short and consist of letters, digits and -._:/ only, so it can be
+// logged and echoed safely.
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLen {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '.', c == '_', c == ':', c == '/':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_books_year;
+DROP INDEX IF EXISTS idx_books_author;
+DROP INDEX IF EXISTS idx_books_title;
+DROP TABLE IF EXISTS books;
@@ -0,0 +1,42 @@
+CREATE TABLE IF NOT EXISTS roles (
+ name VARCHAR(50) PRIMARY KEY,
+ description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+ name VARCHAR(100) PRIMARY KEY,
+ description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+ role VARCHAR(50) NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+ permission VARCHAR(100) NOT NULL REFERENCES permissions(name) ON DELETE CASCADE,
+ PRIMARY KEY (role, permission)
+);
+
+INSERT INTO roles (name, description) VALUES
+('patron', 'Reads the catalog and manages their own account'),
+('librarian', 'Maintains the catalog'),
+('admin', 'Manages users and settings')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO permissions (name, description) VALUES
+('books:read', 'Read the catalog'),
+('books:write', 'Create, update and delete books'),
+('account:manage', 'Manage the own account'),
+('users:manage', 'Manage user accounts and their roles'),
+('settings:manage', 'Manage service settings')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role, permission) VALUES
+('patron', 'books:read'),
+('patron', 'account:manage'),
+('librarian', 'books:read'),
+('librarian', 'books:write'),
+('librarian', 'account:manage'),
+('admin', 'books:read'),
+('admin', 'books:write'),
+('admin', 'account:manage'),
+('admin', 'users:manage'),
+('admin', 'settings:manage')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,3 @@
+DELETE FROM role_permissions WHERE permission = 'apikeys:manage';
+DELETE FROM permissions WHERE name = 'apikeys:manage';
+DROP TABLE IF EXISTS api_keys;
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+ id VARCHAR(36) PRIMARY KEY,
+ name VARCHAR(100) NOT NULL,
+ prefix VARCHAR(16) NOT NULL,
+ key_hash CHAR(64) NOT NULL UNIQUE,
+ scopes TEXT[] NOT NULL DEFAULT '{}',
+ created_by VARCHAR(200) NOT NULL DEFAULT '',
+ created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ expires_at TIMESTAMP WITH TIME ZONE,
+ last_used_at TIMESTAMP WITH TIME ZONE,
+ revoked_at TIMESTAMP WITH TIME ZONE
+);
+
+INSERT INTO permissions (name, description) VALUES
+('apikeys:manage', 'Create, list and revoke API keys')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role, permission) VALUES
+('admin', 'apikeys:manage')
+ON CONFLICT DO NOTHING;
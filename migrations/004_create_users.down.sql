@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS password_reset_tokens;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS user_roles;
+DROP INDEX IF EXISTS idx_users_email;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,39 @@
+CREATE TABLE IF NOT EXISTS users (
+ id VARCHAR(36) PRIMARY KEY,
+ email VARCHAR(254) NOT NULL,
+ password_hash TEXT NOT NULL,
+ failed_logins INTEGER NOT NULL DEFAULT 0,
+ locked_until TIMESTAMP WITH TIME ZONE,
+ created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ updated_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (LOWER(email));
+
+CREATE TABLE IF NOT EXISTS user_roles (
+ user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+ role VARCHAR(50) NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+ PRIMARY KEY (user_id, role)
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+ id VARCHAR(36) PRIMARY KEY,
+ user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+ family_id VARCHAR(36) NOT NULL,
+ token_hash CHAR(64) NOT NULL UNIQUE,
+ expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+ revoked_at TIMESTAMP WITH TIME ZONE,
+ replaced_by VARCHAR(36),
+ created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family ON refresh_tokens(family_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user ON refresh_tokens(user_id);
+
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+ token_hash CHAR(64) PRIMARY KEY,
+ user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+ expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+ used_at TIMESTAMP WITH TIME ZONE,
+ created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,10 @@
+// Package migrations embeds the PostgreSQL schema migrations so the server
+// and libctl can apply them without the SQL files on disk.
+//
+// Files are named NNN_description.up.sql and NNN_description.down.sql.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
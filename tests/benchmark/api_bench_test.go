@@ -0,0 +1,74 @@
+package benchmark
+
+import (
+	"context"
+	memstorage "libraryapi/internal/Storage"
+	"libraryapi/internal/api/handlers"
+	"libraryapi/internal/api/middleware"
+	"libraryapi/internal/api/router"
+	"libraryapi/internal/pkg/cache"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func setupAPI(b *testing.B, books int) (http.Handler, string) {
+	b.Helper()
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	b.Cleanup(func() { zerolog.SetGlobalLevel(zerolog.InfoLevel) })
+
+	repo := memstorage.NewMemory()
+	var lastID string
+	for i := 0; i < books; i++ {
+		book, err := repo.Create(context.Background(), "Book", "Author", 1900+i%100)
+		if err != nil {
+			b.Fatal(err)
+		}
+		lastID = book.ID
+	}
+	rc := middleware.NewResponseCache(cache.NewMemoryCache(64<<20), middleware.ResponseCacheOptions{
+		Routes: map[string]middleware.CachePolicy{"book": {TTL: 10 * time.Minute}, "books": {TTL: 5 * time.Minute}},
+	})
+	return router.SetupRouter(handlers.NewBookHandler(repo), router.Options{Cache: rc.Route}), lastID
+}
+
+func serve(b *testing.B, h http.Handler, method, target string) {
+	req := httptest.NewRequest(method, target, nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code >= 400 {
+		b.Fatalf("%s %s: status %d: %s", method, target, rec.Code, rec.Body.String())
+	}
+}
+
+func BenchmarkGetBooksPage(b *testing.B) {
+	h, _ := setupAPI(b, 1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		serve(b, h, http.MethodGet, "/api/books?page=3&limit=20")
+	}
+}
+
+func BenchmarkGetBookByID(b *testing.B) {
+	h, id := setupAPI(b, 1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		serve(b, h, http.MethodGet, "/api/books/"+id)
+	}
+}
+
+func BenchmarkGetBookByIDParallel(b *testing.B) {
+	h, id := setupAPI(b, 1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			serve(b, h, http.MethodGet, "/api/books/"+id)
+		}
+	})
+}
@@ -0,0 +1,134 @@
+package benchmark
+
+import (
+	"libraryapi/internal/domain/models"
+	"libraryapi/internal/pkg/cache"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// redisCache connects to REDIS_HOST:REDIS_PORT (localhost:6379 by default)
+// and skips the benchmark when Redis is not reachable.
+func redisCache(b *testing.B) *cache.RedisCache {
+	b.Helper()
+	host, port := os.Getenv("REDIS_HOST"), os.Getenv("REDIS_PORT")
+	if host == "" {
+		host = "localhost"
+	}
+	if port == "" {
+		port = "6379"
+	}
+	c := cache.NewRedisCache(cache.RedisOptions{Host: host, Port: port, Password: os.Getenv("REDIS_PASSWORD"), Prefix: "bench:"})
+	if err := c.Set(b.Context(), "ping", 1, time.Second); err != nil {
+		c.Close()
+		b.Skipf("redis not available: %v", err)
+	}
+	b.Cleanup(func() { c.Close() })
+	return c
+}
+
+func benchBooks(n int) []models.Book {
+	books := make([]models.Book, n)
+	for i := range books {
+		books[i] = models.Book{
+			ID:         strconv.Itoa(i),
+			Title:      "Book " + strconv.Itoa(i),
+			Author:     "Author",
+			Year:       1900 + i%100,
+			Created_at: time.Now(),
+		}
+	}
+	return books
+}
+
+func benchmarkSetGet(b *testing.B, c cache.Cache, value []models.Book) {
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		key := "books:" + strconv.Itoa(i%64)
+		if err := c.Set(b.Context(), key, value, time.Minute); err != nil {
+			b.Fatal(err)
+		}
+		var out []models.Book
+		if err := c.Get(b.Context(), key, &out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRedisSetGetPage(b *testing.B) {
+	benchmarkSetGet(b, redisCache(b), benchBooks(20))
+}
+
+func BenchmarkMemorySetGetPage(b *testing.B) {
+	benchmarkSetGet(b, cache.NewMemoryCache(64<<20), benchBooks(20))
+}
+
+// BenchmarkTieredGetPage reads a page that stays in the local tier, the
+// common case for hot list pages.
+func BenchmarkTieredGetPage(b *testing.B) {
+	c := cache.NewTieredCache(cache.NewMemoryCache(64<<20), redisCache(b), time.Minute)
+	b.Cleanup(func() { c.Close() })
+	if err := c.Set(b.Context(), "books:page", benchBooks(20), time.Minute); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var out []models.Book
+		if err := c.Get(b.Context(), "books:page", &out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkMemoryParallelGet measures lock contention on the local tier.
+func BenchmarkMemoryParallelGet(b *testing.B) {
+	c := cache.NewMemoryCache(64 << 20)
+	for i := 0; i < 64; i++ {
+		c.Set(b.Context(), "books:"+strconv.Itoa(i), benchBooks(20), time.Minute)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			var out []models.Book
+			if err := c.Get(b.Context(), "books:"+strconv.Itoa(i%64), &out); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkSerializer encodes and decodes a large list page with every
+// codec and compression, reporting the stored size.
+func BenchmarkSerializer(b *testing.B) {
+	books := benchBooks(500)
+	for _, codec := range []cache.Codec{cache.JSON, cache.MsgPack, cache.Gob} {
+		for _, compression := range []cache.Compression{nil, cache.Snappy, cache.Zstd} {
+			name := codec.Name()
+			if compression != nil {
+				name += "+" + compression.Name()
+			}
+			s := cache.NewSerializer(codec, compression, 1024)
+			b.Run(name, func(b *testing.B) {
+				b.ReportAllocs()
+				var size int
+				for i := 0; i < b.N; i++ {
+					data, err := s.Encode(books)
+					if err != nil {
+						b.Fatal(err)
+					}
+					var out []models.Book
+					if err := s.Decode(data, &out); err != nil {
+						b.Fatal(err)
+					}
+					size = len(data)
+				}
+				b.ReportMetric(float64(size), "bytes")
+			})
+		}
+	}
+}